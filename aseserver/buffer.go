@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+var _ tds.BytesChannel = (*buffer)(nil)
+
+// endian is the byte order used for the token stream. The server
+// always communicates in little endian, which is what go-dblib
+// requests during login.
+var endian = binary.LittleEndian
+
+// buffer is an in-memory tds.BytesChannel.
+//
+// Packages are parsed from and written to a buffer, the framing into
+// TDS packets is done by the connection.
+type buffer struct {
+	bs  []byte
+	pos int
+}
+
+func newBuffer(bs []byte) *buffer {
+	return &buffer{bs: bs}
+}
+
+// Len returns the number of unread bytes.
+func (buf *buffer) Len() int {
+	return len(buf.bs) - buf.pos
+}
+
+// Reset discards all data in the buffer.
+func (buf *buffer) Reset() {
+	buf.bs = buf.bs[:0]
+	buf.pos = 0
+}
+
+// Position implements the tds.BytesChannel interface.
+func (buf *buffer) Position() (int, int) {
+	return 0, buf.pos
+}
+
+// SetPosition implements the tds.BytesChannel interface.
+func (buf *buffer) SetPosition(_, pos int) {
+	buf.pos = pos
+}
+
+// DiscardUntilCurrentPosition implements the tds.BytesChannel interface.
+func (buf *buffer) DiscardUntilCurrentPosition() {
+	buf.bs = buf.bs[buf.pos:]
+	buf.pos = 0
+}
+
+// Read implements the io.Reader interface.
+func (buf *buffer) Read(p []byte) (int, error) {
+	if buf.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, buf.bs[buf.pos:])
+	buf.pos += n
+	return n, nil
+}
+
+// Write implements the io.Writer interface.
+func (buf *buffer) Write(p []byte) (int, error) {
+	buf.bs = append(buf.bs, p...)
+	return len(p), nil
+}
+
+// Bytes implements the tds.BytesChannel interface.
+func (buf *buffer) Bytes(n int) ([]byte, error) {
+	if n > buf.Len() {
+		return make([]byte, n), tds.ErrNotEnoughBytes
+	}
+
+	bs := make([]byte, n)
+	copy(bs, buf.bs[buf.pos:buf.pos+n])
+	buf.pos += n
+	return bs, nil
+}
+
+// WriteBytes implements the tds.BytesChannel interface.
+func (buf *buffer) WriteBytes(bs []byte) error {
+	buf.bs = append(buf.bs, bs...)
+	return nil
+}
+
+// Byte implements the tds.BytesChannel interface.
+func (buf *buffer) Byte() (byte, error) {
+	bs, err := buf.Bytes(1)
+	return bs[0], err
+}
+
+// WriteByte implements the tds.BytesChannel interface.
+func (buf *buffer) WriteByte(b byte) error {
+	buf.bs = append(buf.bs, b)
+	return nil
+}
+
+// Uint8 implements the tds.BytesChannel interface.
+func (buf *buffer) Uint8() (uint8, error) {
+	b, err := buf.Byte()
+	return uint8(b), err
+}
+
+// WriteUint8 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteUint8(i uint8) error {
+	return buf.WriteByte(byte(i))
+}
+
+// Int8 implements the tds.BytesChannel interface.
+func (buf *buffer) Int8() (int8, error) {
+	b, err := buf.Byte()
+	return int8(b), err
+}
+
+// WriteInt8 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteInt8(i int8) error {
+	return buf.WriteByte(byte(i))
+}
+
+// Uint16 implements the tds.BytesChannel interface.
+func (buf *buffer) Uint16() (uint16, error) {
+	bs, err := buf.Bytes(2)
+	return endian.Uint16(bs), err
+}
+
+// WriteUint16 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteUint16(i uint16) error {
+	bs := make([]byte, 2)
+	endian.PutUint16(bs, i)
+	return buf.WriteBytes(bs)
+}
+
+// Int16 implements the tds.BytesChannel interface.
+func (buf *buffer) Int16() (int16, error) {
+	i, err := buf.Uint16()
+	return int16(i), err
+}
+
+// WriteInt16 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteInt16(i int16) error {
+	return buf.WriteUint16(uint16(i))
+}
+
+// Uint32 implements the tds.BytesChannel interface.
+func (buf *buffer) Uint32() (uint32, error) {
+	bs, err := buf.Bytes(4)
+	return endian.Uint32(bs), err
+}
+
+// WriteUint32 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteUint32(i uint32) error {
+	bs := make([]byte, 4)
+	endian.PutUint32(bs, i)
+	return buf.WriteBytes(bs)
+}
+
+// Int32 implements the tds.BytesChannel interface.
+func (buf *buffer) Int32() (int32, error) {
+	i, err := buf.Uint32()
+	return int32(i), err
+}
+
+// WriteInt32 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteInt32(i int32) error {
+	return buf.WriteUint32(uint32(i))
+}
+
+// Uint64 implements the tds.BytesChannel interface.
+func (buf *buffer) Uint64() (uint64, error) {
+	bs, err := buf.Bytes(8)
+	return endian.Uint64(bs), err
+}
+
+// WriteUint64 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteUint64(i uint64) error {
+	bs := make([]byte, 8)
+	endian.PutUint64(bs, i)
+	return buf.WriteBytes(bs)
+}
+
+// Int64 implements the tds.BytesChannel interface.
+func (buf *buffer) Int64() (int64, error) {
+	i, err := buf.Uint64()
+	return int64(i), err
+}
+
+// WriteInt64 implements the tds.BytesChannel interface.
+func (buf *buffer) WriteInt64(i int64) error {
+	return buf.WriteUint64(uint64(i))
+}
+
+// String implements the tds.BytesChannel interface.
+func (buf *buffer) String(n int) (string, error) {
+	bs, err := buf.Bytes(n)
+	return string(bs), err
+}
+
+// WriteString implements the tds.BytesChannel interface.
+func (buf *buffer) WriteString(s string) error {
+	return buf.WriteBytes([]byte(s))
+}
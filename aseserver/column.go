@@ -0,0 +1,358 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf16"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Column describes the format of a result column or parameter.
+type Column struct {
+	Name     string
+	DataType asetypes.DataType
+
+	// Length is the maximum length of variable-length data types.
+	// If Length is zero a sensible default for the data type is used.
+	Length int64
+	// Precision and Scale are used for DECN and NUMN. Scale is also
+	// used for BIGDATETIMEN and BIGTIMEN.
+	Precision uint8
+	Scale     uint8
+
+	Nullable bool
+	UserType int32
+
+	// Table is written for TEXT, IMAGE, UNITEXT and XML columns.
+	Table string
+}
+
+// defaultLengths contains the lengths used if a Column does not
+// specify a length for a variable-length data type.
+var defaultLengths = map[asetypes.DataType]int64{
+	asetypes.INTN:         8,
+	asetypes.UINTN:        8,
+	asetypes.FLTN:         8,
+	asetypes.MONEYN:       8,
+	asetypes.DATETIMEN:    8,
+	asetypes.DATEN:        4,
+	asetypes.TIMEN:        4,
+	asetypes.BIGDATETIMEN: 8,
+	asetypes.BIGTIMEN:     8,
+	asetypes.DECN:         17,
+	asetypes.NUMN:         17,
+	asetypes.CHAR:         255,
+	asetypes.VARCHAR:      255,
+	asetypes.BINARY:       255,
+	asetypes.VARBINARY:    255,
+	asetypes.LONGCHAR:     32768,
+	asetypes.LONGBINARY:   32768,
+	asetypes.TEXT:         32768,
+	asetypes.IMAGE:        32768,
+	asetypes.UNITEXT:      32768,
+	asetypes.XML:          32768,
+}
+
+// fieldFmt returns the tds.FieldFmt for the column.
+func (col Column) fieldFmt() (tds.FieldFmt, error) {
+	fieldFmt, err := tds.LookupFieldFmt(col.DataType)
+	if err != nil {
+		return nil, fmt.Errorf("aseserver: error looking up format for column %q: %w", col.Name, err)
+	}
+
+	fieldFmt.SetName(col.Name)
+	fieldFmt.SetUserType(col.UserType)
+	if col.Nullable {
+		fieldFmt.SetStatus(uint(tds.TDS_ROW_NULLALLOWED))
+	}
+
+	// The maximum length, precision and scale of a format cannot be
+	// set directly - instead the format information is serialized and
+	// then read into the format.
+	length := col.Length
+	if length == 0 {
+		length = defaultLengths[col.DataType]
+	}
+
+	precision := col.Precision
+	if precision == 0 {
+		precision = asetypes.ASEDecimalDefaultPrecision
+	}
+
+	buf := newBuffer(nil)
+	if !fieldFmt.IsFixedLength() {
+		if err := writeLength(buf, fieldFmt.LengthBytes(), length); err != nil {
+			return nil, err
+		}
+	}
+
+	switch fieldFmt.(type) {
+	case *tds.DecNFieldFmt, *tds.NumNFieldFmt:
+		if err := buf.WriteUint8(precision); err != nil {
+			return nil, err
+		}
+		if err := buf.WriteUint8(col.Scale); err != nil {
+			return nil, err
+		}
+	case *tds.BigDateTimeNFieldFmt, *tds.BigTimeNFieldFmt:
+		if err := buf.WriteUint8(col.Scale); err != nil {
+			return nil, err
+		}
+	case *tds.TextFieldFmt, *tds.ImageFieldFmt, *tds.UniTextFieldFmt, *tds.XMLFieldFmt:
+		if err := buf.WriteUint16(uint16(len(col.Table))); err != nil {
+			return nil, err
+		}
+		if err := buf.WriteString(col.Table); err != nil {
+			return nil, err
+		}
+	case *tds.BlobFieldFmt:
+		if err := buf.WriteUint8(uint8(tds.TDS_BLOB_BINARY)); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := fieldFmt.ReadFrom(buf); err != nil {
+		return nil, fmt.Errorf("aseserver: error setting format information for column %q: %w", col.Name, err)
+	}
+
+	return fieldFmt, nil
+}
+
+// isTxtPtr returns true if data of the passed type is prefixed by
+// a text pointer.
+func isTxtPtr(dataType asetypes.DataType) bool {
+	switch dataType {
+	case asetypes.TEXT, asetypes.IMAGE, asetypes.UNITEXT, asetypes.XML:
+		return true
+	}
+	return false
+}
+
+// writeField writes the value for the passed format to ch.
+func writeField(ch tds.BytesChannel, fieldFmt tds.FieldFmt, value interface{}) error {
+	dataType := fieldFmt.DataType()
+
+	if dataType == asetypes.BLOB {
+		fieldData, err := tds.LookupFieldData(fieldFmt)
+		if err != nil {
+			return err
+		}
+
+		bs, err := toBytes(value)
+		if err != nil {
+			return err
+		}
+		fieldData.SetValue(bs)
+
+		_, err = fieldData.WriteTo(ch)
+		return err
+	}
+
+	if isTxtPtr(dataType) {
+		return writeTxtPtrField(ch, dataType, value)
+	}
+
+	if value == nil {
+		if fieldFmt.IsFixedLength() {
+			return fmt.Errorf("aseserver: data type %s does not support NULL", dataType)
+		}
+		return writeLength(ch, fieldFmt.LengthBytes(), 0)
+	}
+
+	bs, err := encodeValue(dataType, fieldFmt.MaxLength(), value)
+	if err != nil {
+		return err
+	}
+
+	if !fieldFmt.IsFixedLength() {
+		if err := writeLength(ch, fieldFmt.LengthBytes(), int64(len(bs))); err != nil {
+			return err
+		}
+	}
+
+	return ch.WriteBytes(bs)
+}
+
+// writeTxtPtrField writes TEXT, IMAGE, UNITEXT and XML data.
+//
+// go-dblib always expects a text pointer and a timestamp, hence NULL
+// values are sent as empty values.
+func writeTxtPtrField(ch tds.BytesChannel, dataType asetypes.DataType, value interface{}) error {
+	var bs []byte
+	if value != nil {
+		var err error
+		if dataType == asetypes.UNITEXT {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("aseserver: expected string for %s, received %T", dataType, value)
+			}
+			bs = encodeUTF16(s)
+		} else {
+			bs, err = toBytes(value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// text pointer
+	if err := ch.WriteUint8(16); err != nil {
+		return err
+	}
+	if err := ch.WriteBytes(make([]byte, 16)); err != nil {
+		return err
+	}
+
+	// timestamp
+	if err := ch.WriteBytes(make([]byte, 8)); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint32(uint32(len(bs))); err != nil {
+		return err
+	}
+
+	return ch.WriteBytes(bs)
+}
+
+// encodeValue returns the byte representation of value for the passed
+// data type.
+func encodeValue(dataType asetypes.DataType, maxLength int64, value interface{}) ([]byte, error) {
+	// Nullable types are encoded as their fixed-length counterparts.
+	switch dataType {
+	case asetypes.INTN:
+		switch maxLength {
+		case 1:
+			dataType = asetypes.INT1
+		case 2:
+			dataType = asetypes.INT2
+		case 4:
+			dataType = asetypes.INT4
+		default:
+			dataType = asetypes.INT8
+		}
+	case asetypes.UINTN:
+		switch maxLength {
+		case 1:
+			dataType = asetypes.INT1
+		case 2:
+			dataType = asetypes.UINT2
+		case 4:
+			dataType = asetypes.UINT4
+		default:
+			dataType = asetypes.UINT8
+		}
+	case asetypes.FLTN:
+		if maxLength == 4 {
+			dataType = asetypes.FLT4
+		} else {
+			dataType = asetypes.FLT8
+		}
+	case asetypes.MONEYN:
+		if maxLength == 4 {
+			dataType = asetypes.SHORTMONEY
+		} else {
+			dataType = asetypes.MONEY
+		}
+	case asetypes.DATETIMEN:
+		if maxLength == 4 {
+			dataType = asetypes.SHORTDATE
+		} else {
+			dataType = asetypes.DATETIME
+		}
+	case asetypes.DATEN:
+		dataType = asetypes.DATE
+	case asetypes.TIMEN:
+		dataType = asetypes.TIME
+	}
+
+	value, err := convertValue(dataType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := dataType.Bytes(endian, value)
+	if err != nil {
+		return nil, fmt.Errorf("aseserver: error encoding %v as %s: %w", value, dataType, err)
+	}
+
+	return bs, nil
+}
+
+// convertValue converts value into the Go type go-dblib uses for the
+// passed data type.
+func convertValue(dataType asetypes.DataType, value interface{}) (interface{}, error) {
+	target := dataType.GoReflectType()
+	if target == nil {
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Type() == target {
+		return value, nil
+	}
+
+	switch target.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return rv.Convert(target).Interface(), nil
+		}
+	case reflect.String:
+		switch typed := value.(type) {
+		case []byte:
+			return string(typed), nil
+		case fmt.Stringer:
+			return typed.String(), nil
+		}
+	case reflect.Slice:
+		if typed, ok := value.(string); ok {
+			return []byte(typed), nil
+		}
+	}
+
+	return nil, fmt.Errorf("aseserver: cannot convert %v (type %T) for %s", value, value, dataType)
+}
+
+func toBytes(value interface{}) ([]byte, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return typed, nil
+	case string:
+		return []byte(typed), nil
+	default:
+		return nil, fmt.Errorf("aseserver: expected string or []byte, received %T", value)
+	}
+}
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	bs := make([]byte, len(u)*2)
+	for i, r := range u {
+		endian.PutUint16(bs[i*2:], r)
+	}
+	return bs
+}
+
+func writeLength(ch tds.BytesChannel, lengthBytes int, length int64) error {
+	switch lengthBytes {
+	case 4:
+		return ch.WriteUint32(uint32(length))
+	case 2:
+		return ch.WriteUint16(uint16(length))
+	default:
+		return ch.WriteUint8(uint8(length))
+	}
+}
@@ -0,0 +1,526 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"runtime/debug"
+	"sync"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// minPacketSize is the packet size used until a packet size has been
+// negotiated during login.
+const minPacketSize = 512
+
+// createProcRe matches the prefix go-ase adds to dynamic statements.
+var createProcRe = regexp.MustCompile(`(?is)^\s*create\s+proc(?:edure)?\s+\S+\s+as\s+(.*)$`)
+
+// message is a complete TDS message received from a client.
+type message struct {
+	typ     tds.PacketHeaderType
+	channel uint16
+	data    []byte
+
+	// attention is true if the client sent an attention.
+	attention bool
+}
+
+// conn is a connection from a client.
+type conn struct {
+	srv     *Server
+	nc      net.Conn
+	session *Session
+
+	packetSize int
+	channel    uint16
+	packet     []byte
+
+	msgs      chan *message
+	readErr   error
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// attnMu guards attnPending and cancel. attnPending is the number
+	// of attentions that have not been acknowledged yet, cancel
+	// cancels the request currently being handled.
+	attnMu      sync.Mutex
+	attnPending int
+	cancel      context.CancelFunc
+
+	// dynamics maps the IDs of prepared statements to their queries.
+	dynamics map[string]string
+}
+
+func newConn(srv *Server, nc net.Conn) *conn {
+	return &conn{
+		srv:        srv,
+		nc:         nc,
+		packetSize: minPacketSize,
+		msgs:       make(chan *message, 1),
+		closing:    make(chan struct{}),
+		dynamics:   map[string]string{},
+	}
+}
+
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.nc.Close()
+		c.srv.trackConn(c, false)
+	})
+}
+
+// serve handles the connection until the client logs out or the
+// connection is closed.
+func (c *conn) serve(ctx context.Context) {
+	defer c.close()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.srv.logf("aseserver: panic serving %s: %v\n%s", c.nc.RemoteAddr(), r, debug.Stack())
+		}
+	}()
+
+	go c.readLoop()
+
+	if err := c.login(ctx); err != nil {
+		c.srv.logf("aseserver: error during login of %s: %v", c.nc.RemoteAddr(), err)
+		return
+	}
+
+	for {
+		msg, err := c.nextMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.srv.logf("aseserver: error reading from %s: %v", c.nc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		switch {
+		case msg.attention:
+			err = c.ackAttention(msg.channel)
+		case msg.typ == tds.TDS_BUF_SETUP:
+			err = c.writeHeaderOnly(tds.TDS_BUF_PROTACK, msg.channel)
+		case msg.typ == tds.TDS_BUF_CLOSE:
+			// go-dblib does not expect a response.
+		default:
+			var logout bool
+			logout, err = c.handleMessage(ctx, msg)
+			if logout {
+				return
+			}
+		}
+
+		if err != nil {
+			c.srv.logf("aseserver: error serving %s: %v", c.nc.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// readLoop reads packets from the client and assembles them into
+// messages.
+//
+// Attentions are processed immediately to allow cancelling the request
+// currently being handled.
+func (c *conn) readLoop() {
+	defer close(c.msgs)
+
+	header := make([]byte, tds.PacketHeaderSize)
+	var data []byte
+
+	for {
+		if _, err := io.ReadFull(c.nc, header); err != nil {
+			c.readErr = err
+			return
+		}
+
+		typ := tds.PacketHeaderType(header[0])
+		status := tds.PacketHeaderStatus(header[1])
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		channel := binary.BigEndian.Uint16(header[4:])
+
+		switch typ {
+		case tds.TDS_BUF_ATTN:
+			c.attention()
+			if !c.enqueue(&message{typ: typ, channel: channel, attention: true}) {
+				return
+			}
+			continue
+		case tds.TDS_BUF_SETUP, tds.TDS_BUF_CLOSE:
+			// Header-only packets. go-dblib sets the length of
+			// TDS_BUF_CLOSE packets to the packet size without
+			// sending data.
+			if !c.enqueue(&message{typ: typ, channel: channel}) {
+				return
+			}
+			continue
+		}
+
+		if length < tds.PacketHeaderSize {
+			c.readErr = fmt.Errorf("invalid packet length %d", length)
+			return
+		}
+
+		body := make([]byte, length-tds.PacketHeaderSize)
+		if _, err := io.ReadFull(c.nc, body); err != nil {
+			c.readErr = err
+			return
+		}
+		data = append(data, body...)
+
+		// The last packet of a message is marked with
+		// TDS_BUFSTAT_EOM, whether it is full or not.
+		if status&tds.TDS_BUFSTAT_EOM != tds.TDS_BUFSTAT_EOM {
+			continue
+		}
+
+		if !c.enqueue(&message{typ: typ, channel: channel, data: data}) {
+			return
+		}
+		data = nil
+	}
+}
+
+func (c *conn) enqueue(msg *message) bool {
+	select {
+	case c.msgs <- msg:
+		return true
+	case <-c.closing:
+		return false
+	}
+}
+
+// nextMessage returns the next message from the client.
+func (c *conn) nextMessage() (*message, error) {
+	msg, ok := <-c.msgs
+	if !ok {
+		if c.readErr == nil {
+			return nil, io.EOF
+		}
+		return nil, c.readErr
+	}
+	return msg, nil
+}
+
+// attention records an attention and cancels the current request.
+func (c *conn) attention() {
+	c.attnMu.Lock()
+	defer c.attnMu.Unlock()
+
+	c.attnPending++
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// ackAttention acknowledges an attention that was received while no
+// request was being handled.
+func (c *conn) ackAttention(channel uint16) error {
+	c.attnMu.Lock()
+	pending := c.attnPending > 0
+	if pending {
+		c.attnPending--
+	}
+	c.attnMu.Unlock()
+
+	if !pending {
+		return nil
+	}
+
+	c.channel = channel
+	buf := newBuffer(nil)
+	if err := (tds.DonePackage{Status: tds.TDS_DONE_ATTN}).WriteTo(buf); err != nil {
+		return err
+	}
+	return c.writeMessage(buf)
+}
+
+// handleMessage handles a request. The returned boolean is true if the
+// client logged out.
+func (c *conn) handleMessage(ctx context.Context, msg *message) (bool, error) {
+	c.channel = msg.channel
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.attnMu.Lock()
+	c.cancel = cancel
+	if c.attnPending > 0 {
+		cancel()
+	}
+	c.attnMu.Unlock()
+
+	w := newResponseWriter(ctx, c)
+
+	pkgs, err := parseTokens(msg.data)
+	if err != nil {
+		w.fail(fmt.Errorf("aseserver: error parsing request: %w", err))
+		pkgs = nil
+	}
+
+	// Like the statements of a batch the commands of a message are
+	// executed independently, a failed command does not prevent the
+	// execution of the following commands.
+	for i := 0; i < len(pkgs) && ctx.Err() == nil; i++ {
+		err = nil
+		switch pkg := pkgs[i].(type) {
+		case *tds.LanguagePackage:
+			req := &LanguageRequest{Query: pkg.Cmd}
+			req.Params, i = paramsAt(pkgs, i)
+			err = c.srv.Handler.HandleLanguage(ctx, w, req)
+		case *tds.DynamicPackage:
+			var params []Param
+			params, i = paramsAt(pkgs, i)
+			err = c.handleDynamic(ctx, w, pkg, params)
+		case *rpcPackage:
+			req := &RPCRequest{Name: pkg.Name, Options: pkg.Options}
+			req.Params, i = paramsAt(pkgs, i)
+			rpcHandler, ok := c.srv.Handler.(RPCHandler)
+			if !ok {
+				err = fmt.Errorf("aseserver: remote procedure calls are not supported")
+				break
+			}
+			err = rpcHandler.HandleRPC(ctx, w, req)
+		case *tds.OptionCmdPackage:
+			switch pkg.Cmd {
+			case tds.TDS_OPT_SET:
+				c.session.Options[pkg.Option] = pkg.OptionArg
+			case tds.TDS_OPT_DEFAULT:
+				delete(c.session.Options, pkg.Option)
+			}
+		case *tds.LogoutPackage:
+			buf := newBuffer(nil)
+			if err := (tds.DonePackage{Status: tds.TDS_DONE_FINAL}).WriteTo(buf); err != nil {
+				return true, err
+			}
+			return true, c.writeMessage(buf)
+		}
+
+		if err != nil {
+			w.fail(err)
+		}
+	}
+
+	c.attnMu.Lock()
+	c.cancel = nil
+	attention := c.attnPending > 0
+	if attention {
+		c.attnPending--
+	}
+	c.attnMu.Unlock()
+
+	return false, w.finish(attention)
+}
+
+// handleDynamic handles dynamic SQL. go-ase expects a TDS_DYN_ACK
+// before any other response, including errors.
+//
+// Responses always use the wide tokens.
+func (c *conn) handleDynamic(ctx context.Context, w *ResponseWriter, pkg *tds.DynamicPackage, params []Param) error {
+	ack := tds.NewDynamicPackage(true)
+	ack.Type = tds.TDS_DYN_ACK
+	ack.ID = pkg.ID
+	if err := w.WritePackage(ack); err != nil {
+		return err
+	}
+
+	dynamicHandler, ok := c.srv.Handler.(DynamicHandler)
+	if !ok {
+		return fmt.Errorf("aseserver: dynamic SQL is not supported")
+	}
+
+	switch {
+	case pkg.Type&tds.TDS_DYN_PREPARE == tds.TDS_DYN_PREPARE:
+		query := pkg.Stmt
+		if match := createProcRe.FindStringSubmatch(query); match != nil {
+			query = match[1]
+		}
+
+		cols, err := dynamicHandler.PrepareDynamic(ctx, c.session, query)
+		if err != nil {
+			return err
+		}
+
+		if len(cols) > 0 {
+			fieldFmts := make([]tds.FieldFmt, len(cols))
+			for i, col := range cols {
+				fieldFmts[i], err = col.fieldFmt()
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := w.WritePackage(tds.NewParamFmtPackage(true, fieldFmts...)); err != nil {
+				return err
+			}
+		}
+
+		c.dynamics[pkg.ID] = query
+		return nil
+	case pkg.Type&tds.TDS_DYN_EXEC == tds.TDS_DYN_EXEC:
+		query, ok := c.dynamics[pkg.ID]
+		if !ok {
+			return &Error{
+				MsgNumber: 3812,
+				Severity:  16,
+				State:     1,
+				Message:   fmt.Sprintf("Dynamic statement %s does not exist.", pkg.ID),
+			}
+		}
+
+		return dynamicHandler.HandleDynamic(ctx, w, &DynamicRequest{ID: pkg.ID, Query: query, Params: params})
+	case pkg.Type&tds.TDS_DYN_DEALLOC == tds.TDS_DYN_DEALLOC:
+		delete(c.dynamics, pkg.ID)
+		if deallocHandler, ok := dynamicHandler.(DynamicDeallocHandler); ok {
+			return deallocHandler.DeallocDynamic(ctx, c.session, pkg.ID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("aseserver: unsupported dynamic operation %s", pkg.Type)
+	}
+}
+
+// paramsAt returns the parameters following the command at index i
+// and the index of the last package belonging to the command.
+func paramsAt(pkgs []tds.Package, i int) ([]Param, int) {
+	if i+2 >= len(pkgs) {
+		return nil, i
+	}
+
+	if _, ok := pkgs[i+1].(*tds.ParamFmtPackage); !ok {
+		return nil, i
+	}
+
+	params, ok := pkgs[i+2].(*tds.ParamsPackage)
+	if !ok {
+		return nil, i
+	}
+
+	ps := make([]Param, len(params.DataFields))
+	for j, field := range params.DataFields {
+		fieldFmt := field.Format()
+		ps[j] = Param{
+			Name:     fieldFmt.Name(),
+			DataType: fieldFmt.DataType(),
+			Output:   fieldFmt.Status()&uint(tds.TDS_PARAM_RETURN) == uint(tds.TDS_PARAM_RETURN),
+			Value:    field.Value(),
+		}
+	}
+
+	return ps, i + 2
+}
+
+// parseTokens parses the token stream of a message.
+func parseTokens(data []byte) ([]tds.Package, error) {
+	buf := newBuffer(data)
+
+	var pkgs []tds.Package
+	var last tds.Package
+	for buf.Len() > 0 {
+		b, err := buf.Byte()
+		if err != nil {
+			return nil, err
+		}
+		token := tds.Token(b)
+
+		var pkg tds.Package
+		switch token {
+		case tds.TDS_DBRPC:
+			pkg = &rpcPackage{}
+		case tds.TDS_DBRPC2:
+			pkg = &rpcPackage{wide: true}
+		case tds.TDS_OPTIONCMD:
+			pkg = &tds.OptionCmdPackage{}
+		case tds.TDS_LANGUAGE, tds.TDS_DYNAMIC, tds.TDS_DYNAMIC2,
+			tds.TDS_PARAMFMT, tds.TDS_PARAMFMT2, tds.TDS_PARAMS,
+			tds.TDS_MSG, tds.TDS_LOGOUT, tds.TDS_CAPABILITY:
+			pkg, err = tds.LookupPackage(token)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported token %s", token)
+		}
+
+		if acceptor, ok := pkg.(tds.LastPkgAcceptor); ok {
+			if err := acceptor.LastPkg(last); err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", token, err)
+			}
+		}
+
+		if err := pkg.ReadFrom(buf); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", token, err)
+		}
+
+		pkgs = append(pkgs, pkg)
+		last = pkg
+	}
+
+	return pkgs, nil
+}
+
+// writeMessage sends the content of buf as a complete message.
+func (c *conn) writeMessage(buf *buffer) error {
+	_, err := c.sendPackets(buf.bs[buf.pos:], true)
+	return err
+}
+
+// sendPackets frames data into packets and sends them to the client.
+//
+// If eom is false only full packets are sent - at least one byte is
+// retained in that case, so the last packet of a message always
+// contains data. The unsent data is returned.
+func (c *conn) sendPackets(data []byte, eom bool) ([]byte, error) {
+	bodySize := c.packetSize - tds.PacketHeaderSize
+
+	for len(data) > bodySize || (eom && len(data) > 0) {
+		n := len(data)
+		if n > bodySize {
+			n = bodySize
+		}
+
+		var status tds.PacketHeaderStatus
+		if eom && n == len(data) {
+			status = tds.TDS_BUFSTAT_EOM
+		}
+
+		// Header and data are written at once as go-dblib reads the
+		// header with a single read.
+		c.packet = append(c.packet[:0], byte(tds.TDS_BUF_RESPONSE), byte(status), 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint16(c.packet[2:], uint16(tds.PacketHeaderSize+n))
+		binary.BigEndian.PutUint16(c.packet[4:], c.channel)
+		c.packet = append(c.packet, data[:n]...)
+
+		if _, err := c.nc.Write(c.packet); err != nil {
+			return data, err
+		}
+
+		data = data[n:]
+	}
+
+	return data, nil
+}
+
+// writeHeaderOnly sends a packet without data.
+func (c *conn) writeHeaderOnly(typ tds.PacketHeaderType, channel uint16) error {
+	header := make([]byte, tds.PacketHeaderSize)
+	header[0] = byte(typ)
+	header[1] = byte(tds.TDS_BUFSTAT_EOM)
+	binary.BigEndian.PutUint16(header[2:], tds.PacketHeaderSize)
+	binary.BigEndian.PutUint16(header[4:], channel)
+
+	_, err := c.nc.Write(header)
+	return err
+}
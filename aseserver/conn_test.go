@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// testPacket returns a packet of type typ with the passed status and
+// data.
+func testPacket(typ tds.PacketHeaderType, status tds.PacketHeaderStatus, data []byte) []byte {
+	packet := make([]byte, tds.PacketHeaderSize, tds.PacketHeaderSize+len(data))
+	packet[0] = byte(typ)
+	packet[1] = byte(status)
+	binary.BigEndian.PutUint16(packet[2:], uint16(tds.PacketHeaderSize+len(data)))
+	return append(packet, data...)
+}
+
+func TestConn_readLoop(t *testing.T) {
+	bodySize := minPacketSize - tds.PacketHeaderSize
+	full := bytes.Repeat([]byte{'a'}, bodySize)
+	partial := []byte("partial")
+
+	cases := map[string]struct {
+		packets [][]byte
+		expect  []*message
+	}{
+		"single packet": {
+			packets: [][]byte{
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, partial),
+			},
+			expect: []*message{
+				{typ: tds.TDS_BUF_NORMAL, data: partial},
+			},
+		},
+		"full packet with eom": {
+			packets: [][]byte{
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, full),
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, partial),
+			},
+			expect: []*message{
+				{typ: tds.TDS_BUF_NORMAL, data: full},
+				{typ: tds.TDS_BUF_NORMAL, data: partial},
+			},
+		},
+		"multiple packets": {
+			packets: [][]byte{
+				testPacket(tds.TDS_BUF_NORMAL, 0, full),
+				testPacket(tds.TDS_BUF_NORMAL, 0, full),
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, partial),
+			},
+			expect: []*message{
+				{typ: tds.TDS_BUF_NORMAL, data: append(append(append([]byte{}, full...), full...), partial...)},
+			},
+		},
+		"multiple full packets": {
+			packets: [][]byte{
+				testPacket(tds.TDS_BUF_NORMAL, 0, full),
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, full),
+			},
+			expect: []*message{
+				{typ: tds.TDS_BUF_NORMAL, data: append(append([]byte{}, full...), full...)},
+			},
+		},
+		"attention": {
+			packets: [][]byte{
+				testPacket(tds.TDS_BUF_NORMAL, 0, full),
+				testPacket(tds.TDS_BUF_ATTN, tds.TDS_BUFSTAT_EOM, nil),
+				testPacket(tds.TDS_BUF_NORMAL, tds.TDS_BUFSTAT_EOM, partial),
+			},
+			expect: []*message{
+				{typ: tds.TDS_BUF_ATTN, attention: true},
+				{typ: tds.TDS_BUF_NORMAL, data: append(append([]byte{}, full...), partial...)},
+			},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				client, server := net.Pipe()
+				defer client.Close()
+
+				c := newConn(&Server{}, server)
+				defer c.close()
+				go c.readLoop()
+
+				go func() {
+					for _, packet := range cas.packets {
+						if _, err := client.Write(packet); err != nil {
+							return
+						}
+					}
+				}()
+
+				for i, expect := range cas.expect {
+					msg, err := c.nextMessage()
+					if err != nil {
+						t.Fatalf("error reading message %d: %v", i, err)
+					}
+
+					if msg.typ != expect.typ || msg.attention != expect.attention || !bytes.Equal(msg.data, expect.data) {
+						t.Errorf("Received message %d does not match expected message:", i)
+						t.Errorf("Expected: type %s, attention %t, %d bytes", expect.typ, expect.attention, len(expect.data))
+						t.Errorf("Received: type %s, attention %t, %d bytes", msg.typ, msg.attention, len(msg.data))
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestConn_sendPackets(t *testing.T) {
+	bodySize := minPacketSize - tds.PacketHeaderSize
+
+	cases := map[string]struct {
+		length     int
+		eom        bool
+		expectSent []int
+		expectRest int
+	}{
+		"partial": {
+			length:     10,
+			eom:        true,
+			expectSent: []int{10},
+		},
+		"exactly one packet": {
+			length:     bodySize,
+			eom:        true,
+			expectSent: []int{bodySize},
+		},
+		"multiple packets": {
+			length:     2*bodySize + 10,
+			eom:        true,
+			expectSent: []int{bodySize, bodySize, 10},
+		},
+		"full packets only": {
+			length:     2*bodySize + 10,
+			expectSent: []int{bodySize, bodySize},
+			expectRest: 10,
+		},
+		"retain last byte": {
+			length:     bodySize,
+			expectRest: bodySize,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				client, server := net.Pipe()
+				defer client.Close()
+
+				c := newConn(&Server{}, server)
+				defer c.close()
+
+				type result struct {
+					rest []byte
+					err  error
+				}
+				done := make(chan result, 1)
+				go func() {
+					rest, err := c.sendPackets(make([]byte, cas.length), cas.eom)
+					server.Close()
+					done <- result{rest, err}
+				}()
+
+				var sent []int
+				var statuses []tds.PacketHeaderStatus
+				header := make([]byte, tds.PacketHeaderSize)
+				for {
+					if _, err := io.ReadFull(client, header); err != nil {
+						break
+					}
+					length := int(binary.BigEndian.Uint16(header[2:])) - tds.PacketHeaderSize
+					if _, err := io.ReadFull(client, make([]byte, length)); err != nil {
+						t.Fatalf("error reading packet body: %v", err)
+					}
+					sent = append(sent, length)
+					statuses = append(statuses, tds.PacketHeaderStatus(header[1]))
+				}
+
+				res := <-done
+				if res.err != nil {
+					t.Fatalf("sendPackets errored: %v", res.err)
+				}
+
+				if len(sent) != len(cas.expectSent) {
+					t.Fatalf("Expected packets of %v bytes, received %v", cas.expectSent, sent)
+				}
+				for i := range sent {
+					if sent[i] != cas.expectSent[i] {
+						t.Errorf("Expected packets of %v bytes, received %v", cas.expectSent, sent)
+					}
+
+					eom := statuses[i]&tds.TDS_BUFSTAT_EOM == tds.TDS_BUFSTAT_EOM
+					if expectEOM := cas.eom && i == len(sent)-1; eom != expectEOM {
+						t.Errorf("Expected EOM of packet %d to be %t, is %t", i, expectEOM, eom)
+					}
+				}
+
+				if len(res.rest) != cas.expectRest {
+					t.Errorf("Expected %d unsent bytes, received %d", cas.expectRest, len(res.rest))
+				}
+			},
+		)
+	}
+}
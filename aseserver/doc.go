@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package aseserver implements the server side of the TDS protocol as
+// spoken by go-ase.
+//
+// It can be used to implement proxies, mock servers for tests or
+// custom services that are accessed through go-ase.
+//
+// A Server accepts connections, handles the login and passes language
+// commands to its Handler. Handlers can optionally implement
+// LoginHandler to authenticate clients, RPCHandler to respond to
+// remote procedure calls and DynamicHandler to support prepared
+// statements.
+//
+// Results are sent through a ResponseWriter:
+//
+//	srv := &aseserver.Server{
+//		Handler: aseserver.HandlerFunc(func(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+//			if err := w.WriteRowFmt(aseserver.Column{Name: "value", DataType: asetypes.INT4}); err != nil {
+//				return err
+//			}
+//			return w.WriteRow(int32(1))
+//		}),
+//	}
+//	log.Fatal(srv.ListenAndServe("127.0.0.1:4901"))
+//
+// If the client sends an attention the context passed to the handler
+// is cancelled, all unsent results are discarded and the attention is
+// acknowledged.
+package aseserver
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ErrServerClosed is returned by Server.Serve and
+// Server.ListenAndServe after Server.Close has been called.
+var ErrServerClosed = errors.New("aseserver: server closed")
+
+// Error is a message sent to the client as TDS_EED.
+//
+// Messages with a severity of 10 or less are informational messages,
+// all others are errors.
+type Error struct {
+	MsgNumber uint32
+	Severity  uint8
+	State     uint8
+	SQLState  string
+	Message   string
+	ProcName  string
+	LineNr    uint16
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("aseserver: Msg %d, Level %d, State %d: %s",
+		e.MsgNumber, e.Severity, e.State, e.Message)
+}
+
+// IsInfo returns true if the message is informational.
+func (e Error) IsInfo() bool {
+	return e.Severity <= 10
+}
+
+// writeTo writes the message as TDS_EED.
+//
+// tds.EEDPackage is not used as it writes an invalid length.
+func (e Error) writeTo(ch tds.BytesChannel, serverName string) error {
+	var status tds.EEDStatus
+	if e.IsInfo() {
+		status = tds.TDS_EED_INFO
+	}
+
+	// msgnumber, state, class, sqlstate length, status, transtate,
+	// msg length, servername length, procname length, linenr
+	length := 4 + 1 + 1 + 1 + len(e.SQLState) + 1 + 2 + 2 + len(e.Message) +
+		1 + len(serverName) + 1 + len(e.ProcName) + 2
+
+	if err := ch.WriteByte(byte(tds.TDS_EED)); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint16(uint16(length)); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint32(e.MsgNumber); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(e.State); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(e.Severity); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(uint8(len(e.SQLState))); err != nil {
+		return err
+	}
+
+	if err := ch.WriteString(e.SQLState); err != nil {
+		return err
+	}
+
+	if err := ch.WriteByte(byte(status)); err != nil {
+		return err
+	}
+
+	// transtate
+	if err := ch.WriteUint16(0); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint16(uint16(len(e.Message))); err != nil {
+		return err
+	}
+
+	if err := ch.WriteString(e.Message); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(uint8(len(serverName))); err != nil {
+		return err
+	}
+
+	if err := ch.WriteString(serverName); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(uint8(len(e.ProcName))); err != nil {
+		return err
+	}
+
+	if err := ch.WriteString(e.ProcName); err != nil {
+		return err
+	}
+
+	return ch.WriteUint16(e.LineNr)
+}
+
+// asError converts err into an *Error.
+func asError(err error) *Error {
+	var aseErr *Error
+	if errors.As(err, &aseErr) {
+		return aseErr
+	}
+
+	var aseErrValue Error
+	if errors.As(err, &aseErrValue) {
+		return &aseErrValue
+	}
+
+	return &Error{
+		Severity: 16,
+		State:    1,
+		Message:  err.Error(),
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"context"
+	"net"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Handler responds to language commands sent by a client.
+//
+// HandleLanguage is called once per language command. Results are
+// sent to the client through the passed ResponseWriter. If an error
+// is returned it is sent to the client as an EED followed by
+// a TDS_DONE with the error status set. Errors of type *Error control
+// the message number, severity and state of the EED.
+//
+// The passed context is cancelled if the client sends an attention,
+// the handler should return as soon as possible in that case.
+type Handler interface {
+	HandleLanguage(ctx context.Context, w *ResponseWriter, req *LanguageRequest) error
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as
+// Handler.
+type HandlerFunc func(ctx context.Context, w *ResponseWriter, req *LanguageRequest) error
+
+// HandleLanguage implements the Handler interface.
+func (fn HandlerFunc) HandleLanguage(ctx context.Context, w *ResponseWriter, req *LanguageRequest) error {
+	return fn(ctx, w, req)
+}
+
+// LoginHandler can be implemented by a Handler to authenticate
+// clients.
+//
+// If HandleLogin returns an error the login is rejected. Without
+// a LoginHandler all logins are accepted.
+type LoginHandler interface {
+	HandleLogin(ctx context.Context, req *LoginRequest) error
+}
+
+// RPCHandler can be implemented by a Handler to respond to remote
+// procedure calls (TDS_DBRPC).
+type RPCHandler interface {
+	HandleRPC(ctx context.Context, w *ResponseWriter, req *RPCRequest) error
+}
+
+// DynamicHandler can be implemented by a Handler to support dynamic
+// SQL (prepared statements).
+//
+// PrepareDynamic is called when a client prepares a statement and
+// returns the formats of the parameters the statement expects.
+// HandleDynamic is called on each execution of the prepared statement.
+type DynamicHandler interface {
+	PrepareDynamic(ctx context.Context, session *Session, query string) ([]Column, error)
+	HandleDynamic(ctx context.Context, w *ResponseWriter, req *DynamicRequest) error
+}
+
+// DynamicDeallocHandler can be implemented by a DynamicHandler to be
+// notified when a client deallocates a prepared statement.
+type DynamicDeallocHandler interface {
+	DeallocDynamic(ctx context.Context, session *Session, id string) error
+}
+
+// Session contains the state of a client connection.
+type Session struct {
+	RemoteAddr net.Addr
+
+	Username string
+	Hostname string
+	AppName  string
+	Language string
+	Charset  string
+	Database string
+
+	PacketSize int
+
+	// Options contains the options set by the client using
+	// TDS_OPTIONCMD.
+	Options map[tds.OptionCmdOption][]byte
+
+	// Data can be used by handlers to store arbitrary per-connection
+	// data.
+	Data interface{}
+}
+
+// LoginRequest contains the information sent by a client during
+// login.
+type LoginRequest struct {
+	Username    string
+	Password    string
+	Hostname    string
+	HostProcess string
+	AppName     string
+	ServerName  string
+	Language    string
+	Charset     string
+	PacketSize  int
+
+	// Encrypted is true if the password was transmitted encrypted.
+	Encrypted bool
+
+	// Session is the session that will be used for the connection.
+	// A LoginHandler may modify it, e.g. to set the initial database.
+	Session *Session
+}
+
+// LanguageRequest is a language command sent by a client.
+type LanguageRequest struct {
+	Query  string
+	Params []Param
+}
+
+// RPCRequest is a remote procedure call sent by a client.
+type RPCRequest struct {
+	Name    string
+	Options uint16
+	Params  []Param
+}
+
+// DynamicRequest is the execution of a prepared statement.
+type DynamicRequest struct {
+	ID     string
+	Query  string
+	Params []Param
+}
+
+// Param is a parameter sent by a client.
+type Param struct {
+	Name     string
+	DataType asetypes.DataType
+	// Output is true if the parameter was marked as return parameter.
+	Output bool
+	Value  interface{}
+}
@@ -0,0 +1,338 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Offsets and lengths of the fields of the login record. String fields
+// are padded to their maximum length and followed by a single byte
+// containing the actual length.
+const (
+	loginRecordLength = 568
+
+	loginHostnameOffset   = 0
+	loginUsernameOffset   = 31
+	loginPasswordOffset   = 62
+	loginHostProcOffset   = 93
+	loginAppNameOffset    = 140
+	loginServNameOffset   = 171
+	loginTDSVersionOffset = 458
+	loginLanguageOffset   = 480
+	loginSecLoginOffset   = 514
+	loginCharsetOffset    = 525
+	loginPacketSizeOffset = 557
+
+	loginMaxName       = 30
+	loginMaxPacketSize = 6
+
+	// loginSecEncrypt is set in the seclogin byte if the client
+	// requests password encryption.
+	loginSecEncrypt byte = 0x01
+
+	loginNonceLength = 32
+)
+
+// parseLoginRecord parses the fixed-length login record.
+func parseLoginRecord(bs []byte) (*LoginRequest, error) {
+	if len(bs) < loginRecordLength {
+		return nil, fmt.Errorf("login record has %d bytes, expected %d", len(bs), loginRecordLength)
+	}
+
+	if bs[loginTDSVersionOffset] != 5 {
+		return nil, fmt.Errorf("unsupported TDS version %v", bs[loginTDSVersionOffset:loginTDSVersionOffset+4])
+	}
+
+	req := &LoginRequest{
+		Hostname:    loginString(bs, loginHostnameOffset, loginMaxName),
+		Username:    loginString(bs, loginUsernameOffset, loginMaxName),
+		Password:    loginString(bs, loginPasswordOffset, loginMaxName),
+		HostProcess: loginString(bs, loginHostProcOffset, loginMaxName),
+		AppName:     loginString(bs, loginAppNameOffset, loginMaxName),
+		ServerName:  loginString(bs, loginServNameOffset, loginMaxName),
+		Language:    loginString(bs, loginLanguageOffset, loginMaxName),
+		Charset:     loginString(bs, loginCharsetOffset, loginMaxName),
+		Encrypted:   bs[loginSecLoginOffset]&loginSecEncrypt == loginSecEncrypt,
+	}
+
+	packetSize := loginString(bs, loginPacketSizeOffset, loginMaxPacketSize)
+	if packetSize != "" {
+		var err error
+		req.PacketSize, err = strconv.Atoi(packetSize)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing packet size %q: %w", packetSize, err)
+		}
+	}
+
+	return req, nil
+}
+
+func loginString(bs []byte, offset, maxLength int) string {
+	length := int(bs[offset+maxLength])
+	if length > maxLength {
+		length = maxLength
+	}
+	return string(bs[offset : offset+length])
+}
+
+// login handles the login of a client.
+func (c *conn) login(ctx context.Context) error {
+	msg, err := c.nextMessage()
+	if err != nil {
+		return err
+	}
+
+	if msg.typ != tds.TDS_BUF_LOGIN {
+		return fmt.Errorf("expected login packet, received %s", msg.typ)
+	}
+	c.channel = msg.channel
+
+	req, err := parseLoginRecord(msg.data)
+	if err != nil {
+		return fmt.Errorf("error parsing login record: %w", err)
+	}
+
+	pkgs, err := parseTokens(msg.data[loginRecordLength:])
+	if err != nil {
+		return fmt.Errorf("error parsing login tokens: %w", err)
+	}
+
+	var caps *tds.CapabilityPackage
+	for _, pkg := range pkgs {
+		if typed, ok := pkg.(*tds.CapabilityPackage); ok {
+			caps = typed
+		}
+	}
+
+	if req.Encrypted {
+		req.Password, err = c.negotiatePassword()
+		if err != nil {
+			return fmt.Errorf("error negotiating password: %w", err)
+		}
+	}
+
+	packetSize := req.PacketSize
+	if c.srv.PacketSize > 0 {
+		packetSize = c.srv.PacketSize
+	}
+	if packetSize < minPacketSize {
+		packetSize = minPacketSize
+	}
+
+	req.Session = &Session{
+		RemoteAddr: c.nc.RemoteAddr(),
+		Username:   req.Username,
+		Hostname:   req.Hostname,
+		AppName:    req.AppName,
+		Language:   req.Language,
+		Charset:    req.Charset,
+		Database:   "master",
+		PacketSize: packetSize,
+		Options:    map[tds.OptionCmdOption][]byte{},
+	}
+
+	if loginHandler, ok := c.srv.Handler.(LoginHandler); ok {
+		if err := loginHandler.HandleLogin(ctx, req); err != nil {
+			if err := c.rejectLogin(err); err != nil {
+				return err
+			}
+			return fmt.Errorf("login of user %q rejected: %w", req.Username, err)
+		}
+	}
+
+	c.session = req.Session
+
+	buf := newBuffer(nil)
+
+	envChanges := []tds.EnvChangePackageField{
+		{Type: tds.TDS_ENV_DB, NewValue: c.session.Database},
+		{Type: tds.TDS_ENV_LANG, NewValue: c.session.Language},
+		{Type: tds.TDS_ENV_CHARSET, NewValue: c.session.Charset},
+		{Type: tds.TDS_ENV_PACKSIZE, NewValue: strconv.Itoa(packetSize), OldValue: strconv.Itoa(req.PacketSize)},
+	}
+	if err := writeEnvChange(buf, envChanges...); err != nil {
+		return err
+	}
+
+	if err := c.loginAck(tds.TDS_LOG_SUCCEED).WriteTo(buf); err != nil {
+		return err
+	}
+
+	// go-dblib expects the capabilities only in response to an
+	// encrypted login.
+	if req.Encrypted && caps != nil {
+		// Encryption of commands is not supported.
+		if err := caps.SetRequestCapability(tds.TDS_REQ_COMMAND_ENCRYPTION, false); err != nil {
+			return err
+		}
+		if err := caps.WriteTo(buf); err != nil {
+			return err
+		}
+	}
+
+	if err := (tds.DonePackage{Status: tds.TDS_DONE_FINAL}).WriteTo(buf); err != nil {
+		return err
+	}
+
+	if err := c.writeMessage(buf); err != nil {
+		return err
+	}
+
+	// Switch to the negotiated packet size after the client has been
+	// informed.
+	c.packetSize = packetSize
+	return nil
+}
+
+func (c *conn) loginAck(status tds.LoginAckStatus) *tds.LoginAckPackage {
+	// The program version is validated in Server.Serve.
+	tdsVersion, _ := tds.NewVersionString("5.0.0.0")
+	programVersion, _ := tds.NewVersionString(c.srv.programVersion())
+	programName := c.srv.programName()
+
+	return &tds.LoginAckPackage{
+		Length:         uint16(10 + len(programName)),
+		Status:         status,
+		Version:        tdsVersion,
+		NameLength:     uint8(len(programName)),
+		ProgramName:    programName,
+		ProgramVersion: programVersion,
+	}
+}
+
+// rejectLogin informs the client that the login failed.
+//
+// The EED is sent before the login acknowledgement as go-dblib only
+// reports messages received before the failed acknowledgement.
+func (c *conn) rejectLogin(reason error) error {
+	aseErr := asError(reason)
+	if aseErr.MsgNumber == 0 {
+		aseErr = &Error{
+			MsgNumber: 4002,
+			Severity:  14,
+			State:     1,
+			Message:   "Login failed.",
+		}
+	}
+
+	buf := newBuffer(nil)
+
+	if err := aseErr.writeTo(buf, c.srv.serverName()); err != nil {
+		return err
+	}
+
+	if err := c.loginAck(tds.TDS_LOG_FAIL).WriteTo(buf); err != nil {
+		return err
+	}
+
+	if err := (tds.DonePackage{Status: tds.TDS_DONE_FINAL}).WriteTo(buf); err != nil {
+		return err
+	}
+
+	return c.writeMessage(buf)
+}
+
+// negotiatePassword sends the public key and nonce to the client and
+// returns the decrypted password.
+func (c *conn) negotiatePassword() (string, error) {
+	key, err := c.srv.loginKey()
+	if err != nil {
+		return "", err
+	}
+
+	pubKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey),
+	})
+
+	nonce := make([]byte, loginNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	buf := newBuffer(nil)
+
+	if err := c.loginAck(tds.TDS_LOG_NEGOTIATE).WriteTo(buf); err != nil {
+		return "", err
+	}
+
+	if err := tds.NewMsgPackage(tds.TDS_MSG_HASARGS, tds.TDS_MSG_SEC_ENCRYPT4).WriteTo(buf); err != nil {
+		return "", err
+	}
+
+	cols := []Column{
+		{DataType: asetypes.INT4},
+		{DataType: asetypes.LONGBINARY, Length: int64(len(pubKey))},
+		{DataType: asetypes.LONGBINARY, Length: loginNonceLength},
+	}
+	if err := writeParams(buf, false, cols, []interface{}{int32(1), pubKey, nonce}); err != nil {
+		return "", err
+	}
+
+	if err := (tds.DonePackage{Status: tds.TDS_DONE_FINAL}).WriteTo(buf); err != nil {
+		return "", err
+	}
+
+	if err := c.writeMessage(buf); err != nil {
+		return "", err
+	}
+
+	msg, err := c.nextMessage()
+	if err != nil {
+		return "", err
+	}
+
+	pkgs, err := parseTokens(msg.data)
+	if err != nil {
+		return "", fmt.Errorf("error parsing password message: %w", err)
+	}
+
+	var msgID tds.TDSMsgId
+	for _, pkg := range pkgs {
+		switch typed := pkg.(type) {
+		case *tds.MsgPackage:
+			msgID = typed.MsgId
+		case *tds.ParamsPackage:
+			if msgID != tds.TDS_MSG_SEC_LOGPWD3 {
+				continue
+			}
+
+			if len(typed.DataFields) != 1 {
+				return "", fmt.Errorf("expected one password parameter, received %d", len(typed.DataFields))
+			}
+
+			encrypted, ok := typed.DataFields[0].Value().([]byte)
+			if !ok {
+				return "", fmt.Errorf("expected password as []byte, received %T", typed.DataFields[0].Value())
+			}
+
+			decrypted, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, encrypted, []byte{})
+			if err != nil {
+				return "", fmt.Errorf("error decrypting password: %w", err)
+			}
+
+			if !bytes.HasPrefix(decrypted, nonce) {
+				return "", errors.New("decrypted password is not prefixed with the nonce")
+			}
+
+			return string(decrypted[len(nonce):]), nil
+		}
+	}
+
+	return "", errors.New("client did not send a password")
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+var _ tds.Package = (*rpcPackage)(nil)
+
+// tdsRPCParams signals that the RPC is followed by parameters.
+const tdsRPCParams uint16 = 0x2
+
+// rpcPackage is the TDS_DBRPC and TDS_DBRPC2 token, which is not
+// implemented by go-dblib.
+type rpcPackage struct {
+	Name    string
+	Options uint16
+
+	wide bool
+}
+
+// ReadFrom implements the tds.Package interface.
+func (pkg *rpcPackage) ReadFrom(ch tds.BytesChannel) error {
+	length, err := ch.Uint16()
+	if err != nil {
+		return tds.ErrNotEnoughBytes
+	}
+
+	nameLength, err := ch.Uint8()
+	if err != nil {
+		return tds.ErrNotEnoughBytes
+	}
+
+	pkg.Name, err = ch.String(int(nameLength))
+	if err != nil {
+		return tds.ErrNotEnoughBytes
+	}
+
+	pkg.Options, err = ch.Uint16()
+	if err != nil {
+		return tds.ErrNotEnoughBytes
+	}
+
+	if n := 1 + int(nameLength) + 2; n != int(length) {
+		return fmt.Errorf("expected to read %d bytes, read %d bytes instead", length, n)
+	}
+
+	return nil
+}
+
+// WriteTo implements the tds.Package interface.
+func (pkg rpcPackage) WriteTo(ch tds.BytesChannel) error {
+	token := tds.TDS_DBRPC
+	if pkg.wide {
+		token = tds.TDS_DBRPC2
+	}
+
+	if err := ch.WriteByte(byte(token)); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint16(uint16(1 + len(pkg.Name) + 2)); err != nil {
+		return err
+	}
+
+	if err := ch.WriteUint8(uint8(len(pkg.Name))); err != nil {
+		return err
+	}
+
+	if err := ch.WriteString(pkg.Name); err != nil {
+		return err
+	}
+
+	return ch.WriteUint16(pkg.Options)
+}
+
+func (pkg rpcPackage) String() string {
+	return fmt.Sprintf("%T(%s, %d)", pkg, pkg.Name, pkg.Options)
+}
@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+const (
+	defaultServerName     = "aseserver"
+	defaultProgramName    = "go-ase/aseserver"
+	defaultProgramVersion = "16.0.0.0"
+
+	// loginKeyBits is the size of the RSA key used to encrypt
+	// passwords during login.
+	loginKeyBits = 2048
+)
+
+// Server accepts TDS connections and passes the requests of clients to
+// a Handler.
+type Server struct {
+	// Handler handles the requests of clients. It may additionally
+	// implement LoginHandler, RPCHandler and DynamicHandler.
+	Handler Handler
+
+	// TLSConfig is used to serve TLS connections if set.
+	TLSConfig *tls.Config
+
+	// ServerName is sent to the client as the origin of messages.
+	ServerName string
+	// ProgramName and ProgramVersion are sent to the client in the
+	// login acknowledgement. ProgramVersion must be of the form
+	// "a.b.c.d".
+	ProgramName    string
+	ProgramVersion string
+
+	// PacketSize overrides the packet size requested by clients.
+	PacketSize int
+
+	// ErrorLog is used to log errors. If nil the standard logger is
+	// used.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+
+	keyOnce sync.Once
+	key     *rsa.PrivateKey
+	keyErr  error
+}
+
+// ListenAndServe listens on the TCP address addr and serves incoming
+// connections.
+func (srv *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("aseserver: error listening on %q: %w", addr, err)
+	}
+
+	return srv.Serve(l)
+}
+
+// Serve accepts connections on l and serves each connection in a new
+// goroutine. If Server.TLSConfig is set connections are served using
+// TLS.
+//
+// Serve always returns a non-nil error and closes l. After Close has
+// been called ErrServerClosed is returned.
+func (srv *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	if srv.Handler == nil {
+		return errors.New("aseserver: server has no handler")
+	}
+
+	if _, err := tds.NewVersionString(srv.programVersion()); err != nil {
+		return fmt.Errorf("aseserver: invalid program version %q: %w", srv.programVersion(), err)
+	}
+
+	if srv.TLSConfig != nil {
+		l = tls.NewListener(l, srv.TLSConfig)
+	}
+
+	ctx, ok := srv.trackListener(l, true)
+	if !ok {
+		return ErrServerClosed
+	}
+	defer srv.trackListener(l, false)
+
+	var delay time.Duration
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				srv.logf("aseserver: error accepting connection: %v; retrying in %s", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+
+			return fmt.Errorf("aseserver: error accepting connection: %w", err)
+		}
+		delay = 0
+
+		c := newConn(srv, nc)
+		if !srv.trackConn(c, true) {
+			nc.Close()
+			return ErrServerClosed
+		}
+
+		go c.serve(ctx)
+	}
+}
+
+// Close closes all listeners and connections.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closed = true
+	if srv.cancel != nil {
+		srv.cancel()
+	}
+
+	var err error
+	for l := range srv.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	for c := range srv.conns {
+		c.nc.Close()
+	}
+
+	return err
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+func (srv *Server) init() {
+	if srv.ctx == nil {
+		srv.ctx, srv.cancel = context.WithCancel(context.Background())
+		srv.listeners = map[net.Listener]struct{}{}
+		srv.conns = map[*conn]struct{}{}
+	}
+}
+
+// trackListener adds or removes a listener. The returned context is
+// cancelled when the server is closed.
+func (srv *Server) trackListener(l net.Listener, add bool) (context.Context, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.init()
+
+	if !add {
+		delete(srv.listeners, l)
+		return nil, true
+	}
+
+	if srv.closed {
+		return nil, false
+	}
+
+	srv.listeners[l] = struct{}{}
+	return srv.ctx, true
+}
+
+func (srv *Server) trackConn(c *conn, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.init()
+
+	if !add {
+		delete(srv.conns, c)
+		return true
+	}
+
+	if srv.closed {
+		return false
+	}
+
+	srv.conns[c] = struct{}{}
+	return true
+}
+
+// loginKey returns the key used to encrypt passwords during login.
+func (srv *Server) loginKey() (*rsa.PrivateKey, error) {
+	srv.keyOnce.Do(func() {
+		srv.key, srv.keyErr = rsa.GenerateKey(rand.Reader, loginKeyBits)
+		if srv.keyErr != nil {
+			srv.keyErr = fmt.Errorf("aseserver: error generating login key: %w", srv.keyErr)
+		}
+	})
+	return srv.key, srv.keyErr
+}
+
+func (srv *Server) serverName() string {
+	if srv.ServerName == "" {
+		return defaultServerName
+	}
+	return srv.ServerName
+}
+
+func (srv *Server) programName() string {
+	if srv.ProgramName == "" {
+		return defaultProgramName
+	}
+	return srv.ProgramName
+}
+
+func (srv *Server) programVersion() string {
+	if srv.ProgramVersion == "" {
+		return defaultProgramVersion
+	}
+	return srv.ProgramVersion
+}
+
+func (srv *Server) logf(format string, args ...interface{}) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,268 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/dsn"
+)
+
+// testHandler responds to the queries used in the tests.
+type testHandler struct {
+	// cancelled receives the error of the context of cancelled
+	// requests.
+	cancelled chan error
+}
+
+func (h *testHandler) HandleLogin(ctx context.Context, req *aseserver.LoginRequest) error {
+	if req.Password != "pass" {
+		return errors.New("wrong password")
+	}
+
+	req.Session.Database = "testdb"
+	return nil
+}
+
+func (h *testHandler) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	switch {
+	case req.Query == "select db_name()":
+		if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.VARCHAR, Length: 30}); err != nil {
+			return err
+		}
+		return w.WriteRow(w.Session().Database)
+	case strings.HasPrefix(req.Query, "select len "):
+		if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.INT4}); err != nil {
+			return err
+		}
+		return w.WriteRow(int32(len(req.Query)))
+	case strings.HasPrefix(req.Query, "select rows "):
+		n, err := strconv.Atoi(strings.TrimPrefix(req.Query, "select rows "))
+		if err != nil {
+			return err
+		}
+
+		if err := w.WriteRowFmt(aseserver.Column{Name: "i", DataType: asetypes.INT4}, aseserver.Column{Name: "s", DataType: asetypes.VARCHAR, Length: 64}); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := w.WriteRow(int32(i), strings.Repeat("x", i%64)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case req.Query == "select endless":
+		if err := w.WriteRowFmt(aseserver.Column{Name: "i", DataType: asetypes.INT4}); err != nil {
+			return err
+		}
+		for i := int32(0); ; i++ {
+			if err := w.WriteRow(i); err != nil {
+				h.cancelled <- ctx.Err()
+				return err
+			}
+		}
+	default:
+		return &aseserver.Error{MsgNumber: 2812, Severity: 16, State: 1, Message: "unknown query"}
+	}
+}
+
+// testServer starts a server with h and returns its address.
+func testServer(t *testing.T, h *testHandler) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &aseserver.Server{Handler: h}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return l.Addr().String()
+}
+
+// testDB returns a database connected to addr with the passed password
+// and properties.
+func testDB(t *testing.T, addr, password, props string) *sql.DB {
+	info, err := dsn.ParseDSN("ase://user:" + password + "@" + addr + "/" + props)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connector, err := ase.NewConnector(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestServer_Login(t *testing.T) {
+	addr := testServer(t, &testHandler{})
+
+	cases := map[string]struct {
+		password  string
+		expectErr string
+	}{
+		"accepted": {
+			password: "pass",
+		},
+		"rejected": {
+			password:  "wrong",
+			expectErr: "Login failed",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				info, err := dsn.ParseDSN("ase://user:" + cas.password + "@" + addr + "/")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				connector, err := ase.NewConnector(info)
+				if cas.expectErr != "" {
+					if err == nil || !strings.Contains(err.Error(), cas.expectErr) {
+						t.Errorf("Expected error containing %q, received: %v", cas.expectErr, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Login failed: %v", err)
+				}
+
+				db := sql.OpenDB(connector)
+				defer db.Close()
+
+				var database string
+				if err := db.QueryRow("select db_name()").Scan(&database); err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+
+				if database != "testdb" {
+					t.Errorf("Expected database set by the login handler, received %q", database)
+				}
+			},
+		)
+	}
+}
+
+func TestServer_Attention(t *testing.T) {
+	h := &testHandler{cancelled: make(chan error, 1)}
+	db := testDB(t, testServer(t, h), "pass", "?close-attention-rows=0")
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.Query("select endless")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows.Next() {
+		t.Fatalf("Expected a row: %v", rows.Err())
+	}
+
+	if err := rows.Close(); err != nil {
+		t.Fatalf("Closing rows failed: %v", err)
+	}
+
+	select {
+	case err := <-h.cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the request to be cancelled, received: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Handler was not cancelled")
+	}
+
+	var n int
+	if err := db.QueryRow("select len 1").Scan(&n); err != nil {
+		t.Fatalf("Query after attention failed: %v", err)
+	}
+}
+
+func TestServer_MultiPacketMessages(t *testing.T) {
+	db := testDB(t, testServer(t, &testHandler{}), "pass", "")
+
+	cases := map[string]int{
+		"short":            10,
+		"one packet":       512,
+		"multiple packets": 5000,
+	}
+
+	for title, length := range cases {
+		t.Run(title+" request",
+			func(t *testing.T) {
+				query := "select len " + strings.Repeat("x", length)
+
+				var n int
+				if err := db.QueryRow(query).Scan(&n); err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+
+				if n != len(query) {
+					t.Errorf("Expected server to receive %d bytes, received %d", len(query), n)
+				}
+			},
+		)
+
+		t.Run(title+" response",
+			func(t *testing.T) {
+				rows, err := db.Query("select rows " + strconv.Itoa(length))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rows.Close()
+
+				received := 0
+				for rows.Next() {
+					var i int
+					var s string
+					if err := rows.Scan(&i, &s); err != nil {
+						t.Fatal(err)
+					}
+
+					if i != received || len(s) != i%64 {
+						t.Fatalf("Received unexpected row %d: %d, %q", received, i, s)
+					}
+					received++
+				}
+
+				if err := rows.Err(); err != nil {
+					t.Fatal(err)
+				}
+
+				if received != length {
+					t.Errorf("Expected %d rows, received %d", length, received)
+				}
+			},
+		)
+	}
+}
+
+func TestServer_Error(t *testing.T) {
+	db := testDB(t, testServer(t, &testHandler{}), "pass", "")
+
+	_, err := db.Exec("unknown")
+	if err == nil || !strings.Contains(err.Error(), "unknown query") {
+		t.Errorf("Expected error of handler, received: %v", err)
+	}
+
+	var n int
+	if err := db.QueryRow("select len 1").Scan(&n); err != nil {
+		t.Fatalf("Query after error failed: %v", err)
+	}
+}
@@ -0,0 +1,414 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package aseserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ResponseWriter is used by handlers to send results to the client.
+//
+// Results are streamed to the client as soon as a packet is filled.
+// The TDS_DONE_MORE status of TDS_DONE tokens is managed by the
+// ResponseWriter, handlers only pass the status describing the result
+// itself (e.g. tds.TDS_DONE_COUNT).
+//
+// If a handler returns without writing a TDS_DONE the response is
+// terminated with a TDS_DONE_COUNT if a result set was written or
+// a TDS_DONE_FINAL otherwise.
+type ResponseWriter struct {
+	conn *conn
+	ctx  context.Context
+	buf  *buffer
+
+	// pending is the last written TDS_DONE. It is only written when
+	// it is known whether more tokens follow.
+	pending *tds.DonePackage
+
+	rowFmt   []tds.FieldFmt
+	inResult bool
+	rows     int32
+
+	// err is set if writing to the connection failed.
+	err error
+}
+
+func newResponseWriter(ctx context.Context, c *conn) *ResponseWriter {
+	return &ResponseWriter{
+		conn: c,
+		ctx:  ctx,
+		buf:  newBuffer(nil),
+	}
+}
+
+// Session returns the session of the connection.
+func (w *ResponseWriter) Session() *Session {
+	return w.conn.session
+}
+
+// WriteRowFmt starts a new result set with the passed columns.
+func (w *ResponseWriter) WriteRowFmt(cols ...Column) error {
+	fieldFmts := make([]tds.FieldFmt, len(cols))
+	for i, col := range cols {
+		var err error
+		fieldFmts[i], err = col.fieldFmt()
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.write(func(ch tds.BytesChannel) error {
+		// A new result set terminates the previous one.
+		if w.inResult && w.pending == nil {
+			done := tds.DonePackage{Status: tds.TDS_DONE_COUNT | tds.TDS_DONE_MORE, Count: w.rows}
+			if err := done.WriteTo(ch); err != nil {
+				return err
+			}
+		}
+
+		// go-dblib only supports reading TDS_ROWFMT2.
+		fmtBuf := newBuffer(nil)
+		if err := fmtBuf.WriteUint16(uint16(len(cols))); err != nil {
+			return err
+		}
+
+		paramFmt := tds.NewParamFmtPackage(true)
+		for i, col := range cols {
+			// label, catalogue, schema, table
+			for _, s := range []string{col.Name, "", "", col.Table} {
+				if err := fmtBuf.WriteUint8(uint8(len(s))); err != nil {
+					return err
+				}
+				if err := fmtBuf.WriteString(s); err != nil {
+					return err
+				}
+			}
+
+			// The remainder of the column format is identical to the
+			// format of wide parameters.
+			if _, err := paramFmt.WriteToField(fmtBuf, fieldFmts[i]); err != nil {
+				return fmt.Errorf("aseserver: error writing format of column %q: %w", col.Name, err)
+			}
+		}
+
+		if err := ch.WriteByte(byte(tds.TDS_ROWFMT2)); err != nil {
+			return err
+		}
+		if err := ch.WriteUint32(uint32(fmtBuf.Len())); err != nil {
+			return err
+		}
+		if err := ch.WriteBytes(fmtBuf.bs); err != nil {
+			return err
+		}
+
+		w.rowFmt = fieldFmts
+		w.inResult = true
+		w.rows = 0
+		return nil
+	})
+}
+
+// WriteRow writes a row of the current result set.
+//
+// The values must be convertible to the Go types go-dblib uses for the
+// data types of the columns. nil is sent as NULL.
+func (w *ResponseWriter) WriteRow(values ...interface{}) error {
+	if w.rowFmt == nil {
+		return fmt.Errorf("aseserver: WriteRow called without WriteRowFmt")
+	}
+
+	if len(values) != len(w.rowFmt) {
+		return fmt.Errorf("aseserver: received %d values for %d columns", len(values), len(w.rowFmt))
+	}
+
+	return w.write(func(ch tds.BytesChannel) error {
+		if err := ch.WriteByte(byte(tds.TDS_ROW)); err != nil {
+			return err
+		}
+
+		for i, value := range values {
+			if err := writeField(ch, w.rowFmt[i], value); err != nil {
+				return fmt.Errorf("aseserver: error writing column %q: %w", w.rowFmt[i].Name(), err)
+			}
+		}
+
+		w.rows++
+		return nil
+	})
+}
+
+// WriteParams writes return parameters.
+func (w *ResponseWriter) WriteParams(cols []Column, values ...interface{}) error {
+	return w.write(func(ch tds.BytesChannel) error {
+		return writeParams(ch, true, cols, values)
+	})
+}
+
+// WriteDone terminates a result or a command with the passed status
+// and count.
+func (w *ResponseWriter) WriteDone(status tds.DoneState, count int32) error {
+	if err := w.write(nil); err != nil {
+		return err
+	}
+
+	w.pending = &tds.DonePackage{Status: status &^ tds.TDS_DONE_MORE, Count: count}
+	w.inResult = false
+	w.rowFmt = nil
+	return nil
+}
+
+// WriteMessage sends an informational or error message to the client.
+func (w *ResponseWriter) WriteMessage(msg *Error) error {
+	return w.write(func(ch tds.BytesChannel) error {
+		return msg.writeTo(ch, w.conn.srv.serverName())
+	})
+}
+
+// WriteReturnStatus writes the return status of a stored procedure.
+//
+// go-ase only reports a non-zero return status as error if the
+// strict-return-status property is set.
+func (w *ResponseWriter) WriteReturnStatus(status int32) error {
+	return w.write(func(ch tds.BytesChannel) error {
+		if err := ch.WriteByte(byte(tds.TDS_RETURNSTATUS)); err != nil {
+			return err
+		}
+		return tds.ReturnStatusPackage{ReturnValue: status}.WriteTo(ch)
+	})
+}
+
+// WriteOrderBy writes the one-based numbers of the columns the current
+// result set is ordered by. It must directly follow WriteRowFmt.
+func (w *ResponseWriter) WriteOrderBy(columns ...int) error {
+	return w.write(func(ch tds.BytesChannel) error {
+		// go-dblib does not implement writing order packages.
+		wide := false
+		for _, column := range columns {
+			if column > 255 {
+				wide = true
+			}
+		}
+
+		if !wide {
+			if err := ch.WriteByte(byte(tds.TDS_ORDERBY)); err != nil {
+				return err
+			}
+			if err := ch.WriteUint16(uint16(len(columns))); err != nil {
+				return err
+			}
+			for _, column := range columns {
+				if err := ch.WriteUint8(uint8(column)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if err := ch.WriteByte(byte(tds.TDS_ORDERBY2)); err != nil {
+			return err
+		}
+		if err := ch.WriteUint32(uint32(2 + 2*len(columns))); err != nil {
+			return err
+		}
+		if err := ch.WriteUint16(uint16(len(columns))); err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if err := ch.WriteUint16(uint16(column)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteEnvChange notifies the client of a changed environment
+// variable. Changes to the database, language and charset are
+// recorded in the session.
+func (w *ResponseWriter) WriteEnvChange(typ tds.EnvChangeType, newValue, oldValue string) error {
+	err := w.write(func(ch tds.BytesChannel) error {
+		return writeEnvChange(ch, tds.EnvChangePackageField{Type: typ, NewValue: newValue, OldValue: oldValue})
+	})
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case tds.TDS_ENV_DB:
+		w.conn.session.Database = newValue
+	case tds.TDS_ENV_LANG:
+		w.conn.session.Language = newValue
+	case tds.TDS_ENV_CHARSET:
+		w.conn.session.Charset = newValue
+	}
+
+	return nil
+}
+
+// WritePackage writes an arbitrary package.
+func (w *ResponseWriter) WritePackage(pkg tds.Package) error {
+	return w.write(pkg.WriteTo)
+}
+
+// write writes the pending TDS_DONE followed by the tokens written by
+// fn and sends all full packets.
+func (w *ResponseWriter) write(fn func(tds.BytesChannel) error) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		return fmt.Errorf("aseserver: request cancelled: %w", err)
+	}
+
+	if w.pending != nil {
+		w.pending.Status |= tds.TDS_DONE_MORE
+		if err := w.pending.WriteTo(w.buf); err != nil {
+			return err
+		}
+		w.pending = nil
+	}
+
+	if fn == nil {
+		return nil
+	}
+
+	// Partially written tokens are discarded on error.
+	n := len(w.buf.bs)
+	if err := fn(w.buf); err != nil {
+		w.buf.bs = w.buf.bs[:n]
+		return err
+	}
+
+	return w.flush(false)
+}
+
+func (w *ResponseWriter) flush(eom bool) error {
+	rest, err := w.conn.sendPackets(w.buf.bs, eom)
+	if err != nil {
+		w.err = fmt.Errorf("aseserver: error writing response: %w", err)
+		return w.err
+	}
+
+	n := copy(w.buf.bs, rest)
+	w.buf.bs = w.buf.bs[:n]
+	return nil
+}
+
+// fail sends err to the client as EED followed by a TDS_DONE with the
+// error status.
+func (w *ResponseWriter) fail(err error) {
+	if w.err != nil || w.ctx.Err() != nil {
+		return
+	}
+
+	if err := w.WriteMessage(asError(err)); err != nil {
+		return
+	}
+
+	w.WriteDone(tds.TDS_DONE_ERROR, 0)
+}
+
+// finish terminates the response. If attention is true the client
+// requested to cancel the request and all unsent data is discarded.
+func (w *ResponseWriter) finish(attention bool) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if attention {
+		// The buffer holds the remainder of the last token sent
+		// partially, it is sent to keep the token stream intact.
+		if w.pending != nil {
+			w.pending.Status |= tds.TDS_DONE_MORE
+			if err := w.pending.WriteTo(w.buf); err != nil {
+				return err
+			}
+		}
+		if err := (tds.DonePackage{Status: tds.TDS_DONE_ATTN}).WriteTo(w.buf); err != nil {
+			return err
+		}
+		return w.flush(true)
+	}
+
+	done := w.pending
+	switch {
+	case done == nil && w.inResult:
+		done = &tds.DonePackage{Status: tds.TDS_DONE_COUNT, Count: w.rows}
+	case done == nil:
+		done = &tds.DonePackage{Status: tds.TDS_DONE_FINAL}
+	}
+
+	// Like ASE the last TDS_DONE terminates the response, even after
+	// an error. go-dblib terminates responses ending with another
+	// status with a TDS_DONE_FINAL itself.
+	if err := done.WriteTo(w.buf); err != nil {
+		return err
+	}
+
+	return w.flush(true)
+}
+
+// writeParams writes a TDS_PARAMFMT or TDS_PARAMFMT2 followed by
+// TDS_PARAMS.
+func writeParams(ch tds.BytesChannel, wide bool, cols []Column, values []interface{}) error {
+	if len(values) != len(cols) {
+		return fmt.Errorf("aseserver: received %d values for %d parameters", len(values), len(cols))
+	}
+
+	fieldFmts := make([]tds.FieldFmt, len(cols))
+	for i, col := range cols {
+		var err error
+		fieldFmts[i], err = col.fieldFmt()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tds.NewParamFmtPackage(wide, fieldFmts...).WriteTo(ch); err != nil {
+		return err
+	}
+
+	if err := ch.WriteByte(byte(tds.TDS_PARAMS)); err != nil {
+		return err
+	}
+
+	for i, value := range values {
+		if err := writeField(ch, fieldFmts[i], value); err != nil {
+			return fmt.Errorf("aseserver: error writing parameter %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// writeEnvChange writes a TDS_ENVCHANGE. The members of
+// tds.EnvChangePackage are not exported, hence the token is written
+// manually.
+func writeEnvChange(ch tds.BytesChannel, fields ...tds.EnvChangePackageField) error {
+	if err := ch.WriteByte(byte(tds.TDS_ENVCHANGE)); err != nil {
+		return err
+	}
+
+	length := 0
+	for _, field := range fields {
+		length += field.ByteLength()
+	}
+
+	if err := ch.WriteUint16(uint16(length)); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if _, err := field.WriteTo(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// attentionPackage queues the empty packet of an attention.
+//
+// go-dblib does not support sending header-only packets. The packet is
+// added to the send queue directly, the channel sends a packet without
+// data as header-only packet.
+type attentionPackage struct {
+	packetSize int
+}
+
+func (pkg attentionPackage) ReadFrom(ch tds.BytesChannel) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (pkg attentionPackage) WriteTo(ch tds.BytesChannel) error {
+	queue, ok := ch.(*tds.PacketQueue)
+	if !ok {
+		return fmt.Errorf("cannot queue attention in %T", ch)
+	}
+
+	packet := tds.NewPacket(pkg.packetSize)
+	queue.AddPacket(packet)
+	return nil
+}
+
+func (pkg attentionPackage) String() string {
+	return fmt.Sprintf("%T", pkg)
+}
+
+// sendAttention asks the server to cancel the current command.
+//
+// The server acknowledges the attention with a TDS_DONE_ATTN, the
+// response up to the acknowledgement must be discarded.
+func (c *Conn) sendAttention(ctx context.Context) error {
+	// The channel resets the header type after sending.
+	c.Channel.CurrentHeaderType = tds.TDS_BUF_ATTN
+	if err := c.Channel.SendPackage(ctx, attentionPackage{packetSize: c.Conn.PacketSize()}); err != nil {
+		c.Channel.Reset()
+		return fmt.Errorf("go-ase: error sending attention: %w", err)
+	}
+
+	return nil
+}
+
+// discardUntilAttentionAck discards the response until the server
+// acknowledged an attention.
+func (c *Conn) discardUntilAttentionAck(ctx context.Context) error {
+	for {
+		pkg, err := c.Channel.NextPackage(ctx, true)
+		if err != nil {
+			return fmt.Errorf("go-ase: error waiting for acknowledgement of attention: %w", err)
+		}
+
+		switch typed := pkg.(type) {
+		case *tds.MsgPackage:
+			c.handleMsgPackage(typed)
+		case *tds.DonePackage:
+			c.trackTransaction(typed)
+			if typed.Status&tds.TDS_DONE_ATTN != tds.TDS_DONE_ATTN {
+				continue
+			}
+
+			// The acknowledgement is the last token of its message,
+			// the channel terminates it with a TDS_DONE_FINAL.
+			pkg, err := c.Channel.NextPackage(ctx, true)
+			if err != nil {
+				return fmt.Errorf("go-ase: error reading end of acknowledgement of attention: %w", err)
+			}
+			done, ok := pkg.(*tds.DonePackage)
+			if !ok || done.Status != tds.TDS_DONE_FINAL {
+				return fmt.Errorf("go-ase: unexpected package %v after acknowledgement of attention", pkg)
+			}
+			c.trackTransaction(done)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// defaultBatchMessageRows is the number of rows ExecBatch sends in
+// a message if BatchOptions.MessageRows is not set.
+const defaultBatchMessageRows = 128
+
+// BatchOptions control the execution of ExecBatch.
+type BatchOptions struct {
+	// ContinueOnError executes all rows. By default no further
+	// messages are sent after a row failed.
+	ContinueOnError bool
+	// MessageRows is the number of rows sent in a single message.
+	// All rows of a message are executed, even after a row of the
+	// message failed. Defaults to 128.
+	MessageRows int
+}
+
+// BatchResult is the result of a row of arguments executed by
+// ExecBatch.
+type BatchResult struct {
+	// RowsAffected is the number of rows affected by the execution.
+	RowsAffected int64
+	// ReturnStatus is the return status of the execution.
+	ReturnStatus int32
+	// Err is the error of the execution. Errors reported by the
+	// server are of type *tds.EEDError.
+	Err error
+}
+
+// errRowNotExecuted is the error of rows the server did not respond to.
+var errRowNotExecuted = errors.New("go-ase: row was not executed")
+
+// ExecBatch executes the statement once per row of args.
+//
+// The executions of multiple rows are sent in a single message and
+// their responses are read afterwards. Results of queries are
+// discarded.
+//
+// The returned results correspond to the rows of args. The error is
+// non-nil if any row failed. Unless opts.ContinueOnError is set no
+// further rows are sent after a row failed, rows that were already
+// sent are executed and included in the results. Rows whose arguments
+// cannot be converted are not sent.
+//
+// The statement is not sent again after a reconnect.
+func (stmt *Stmt) ExecBatch(ctx context.Context, args [][]driver.NamedValue, opts BatchOptions) ([]BatchResult, error) {
+	if err := stmt.conn.ensureValid(ctx); err != nil {
+		return nil, err
+	}
+
+	messageRows := opts.MessageRows
+	if messageRows <= 0 {
+		messageRows = defaultBatchMessageRows
+	}
+
+	results := make([]BatchResult, 0, len(args))
+	failed := 0
+
+	for start := 0; start < len(args); start += messageRows {
+		end := start + messageRows
+		if end > len(args) {
+			end = len(args)
+		}
+
+		chunk, err := stmt.execBatchMessage(ctx, args[start:end], opts.ContinueOnError)
+		if err != nil {
+			return append(results, chunk...), fmt.Errorf("go-ase: error executing rows %d to %d: %w", start, end-1, err)
+		}
+
+		stop := false
+		for _, result := range chunk {
+			if result.Err != nil {
+				failed++
+				stop = !opts.ContinueOnError
+			}
+		}
+
+		results = append(results, chunk...)
+		if stop {
+			break
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("go-ase: %d of %d rows failed", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// execBatchMessage sends the executions of rows in a single message
+// and reads their results.
+//
+// If an error is returned the connection cannot be used anymore and
+// the results of the rows that were read completely are returned.
+func (stmt *Stmt) execBatchMessage(ctx context.Context, rows [][]driver.NamedValue, continueOnError bool) ([]BatchResult, error) {
+	// Results of the rows, rows that could not be sent already carry
+	// their error.
+	results := make([]BatchResult, len(rows))
+	// sent are the indices of the rows that were sent.
+	sent := make([]int, 0, len(rows))
+
+	for i := range rows {
+		paramFmt, dataFields, err := stmt.batchParams(rows[i])
+		if err != nil {
+			results[i].Err = err
+			if !continueOnError {
+				results = results[:i+1]
+				break
+			}
+			continue
+		}
+
+		if err := stmt.queueExec(ctx, paramFmt, dataFields); err != nil {
+			return nil, stmt.batchFailed(fmt.Errorf("error queueing row: %w", err))
+		}
+		sent = append(sent, i)
+	}
+
+	if len(sent) == 0 {
+		return results, nil
+	}
+
+	if err := stmt.conn.Channel.SendRemainingPackets(ctx); err != nil {
+		return nil, stmt.batchFailed(fmt.Errorf("error sending rows: %w", err))
+	}
+
+	read, err := stmt.recvBatch(ctx, results, sent)
+	if err != nil {
+		complete := len(results)
+		if read < 0 {
+			read = 0
+		}
+		if read < len(sent) {
+			complete = sent[read]
+		}
+		return results[:complete], stmt.batchFailed(err)
+	}
+
+	return results, nil
+}
+
+// batchFailed marks the connection as unusable, the state of the
+// message and its responses is unknown.
+func (stmt *Stmt) batchFailed(err error) error {
+	stmt.conn.checkConnErr(err)
+	if stmt.conn.health != nil {
+		stmt.conn.health.markBad(err)
+	}
+	return err
+}
+
+// batchParams checks a row of arguments and returns the parameters to
+// send.
+func (stmt *Stmt) batchParams(args []driver.NamedValue) (*tds.ParamFmtPackage, []tds.FieldData, error) {
+	checked := make([]driver.NamedValue, len(args))
+	copy(checked, args)
+
+	for i := range checked {
+		if err := stmt.CheckNamedValue(&checked[i]); err != nil {
+			return nil, nil, fmt.Errorf("go-ase: error checking argument: %w", err)
+		}
+	}
+
+	bound, err := stmt.query.bind(checked)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paramFmt, dataFields, err := stmt.buildParams(bound)
+	if err != nil {
+		return nil, nil, fmt.Errorf("go-ase: %w", err)
+	}
+
+	return paramFmt, dataFields, nil
+}
+
+// recvBatch reads the response to a message with the executions of the
+// rows sent into results. The response of each execution starts with
+// an acknowledgement.
+//
+// The returned number is the number of rows whose results were read
+// completely. Rows the server did not respond to fail with
+// errRowNotExecuted.
+func (stmt *Stmt) recvBatch(ctx context.Context, results []BatchResult, sent []int) (int, error) {
+	// row is the index in sent of the row whose response is read.
+	row := -1
+	var eedError *tds.EEDError
+	var returnStatus int32
+	var doneErr error
+
+	finishRow := func() {
+		if row < 0 {
+			return
+		}
+
+		result := &results[sent[row]]
+		result.ReturnStatus = returnStatus
+		result.Err = doneErr
+		if result.Err == nil {
+			result.Err = stmt.conn.checkReturnStatus(returnStatus)
+		}
+
+		if result.Err != nil && eedError != nil {
+			eedError.WrappedError = result.Err
+			result.Err = eedError
+		}
+	}
+
+	for {
+		pkg, err := stmt.conn.Channel.NextPackage(ctx, true)
+		if err != nil {
+			return row, err
+		}
+
+		switch typed := pkg.(type) {
+		case *tds.DynamicPackage:
+			finishRow()
+			row++
+			if row >= len(sent) {
+				return row, fmt.Errorf("received more acknowledgements than %d sent rows", len(sent))
+			}
+			eedError, returnStatus, doneErr = nil, 0, nil
+		case *tds.EEDPackage:
+			if eedError == nil {
+				eedError = &tds.EEDError{}
+			}
+			eedError.Add(typed)
+		case *tds.MsgPackage:
+			stmt.conn.handleMsgPackage(typed)
+		case *tds.ReturnStatusPackage:
+			returnStatus = typed.ReturnValue
+		case *tds.DonePackage:
+			stmt.conn.trackTransaction(typed)
+			if row >= 0 && typed.Status&tds.TDS_DONE_COUNT == tds.TDS_DONE_COUNT {
+				results[sent[row]].RowsAffected = int64(typed.Count)
+			}
+
+			if typed.Status&tds.TDS_DONE_ERROR == tds.TDS_DONE_ERROR && doneErr == nil {
+				doneErr = fmt.Errorf("go-ase: query failed with errors")
+			}
+
+			// The channel terminates each response with a
+			// TDS_DONE_FINAL, even if the server does not send one.
+			if typed.Status != tds.TDS_DONE_FINAL {
+				continue
+			}
+
+			finishRow()
+
+			// The server stopped executing the message.
+			notExecuted := errRowNotExecuted
+			if row < 0 && eedError != nil {
+				eedError.WrappedError = notExecuted
+				notExecuted = eedError
+			}
+			for _, i := range sent[row+1:] {
+				results[i].Err = notExecuted
+			}
+
+			return len(sent), nil
+		default:
+			// Results of queries are discarded.
+		}
+	}
+}
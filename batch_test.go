@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// batchServer records the executed values and fails executions with
+// negative values.
+type batchServer struct {
+	sync.Mutex
+	executed []interface{}
+}
+
+func (srv *batchServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	return nil
+}
+
+func (srv *batchServer) PrepareDynamic(ctx context.Context, session *aseserver.Session, query string) ([]aseserver.Column, error) {
+	return []aseserver.Column{{DataType: asetypes.INT4}}, nil
+}
+
+func (srv *batchServer) HandleDynamic(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.DynamicRequest) error {
+	value := req.Params[0].Value
+
+	srv.Lock()
+	srv.executed = append(srv.executed, value)
+	srv.Unlock()
+
+	if value.(int32) < 0 {
+		return fmt.Errorf("negative value %d", value)
+	}
+
+	return w.WriteDone(tds.TDS_DONE_COUNT, 1)
+}
+
+func TestStmt_ExecBatch(t *testing.T) {
+	cases := map[string]struct {
+		values         []interface{}
+		opts           ase.BatchOptions
+		expectExecuted []interface{}
+		expectResults  int
+		expectFailed   []int
+	}{
+		"no errors": {
+			values:         []interface{}{1, 2, 3, 4, 5},
+			opts:           ase.BatchOptions{MessageRows: 2},
+			expectExecuted: []interface{}{int32(1), int32(2), int32(3), int32(4), int32(5)},
+			expectResults:  5,
+		},
+		"default message rows": {
+			values:         []interface{}{1, 2, 3},
+			expectExecuted: []interface{}{int32(1), int32(2), int32(3)},
+			expectResults:  3,
+		},
+		"stop after failed message": {
+			values:         []interface{}{1, 2, -3, 4, 5},
+			opts:           ase.BatchOptions{MessageRows: 2},
+			expectExecuted: []interface{}{int32(1), int32(2), int32(-3), int32(4)},
+			expectResults:  4,
+			expectFailed:   []int{2},
+		},
+		"error mid-message": {
+			values:         []interface{}{1, -2, 3, 4},
+			opts:           ase.BatchOptions{MessageRows: 3},
+			expectExecuted: []interface{}{int32(1), int32(-2), int32(3)},
+			expectResults:  3,
+			expectFailed:   []int{1},
+		},
+		"continue on error": {
+			values:         []interface{}{1, -2, 3, -4, 5},
+			opts:           ase.BatchOptions{MessageRows: 2, ContinueOnError: true},
+			expectExecuted: []interface{}{int32(1), int32(-2), int32(3), int32(-4), int32(5)},
+			expectResults:  5,
+			expectFailed:   []int{1, 3},
+		},
+		"conversion error": {
+			values:         []interface{}{1, struct{}{}, 3},
+			opts:           ase.BatchOptions{MessageRows: 3},
+			expectExecuted: []interface{}{int32(1)},
+			expectResults:  2,
+			expectFailed:   []int{1},
+		},
+		"conversion error continue": {
+			values:         []interface{}{1, struct{}{}, 3},
+			opts:           ase.BatchOptions{MessageRows: 3, ContinueOnError: true},
+			expectExecuted: []interface{}{int32(1), int32(3)},
+			expectResults:  3,
+			expectFailed:   []int{1},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &batchServer{}
+				db := fakeDB(t, srv)
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				args := make([][]driver.NamedValue, len(cas.values))
+				for i, value := range cas.values {
+					args[i] = []driver.NamedValue{{Ordinal: 1, Value: value}}
+				}
+
+				var results []ase.BatchResult
+				err = conn.Raw(func(driverConn interface{}) error {
+					stmt, err := driverConn.(*ase.Conn).NewStmt(ctx, "", "insert into t values (?)", true)
+					if err != nil {
+						return err
+					}
+					defer stmt.Close()
+
+					results, err = stmt.ExecBatch(ctx, args, cas.opts)
+					return err
+				})
+
+				if (len(cas.expectFailed) > 0) != (err != nil) {
+					t.Errorf("Expected failed rows %v, received error %v", cas.expectFailed, err)
+				}
+
+				if len(results) != cas.expectResults {
+					t.Fatalf("Expected %d results, received %d: %v", cas.expectResults, len(results), results)
+				}
+
+				failed := []int{}
+				for i, result := range results {
+					if result.Err != nil {
+						failed = append(failed, i)
+						continue
+					}
+					if result.RowsAffected != 1 {
+						t.Errorf("Row %d: expected 1 affected row, received %d", i, result.RowsAffected)
+					}
+				}
+				if len(failed) != len(cas.expectFailed) || (len(failed) > 0 && !reflect.DeepEqual(failed, cas.expectFailed)) {
+					t.Errorf("Expected failed rows %v, received %v", cas.expectFailed, failed)
+				}
+
+				for _, i := range failed {
+					var eedErr *tds.EEDError
+					if v, ok := cas.values[i].(int); ok && v < 0 && !errors.As(results[i].Err, &eedErr) {
+						t.Errorf("Row %d: expected a server error, received %v", i, results[i].Err)
+					}
+				}
+
+				srv.Lock()
+				executed := srv.executed
+				srv.Unlock()
+				if !reflect.DeepEqual(executed, cas.expectExecuted) {
+					t.Errorf("Expected executed values %v, received %v", cas.expectExecuted, executed)
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// charset converts between the character set of a session and UTF-8.
+type charset interface {
+	decode(bs []byte) (string, error)
+	encode(s string) ([]byte, error)
+}
+
+// charsets maps the names of ASE character sets to their conversion.
+// A nil charset does not require conversion.
+var charsets = map[string]charset{
+	"utf8": nil,
+	// ascii_8 passes all bytes through, they are interpreted as
+	// ISO 8859-1 like jConnect does.
+	"ascii_8":  textCharset{charmap.ISO8859_1},
+	"iso_1":    textCharset{charmap.ISO8859_1},
+	"iso88592": textCharset{charmap.ISO8859_2},
+	"iso88595": textCharset{charmap.ISO8859_5},
+	"iso88597": textCharset{charmap.ISO8859_7},
+	"iso88599": textCharset{charmap.ISO8859_9},
+	"iso15":    textCharset{charmap.ISO8859_15},
+	"cp437":    textCharset{charmap.CodePage437},
+	"cp850":    textCharset{charmap.CodePage850},
+	"cp852":    textCharset{charmap.CodePage852},
+	"cp858":    textCharset{charmap.CodePage858},
+	"cp866":    textCharset{charmap.CodePage866},
+	"cp1250":   textCharset{charmap.Windows1250},
+	"cp1251":   textCharset{charmap.Windows1251},
+	"cp1252":   textCharset{charmap.Windows1252},
+	"cp1253":   textCharset{charmap.Windows1253},
+	"cp1254":   textCharset{charmap.Windows1254},
+	"cp1255":   textCharset{charmap.Windows1255},
+	"cp1256":   textCharset{charmap.Windows1256},
+	"cp1257":   textCharset{charmap.Windows1257},
+	"cp1258":   textCharset{charmap.Windows1258},
+	"koi8":     textCharset{charmap.KOI8R},
+	"mac":      textCharset{charmap.Macintosh},
+	"roman8":   newSingleByteCharset(roman8),
+	"sjis":     textCharset{japanese.ShiftJIS},
+	"eucjis":   textCharset{japanese.EUCJP},
+	"eucksc":   textCharset{korean.EUCKR},
+	"cp936":    textCharset{simplifiedchinese.GBK},
+	"gb18030":  textCharset{simplifiedchinese.GB18030},
+	"big5":     textCharset{traditionalchinese.Big5},
+}
+
+// lookupCharset returns the conversion for the passed ASE character
+// set.
+func lookupCharset(name string) (charset, bool) {
+	cs, ok := charsets[strings.ToLower(name)]
+	return cs, ok
+}
+
+// isCharType reports whether values of the data type are encoded in
+// the character set of the session.
+func isCharType(dataType asetypes.DataType) bool {
+	switch dataType {
+	case asetypes.CHAR, asetypes.VARCHAR, asetypes.LONGCHAR, asetypes.TEXT:
+		return true
+	default:
+		return false
+	}
+}
+
+// textCharset converts using an encoding of golang.org/x/text.
+type textCharset struct {
+	encoding encoding.Encoding
+}
+
+func (cs textCharset) decode(bs []byte) (string, error) {
+	decoded, err := cs.encoding.NewDecoder().Bytes(bs)
+	if err != nil {
+		return "", err
+	}
+
+	// The decoders replace invalid sequences with U+FFFD instead of
+	// failing. As U+FFFD is a valid character in e.g. GB18030 the
+	// result is only rejected if it does not encode to the input.
+	if bytes.ContainsRune(decoded, utf8.RuneError) {
+		encoded, err := cs.encoding.NewEncoder().Bytes(decoded)
+		if err != nil || !bytes.Equal(encoded, bs) {
+			return "", fmt.Errorf("invalid byte sequence")
+		}
+	}
+
+	return string(decoded), nil
+}
+
+func (cs textCharset) encode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("invalid UTF-8 string")
+	}
+
+	return cs.encoding.NewEncoder().Bytes([]byte(s))
+}
+
+// singleByteCharset converts character sets whose first 128 characters
+// are ASCII and which are not provided by golang.org/x/text.
+type singleByteCharset struct {
+	decodeTable *[128]rune
+	encodeTable map[rune]byte
+}
+
+func newSingleByteCharset(table *[128]rune) singleByteCharset {
+	cs := singleByteCharset{
+		decodeTable: table,
+		encodeTable: make(map[rune]byte, len(table)),
+	}
+
+	for i, r := range table {
+		if r != utf8.RuneError {
+			cs.encodeTable[r] = byte(0x80 + i)
+		}
+	}
+
+	return cs
+}
+
+func (cs singleByteCharset) decode(bs []byte) (string, error) {
+	var sb strings.Builder
+	sb.Grow(len(bs))
+
+	for i, b := range bs {
+		if b < 0x80 {
+			sb.WriteByte(b)
+			continue
+		}
+
+		r := cs.decodeTable[b-0x80]
+		if r == utf8.RuneError {
+			return "", fmt.Errorf("invalid byte 0x%02x at position %d", b, i)
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String(), nil
+}
+
+func (cs singleByteCharset) encode(s string) ([]byte, error) {
+	bs := make([]byte, 0, len(s))
+
+	for i, r := range s {
+		if r < 0x80 {
+			bs = append(bs, byte(r))
+			continue
+		}
+
+		b, ok := cs.encodeTable[r]
+		if !ok {
+			return nil, fmt.Errorf("character %q at position %d is not supported", r, i)
+		}
+		bs = append(bs, b)
+	}
+
+	return bs, nil
+}
+
+// roman8 maps the bytes 0x80 to 0xff of HP Roman-8.
+var roman8 = &[128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x00C0, 0x00C2, 0x00C8, 0x00CA, 0x00CB, 0x00CE, 0x00CF,
+	0x00B4, 0x02CB, 0x02C6, 0x00A8, 0x02DC, 0x00D9, 0x00DB, 0x20A4,
+	0x00AF, 0x00DD, 0x00FD, 0x00B0, 0x00C7, 0x00E7, 0x00D1, 0x00F1,
+	0x00A1, 0x00BF, 0x00A4, 0x00A3, 0x00A5, 0x00A7, 0x0192, 0x00A2,
+	0x00E2, 0x00EA, 0x00F4, 0x00FB, 0x00E1, 0x00E9, 0x00F3, 0x00FA,
+	0x00E0, 0x00E8, 0x00F2, 0x00F9, 0x00E4, 0x00EB, 0x00F6, 0x00FC,
+	0x00C5, 0x00EE, 0x00D8, 0x00C6, 0x00E5, 0x00ED, 0x00F8, 0x00E6,
+	0x00C4, 0x00EC, 0x00D6, 0x00DC, 0x00C9, 0x00EF, 0x00DF, 0x00D4,
+	0x00C1, 0x00C3, 0x00E3, 0x00D0, 0x00F0, 0x00CD, 0x00CC, 0x00D3,
+	0x00D2, 0x00D5, 0x00F5, 0x0160, 0x0161, 0x00DA, 0x0178, 0x00FF,
+	0x00DE, 0x00FE, 0x00B7, 0x00B5, 0x00B6, 0x00BE, 0x2014, 0x00BC,
+	0x00BD, 0x00AA, 0x00BA, 0x00AB, 0x25A0, 0x00BB, 0x00B1, utf8.RuneError,
+}
+
+// charset returns the conversion for the character set of the session.
+//
+// The character set reported by the server takes precedence over the
+// requested character set, as the server may not convert to the
+// requested character set. Unknown character sets are not converted.
+func (c *Conn) charset() charset {
+	cs, _ := lookupCharset(c.Charset())
+	return cs
+}
+
+// encodeString converts s from UTF-8 to the character set of the
+// session.
+func (c *Conn) encodeString(s string) (string, error) {
+	cs := c.charset()
+	if cs == nil {
+		return s, nil
+	}
+
+	bs, err := cs.encode(s)
+	if err != nil {
+		return "", fmt.Errorf("go-ase: error converting to charset %s: %w", c.Charset(), err)
+	}
+
+	return string(bs), nil
+}
+
+// decodeString converts s from the character set of the session to
+// UTF-8.
+func (c *Conn) decodeString(s string) (string, error) {
+	cs := c.charset()
+	if cs == nil {
+		return s, nil
+	}
+
+	decoded, err := cs.decode([]byte(s))
+	if err != nil {
+		return "", fmt.Errorf("go-ase: error converting from charset %s: %w", c.Charset(), err)
+	}
+
+	return decoded, nil
+}
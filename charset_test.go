@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCharsets(t *testing.T) {
+	const ascii = "select * from t where c = 'A_z 0-9'"
+
+	for name, cs := range charsets {
+		if cs == nil {
+			continue
+		}
+
+		t.Run(name,
+			func(t *testing.T) {
+				encoded, err := cs.encode(ascii)
+				if err != nil {
+					t.Fatalf("Encoding ASCII failed: %v", err)
+				}
+
+				if string(encoded) != ascii {
+					t.Errorf("Expected ASCII to be encoded as is, received %q", encoded)
+				}
+
+				decoded, err := cs.decode(encoded)
+				if err != nil {
+					t.Fatalf("Decoding ASCII failed: %v", err)
+				}
+
+				if decoded != ascii {
+					t.Errorf("Expected ASCII to be decoded as is, received %q", decoded)
+				}
+			},
+		)
+	}
+}
+
+func TestLookupCharset(t *testing.T) {
+	cases := map[string]bool{
+		"utf8":    true,
+		"iso_1":   true,
+		"ISO_1":   true,
+		"ascii_8": true,
+		"Roman8":  true,
+		"klingon": false,
+	}
+
+	for name, expect := range cases {
+		t.Run(name,
+			func(t *testing.T) {
+				if _, ok := lookupCharset(name); ok != expect {
+					t.Errorf("Expected lookup of %q to report %t, received %t", name, expect, ok)
+				}
+			},
+		)
+	}
+}
+
+func TestCharset_Conversion(t *testing.T) {
+	cases := map[string]struct {
+		charset string
+		decoded string
+		encoded []byte
+	}{
+		"iso_1": {
+			charset: "iso_1",
+			decoded: "Grüße ÿ",
+			encoded: []byte{'G', 'r', 0xfc, 0xdf, 'e', ' ', 0xff},
+		},
+		"ascii_8": {
+			charset: "ascii_8",
+			decoded: "éÿ",
+			encoded: []byte{0xe9, 0xff},
+		},
+		"cp850": {
+			charset: "cp850",
+			decoded: "Grüße",
+			encoded: []byte{'G', 'r', 0x81, 0xe1, 'e'},
+		},
+		"roman8": {
+			charset: "roman8",
+			decoded: "Grüße",
+			encoded: []byte{'G', 'r', 0xcf, 0xde, 'e'},
+		},
+		"sjis": {
+			charset: "sjis",
+			decoded: "日本語",
+			encoded: []byte{0x93, 0xfa, 0x96, 0x7b, 0x8c, 0xea},
+		},
+		"gb18030": {
+			charset: "gb18030",
+			decoded: "中文",
+			encoded: []byte{0xd6, 0xd0, 0xce, 0xc4},
+		},
+		"gb18030 replacement character": {
+			charset: "gb18030",
+			decoded: "a�b",
+			encoded: []byte{'a', 0x84, 0x31, 0xa4, 0x37, 'b'},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				cs, ok := lookupCharset(cas.charset)
+				if !ok {
+					t.Fatalf("Charset %s is not known", cas.charset)
+				}
+
+				encoded, err := cs.encode(cas.decoded)
+				if err != nil {
+					t.Fatalf("Encoding failed: %v", err)
+				}
+
+				if !bytes.Equal(encoded, cas.encoded) {
+					t.Errorf("Expected %q to be encoded as % x, received % x", cas.decoded, cas.encoded, encoded)
+				}
+
+				decoded, err := cs.decode(cas.encoded)
+				if err != nil {
+					t.Fatalf("Decoding failed: %v", err)
+				}
+
+				if decoded != cas.decoded {
+					t.Errorf("Expected % x to be decoded as %q, received %q", cas.encoded, cas.decoded, decoded)
+				}
+			},
+		)
+	}
+}
+
+func TestCharset_ConversionErrors(t *testing.T) {
+	cases := map[string]struct {
+		charset string
+		decoded string
+		encoded []byte
+	}{
+		"iso_1 unsupported character": {
+			charset: "iso_1",
+			decoded: "€",
+		},
+		"iso_1 invalid utf-8": {
+			charset: "iso_1",
+			decoded: "\xff",
+		},
+		"roman8 unsupported character": {
+			charset: "roman8",
+			decoded: "€",
+		},
+		"roman8 undefined byte": {
+			charset: "roman8",
+			encoded: []byte{'a', 0xff},
+		},
+		"cp1252 undefined byte": {
+			charset: "cp1252",
+			encoded: []byte{'a', 0x81},
+		},
+		"sjis unsupported character": {
+			charset: "sjis",
+			decoded: "中文€é",
+		},
+		"sjis invalid sequence": {
+			charset: "sjis",
+			encoded: []byte{0x93, 0x7f},
+		},
+		"gb18030 invalid sequence": {
+			charset: "gb18030",
+			encoded: []byte{0x84, 0x31, 'a'},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				cs, ok := lookupCharset(cas.charset)
+				if !ok {
+					t.Fatalf("Charset %s is not known", cas.charset)
+				}
+
+				if cas.encoded != nil {
+					if decoded, err := cs.decode(cas.encoded); err == nil {
+						t.Errorf("Expected decoding % x to fail, received %q", cas.encoded, decoded)
+					}
+					return
+				}
+
+				if encoded, err := cs.encode(cas.decoded); err == nil {
+					t.Errorf("Expected encoding %q to fail, received % x", cas.decoded, encoded)
+				}
+			},
+		)
+	}
+}
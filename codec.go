@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ParamCodec converts parameters of a Go type into a value of an ASE
+// data type.
+//
+// The value returned by Encode is converted to the Go type of DataType
+// and afterwards to the data type of the parameter of the statement,
+// e.g. an int16 for INT2 is sent as int32 to an INT4 parameter.
+//
+//	ase.AddParamCodecs(ase.ParamCodec{
+//		Type:     reflect.TypeOf(uuid.UUID{}),
+//		DataType: asetypes.BINARY,
+//		Encode: func(value interface{}) (interface{}, error) {
+//			id := value.(uuid.UUID)
+//			return id[:], nil
+//		},
+//	})
+type ParamCodec struct {
+	// Type is the Go type the codec is used for.
+	Type reflect.Type
+	// DataType is the ASE data type Encode returns values for.
+	DataType asetypes.DataType
+	// Encode converts a value of Type.
+	Encode func(value interface{}) (interface{}, error)
+}
+
+// ResultCodec converts values of result columns into a Go type.
+//
+// A codec with a Column is used for columns with that name, a codec
+// with a DataType for columns of that data type. Codecs for a column
+// take precedence over codecs for a data type. Nullable data types
+// like INTN also match their fixed-length counterparts like INT2.
+//
+// Decode receives the values after go-ase converted them, e.g. strings
+// for character data. NULL values are not passed to Decode.
+type ResultCodec struct {
+	// Column is the name of the columns the codec is used for.
+	Column string
+	// DataType is the ASE data type of the columns the codec is used
+	// for.
+	DataType asetypes.DataType
+	// Decode converts a value of a matching column.
+	Decode func(value interface{}) (interface{}, error)
+}
+
+func (codec ParamCodec) validate() error {
+	if codec.Type == nil {
+		return fmt.Errorf("go-ase: ParamCodec without Type")
+	}
+
+	if codec.Encode == nil {
+		return fmt.Errorf("go-ase: ParamCodec for %s without Encode", codec.Type)
+	}
+
+	return nil
+}
+
+func (codec ParamCodec) encode(value interface{}) (interface{}, error) {
+	encoded, err := codec.Encode(value)
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error encoding %T: %w", value, err)
+	}
+
+	if encoded == nil || codec.DataType == 0 {
+		return encoded, nil
+	}
+
+	converted, err := codec.DataType.ConvertValue(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error converting encoded %T to %s: %w", value, codec.DataType, err)
+	}
+
+	return converted, nil
+}
+
+func (codec ResultCodec) validate() error {
+	if codec.Column == "" && codec.DataType == 0 {
+		return fmt.Errorf("go-ase: ResultCodec without Column or DataType")
+	}
+
+	if codec.Decode == nil {
+		return fmt.Errorf("go-ase: ResultCodec for column %q and data type %s without Decode",
+			codec.Column, codec.DataType)
+	}
+
+	return nil
+}
+
+// codecs are the codecs used by a connection.
+type codecs struct {
+	params  map[reflect.Type]ParamCodec
+	results []ResultCodec
+}
+
+// newCodecs returns the codecs of the connector and the driver. The
+// codecs of the connector take precedence.
+func newCodecs(connector *Connector) (*codecs, error) {
+	c := &codecs{
+		params: map[reflect.Type]ParamCodec{},
+	}
+
+	for _, paramCodecs := range [][]ParamCodec{drv.paramCodecs, connector.ParamCodecs} {
+		for _, codec := range paramCodecs {
+			if err := codec.validate(); err != nil {
+				return nil, err
+			}
+			c.params[codec.Type] = codec
+		}
+	}
+
+	for _, resultCodecs := range [][]ResultCodec{connector.ResultCodecs, drv.resultCodecs} {
+		for _, codec := range resultCodecs {
+			if err := codec.validate(); err != nil {
+				return nil, err
+			}
+			c.results = append(c.results, codec)
+		}
+	}
+
+	return c, nil
+}
+
+// param returns the codec for the Go type of value.
+func (c *codecs) param(value interface{}) (ParamCodec, bool) {
+	if c == nil || len(c.params) == 0 || value == nil {
+		return ParamCodec{}, false
+	}
+
+	codec, ok := c.params[reflect.TypeOf(value)]
+	return codec, ok
+}
+
+// result returns the decode function for a column.
+func (c *codecs) result(name string, fieldFmt tds.FieldFmt) func(interface{}) (interface{}, error) {
+	if c == nil || len(c.results) == 0 {
+		return nil
+	}
+
+	for _, codec := range c.results {
+		if codec.Column != "" && codec.Column == name {
+			return codec.Decode
+		}
+	}
+
+	dataType, baseType := fieldFmt.DataType(), baseDataType(fieldFmt)
+	for _, codec := range c.results {
+		if codec.Column == "" && (codec.DataType == dataType || codec.DataType == baseType) {
+			return codec.Decode
+		}
+	}
+
+	return nil
+}
+
+// baseDataType returns the fixed-length data type of nullable data
+// types.
+func baseDataType(fieldFmt tds.FieldFmt) asetypes.DataType {
+	length := fieldFmt.MaxLength()
+
+	switch fieldFmt.DataType() {
+	case asetypes.INTN:
+		switch length {
+		case 1:
+			return asetypes.INT1
+		case 2:
+			return asetypes.INT2
+		case 4:
+			return asetypes.INT4
+		case 8:
+			return asetypes.INT8
+		}
+	case asetypes.UINTN:
+		switch length {
+		case 2:
+			return asetypes.UINT2
+		case 4:
+			return asetypes.UINT4
+		case 8:
+			return asetypes.UINT8
+		}
+	case asetypes.FLTN:
+		switch length {
+		case 4:
+			return asetypes.FLT4
+		case 8:
+			return asetypes.FLT8
+		}
+	case asetypes.MONEYN:
+		switch length {
+		case 4:
+			return asetypes.SHORTMONEY
+		case 8:
+			return asetypes.MONEY
+		}
+	case asetypes.DATETIMEN:
+		switch length {
+		case 4:
+			return asetypes.SHORTDATE
+		case 8:
+			return asetypes.DATETIME
+		}
+	case asetypes.DATEN:
+		return asetypes.DATE
+	case asetypes.TIMEN:
+		return asetypes.TIME
+	}
+
+	return fieldFmt.DataType()
+}
@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+type codecID [2]byte
+
+func TestParamCodec_encode(t *testing.T) {
+	cases := map[string]struct {
+		codec     ParamCodec
+		value     interface{}
+		expect    interface{}
+		expectErr bool
+	}{
+		"without data type": {
+			codec: ParamCodec{
+				Encode: func(value interface{}) (interface{}, error) {
+					return int(value.(codecID)[0]), nil
+				},
+			},
+			value:  codecID{7, 0},
+			expect: 7,
+		},
+		"converted to data type": {
+			codec: ParamCodec{
+				DataType: asetypes.INT2,
+				Encode: func(value interface{}) (interface{}, error) {
+					return int(value.(codecID)[0]), nil
+				},
+			},
+			value:  codecID{7, 0},
+			expect: int16(7),
+		},
+		"binary": {
+			codec: ParamCodec{
+				DataType: asetypes.BINARY,
+				Encode: func(value interface{}) (interface{}, error) {
+					id := value.(codecID)
+					return id[:], nil
+				},
+			},
+			value:  codecID{1, 2},
+			expect: []byte{1, 2},
+		},
+		"nil is not converted": {
+			codec: ParamCodec{
+				DataType: asetypes.INT4,
+				Encode: func(value interface{}) (interface{}, error) {
+					return nil, nil
+				},
+			},
+			value:  codecID{},
+			expect: nil,
+		},
+		"encode error": {
+			codec: ParamCodec{
+				Encode: func(value interface{}) (interface{}, error) {
+					return nil, errors.New("invalid id")
+				},
+			},
+			value:     codecID{},
+			expectErr: true,
+		},
+		"conversion error": {
+			codec: ParamCodec{
+				DataType: asetypes.INT4,
+				Encode: func(value interface{}) (interface{}, error) {
+					return "seven", nil
+				},
+			},
+			value:     codecID{},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				encoded, err := cas.codec.encode(cas.value)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %v", encoded)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Encoding failed: %v", err)
+				}
+
+				if !reflect.DeepEqual(encoded, cas.expect) {
+					t.Errorf("Expected %T(%v), received %T(%v)", cas.expect, cas.expect, encoded, encoded)
+				}
+			},
+		)
+	}
+}
+
+func TestNewCodecs_Validate(t *testing.T) {
+	encode := func(value interface{}) (interface{}, error) { return value, nil }
+
+	cases := map[string]struct {
+		params    []ParamCodec
+		results   []ResultCodec
+		expectErr string
+	}{
+		"valid": {
+			params:  []ParamCodec{{Type: reflect.TypeOf(codecID{}), Encode: encode}},
+			results: []ResultCodec{{Column: "id", Decode: encode}, {DataType: asetypes.INT4, Decode: encode}},
+		},
+		"param without type": {
+			params:    []ParamCodec{{Encode: encode}},
+			expectErr: "without Type",
+		},
+		"param without encode": {
+			params:    []ParamCodec{{Type: reflect.TypeOf(codecID{})}},
+			expectErr: "without Encode",
+		},
+		"result without column or data type": {
+			results:   []ResultCodec{{Decode: encode}},
+			expectErr: "without Column or DataType",
+		},
+		"result without decode": {
+			results:   []ResultCodec{{Column: "id"}},
+			expectErr: "without Decode",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				_, err := newCodecs(&Connector{ParamCodecs: cas.params, ResultCodecs: cas.results})
+				if cas.expectErr == "" {
+					if err != nil {
+						t.Errorf("Unexpected error: %v", err)
+					}
+					return
+				}
+
+				if err == nil || !strings.Contains(err.Error(), cas.expectErr) {
+					t.Errorf("Expected error containing %q, received %v", cas.expectErr, err)
+				}
+			},
+		)
+	}
+}
+
+func TestNewCodecs_Precedence(t *testing.T) {
+	decoder := func(result string) func(interface{}) (interface{}, error) {
+		return func(interface{}) (interface{}, error) { return result, nil }
+	}
+
+	paramCodecs, resultCodecs := drv.paramCodecs, drv.resultCodecs
+	defer func() {
+		drv.paramCodecs, drv.resultCodecs = paramCodecs, resultCodecs
+	}()
+
+	drv.paramCodecs = []ParamCodec{{Type: reflect.TypeOf(codecID{}), Encode: decoder("driver")}}
+	drv.resultCodecs = []ResultCodec{{DataType: asetypes.INT4, Decode: decoder("driver")}}
+
+	c, err := newCodecs(&Connector{
+		ParamCodecs:  []ParamCodec{{Type: reflect.TypeOf(codecID{}), Encode: decoder("connector")}},
+		ResultCodecs: []ResultCodec{{DataType: asetypes.INT4, Decode: decoder("connector")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec, ok := c.param(codecID{})
+	if !ok {
+		t.Fatalf("Expected a param codec for %T", codecID{})
+	}
+	if encoded, _ := codec.Encode(nil); encoded != "connector" {
+		t.Errorf("Expected the param codec of the connector, received the one of the %v", encoded)
+	}
+
+	if _, ok := c.param(1); ok {
+		t.Errorf("Expected no param codec for int")
+	}
+	if _, ok := c.param(nil); ok {
+		t.Errorf("Expected no param codec for nil")
+	}
+
+	fieldFmt, err := tds.LookupFieldFmt(asetypes.INT4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := c.result("id", fieldFmt)
+	if decode == nil {
+		t.Fatalf("Expected a result codec for INT4")
+	}
+	if decoded, _ := decode(nil); decoded != "connector" {
+		t.Errorf("Expected the result codec of the connector, received the one of the %v", decoded)
+	}
+}
+
+func TestCodecs_result(t *testing.T) {
+	decoder := func(result string) func(interface{}) (interface{}, error) {
+		return func(interface{}) (interface{}, error) { return result, nil }
+	}
+
+	c := &codecs{
+		results: []ResultCodec{
+			{DataType: asetypes.INT4, Decode: decoder("int4")},
+			{Column: "id", Decode: decoder("id")},
+			{DataType: asetypes.SHORTDATE, Decode: decoder("smalldatetime")},
+			{DataType: asetypes.DATETIMEN, Decode: decoder("datetimen")},
+			{DataType: asetypes.TIME, Decode: decoder("time")},
+		},
+	}
+
+	cases := map[string]struct {
+		column   string
+		dataType asetypes.DataType
+		length   int64
+		expect   string
+	}{
+		"column before data type": {
+			column:   "id",
+			dataType: asetypes.INT4,
+			expect:   "id",
+		},
+		"column of other data type": {
+			column:   "id",
+			dataType: asetypes.VARCHAR,
+			expect:   "id",
+		},
+		"data type": {
+			column:   "count",
+			dataType: asetypes.INT4,
+			expect:   "int4",
+		},
+		"nullable data type": {
+			column:   "count",
+			dataType: asetypes.INTN,
+			length:   4,
+			expect:   "int4",
+		},
+		"nullable data type of other length": {
+			column:   "count",
+			dataType: asetypes.INTN,
+			length:   8,
+		},
+		"first matching data type": {
+			column:   "created",
+			dataType: asetypes.DATETIMEN,
+			length:   4,
+			expect:   "smalldatetime",
+		},
+		"nullable data type itself": {
+			column:   "created",
+			dataType: asetypes.DATETIMEN,
+			length:   8,
+			expect:   "datetimen",
+		},
+		"nullable time": {
+			column:   "at",
+			dataType: asetypes.TIMEN,
+			expect:   "time",
+		},
+		"no match": {
+			column:   "name",
+			dataType: asetypes.VARCHAR,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				fieldFmt, err := tds.LookupFieldFmt(cas.dataType)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				decode := c.result(cas.column, lengthFmt{fieldFmt, cas.length})
+				if cas.expect == "" {
+					if decode != nil {
+						t.Errorf("Expected no result codec")
+					}
+					return
+				}
+
+				if decode == nil {
+					t.Fatalf("Expected result codec %s, received none", cas.expect)
+				}
+
+				if decoded, _ := decode(nil); decoded != cas.expect {
+					t.Errorf("Expected result codec %s, received %v", cas.expect, decoded)
+				}
+			},
+		)
+	}
+
+	var empty *codecs
+	if decode := empty.result("id", nil); decode != nil {
+		t.Errorf("Expected no result codec without codecs")
+	}
+}
+
+func TestBaseDataType(t *testing.T) {
+	cases := map[string]struct {
+		dataType asetypes.DataType
+		length   int64
+		expect   asetypes.DataType
+	}{
+		"tinyint":        {dataType: asetypes.INTN, length: 1, expect: asetypes.INT1},
+		"smallint":       {dataType: asetypes.INTN, length: 2, expect: asetypes.INT2},
+		"int":            {dataType: asetypes.INTN, length: 4, expect: asetypes.INT4},
+		"bigint":         {dataType: asetypes.INTN, length: 8, expect: asetypes.INT8},
+		"unsigned int":   {dataType: asetypes.UINTN, length: 4, expect: asetypes.UINT4},
+		"real":           {dataType: asetypes.FLTN, length: 4, expect: asetypes.FLT4},
+		"float":          {dataType: asetypes.FLTN, length: 8, expect: asetypes.FLT8},
+		"smallmoney":     {dataType: asetypes.MONEYN, length: 4, expect: asetypes.SHORTMONEY},
+		"money":          {dataType: asetypes.MONEYN, length: 8, expect: asetypes.MONEY},
+		"smalldatetime":  {dataType: asetypes.DATETIMEN, length: 4, expect: asetypes.SHORTDATE},
+		"datetime":       {dataType: asetypes.DATETIMEN, length: 8, expect: asetypes.DATETIME},
+		"date":           {dataType: asetypes.DATEN, expect: asetypes.DATE},
+		"time":           {dataType: asetypes.TIMEN, expect: asetypes.TIME},
+		"unknown length": {dataType: asetypes.INTN, length: 3, expect: asetypes.INTN},
+		"fixed length":   {dataType: asetypes.INT4, expect: asetypes.INT4},
+		"variable":       {dataType: asetypes.VARCHAR, length: 255, expect: asetypes.VARCHAR},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				fieldFmt, err := tds.LookupFieldFmt(cas.dataType)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if base := baseDataType(lengthFmt{fieldFmt, cas.length}); base != cas.expect {
+					t.Errorf("Expected %s, received %s", cas.expect, base)
+				}
+			},
+		)
+	}
+}
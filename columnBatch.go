@@ -0,0 +1,306 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ColumnKind is the kind of vector the values of a column are stored
+// in by NextColumnBatch.
+type ColumnKind int
+
+// Column kinds.
+const (
+	// ColumnValues are columns stored as driver.Value, the same as
+	// returned by Next. This applies to columns without a dedicated
+	// vector and to columns decoded by a result codec.
+	ColumnValues ColumnKind = iota
+	// ColumnInt64 are integer columns.
+	ColumnInt64
+	// ColumnFloat64 are float columns.
+	ColumnFloat64
+	// ColumnString are character columns.
+	ColumnString
+	// ColumnBytes are binary columns.
+	ColumnBytes
+)
+
+// ColumnVector holds the values of a column of a ColumnBatch.
+//
+// Only the slice matching Kind is filled, its length is the number of
+// rows in the batch. The values of NULL rows are the zero value.
+type ColumnVector struct {
+	Kind    ColumnKind
+	Int64   []int64
+	Float64 []float64
+	String  []string
+	Bytes   [][]byte
+	Values  []driver.Value
+	// Nulls is a bitmap of the NULL rows, row i is NULL if bit i%64
+	// of Nulls[i/64] is set.
+	Nulls []uint64
+}
+
+// IsNull reports whether the value of row i is NULL.
+func (vec ColumnVector) IsNull(i int) bool {
+	return vec.Nulls[i/64]&(1<<uint(i%64)) != 0
+}
+
+// reset empties the vector for the next batch.
+func (vec *ColumnVector) reset(size int) {
+	vec.Int64 = vec.Int64[:0]
+	vec.Float64 = vec.Float64[:0]
+	vec.String = vec.String[:0]
+	vec.Bytes = vec.Bytes[:0]
+	vec.Values = vec.Values[:0]
+
+	words := (size + 63) / 64
+	if cap(vec.Nulls) < words {
+		vec.Nulls = make([]uint64, words)
+	}
+	vec.Nulls = vec.Nulls[:words]
+	for i := range vec.Nulls {
+		vec.Nulls[i] = 0
+	}
+}
+
+// ColumnBatch holds a batch of rows of a result set in column vectors.
+//
+// A ColumnBatch is reused by passing it to NextColumnBatch again, the
+// vectors of the previous batch are overwritten.
+type ColumnBatch struct {
+	// Size is the maximum number of rows read into the batch.
+	Size int
+	// Len is the number of rows in the batch.
+	Len int
+	// Columns are the names of the columns.
+	Columns []string
+	// Vectors are the values of the columns.
+	Vectors []ColumnVector
+
+	// rowFmt is the row format Columns and Vectors were set up for.
+	rowFmt *tds.RowFmtPackage
+	// eof is set if the result set ended while filling the batch.
+	eof bool
+}
+
+// NewColumnBatch returns a ColumnBatch holding up to size rows.
+func NewColumnBatch(size int) *ColumnBatch {
+	return &ColumnBatch{Size: size}
+}
+
+// NextColumnBatch reads up to batch.Size rows of the current result
+// set into batch.
+//
+// The values of integer, float, character and binary columns are
+// stored in typed vectors, integers that do not fit into an int64
+// return an error. The rows are decoded by go-dblib the same as for
+// Next, hence reading batches does not save allocations per value
+// compared to Next.
+//
+// io.EOF is returned if the result set is exhausted. If
+// HasNextResultSet reports another result set the following calls read
+// the rows of that result set.
+func (rows *Rows) NextColumnBatch(batch *ColumnBatch) error {
+	if batch.Size <= 0 {
+		return fmt.Errorf("go-ase: invalid batch size %d", batch.Size)
+	}
+
+	if batch.eof {
+		batch.eof = false
+		batch.Len = 0
+		return io.EOF
+	}
+
+	if rows.RowFmt == nil {
+		return io.EOF
+	}
+
+	if batch.rowFmt != rows.RowFmt {
+		batch.setup(rows)
+	}
+
+	for i := range batch.Vectors {
+		batch.Vectors[i].reset(batch.Size)
+	}
+	batch.Len = 0
+
+	cs := rows.Conn.charset()
+	decoders := rows.decoders()
+
+	appendRow := func(row *tds.RowPackage) error {
+		if len(row.DataFields) != len(batch.Vectors) {
+			return fmt.Errorf("go-ase: received row with %d columns, expecting %d columns", len(row.DataFields), len(batch.Vectors))
+		}
+
+		for i := range batch.Vectors {
+			var value interface{}
+			var err error
+			if !isNullData(row.DataFields[i].Format(), row.DataFields[i].Value()) {
+				if value, err = rows.convertValue(i, row.DataFields[i], cs); err != nil {
+					return err
+				}
+			}
+
+			vec := &batch.Vectors[i]
+			if vec.Kind == ColumnValues && value != nil && decoders[i] != nil {
+				value, err = decoders[i](value)
+				if err != nil {
+					return fmt.Errorf("go-ase: error decoding column %d: %w", i, err)
+				}
+			}
+
+			if err := vec.append(batch.Len, value); err != nil {
+				return fmt.Errorf("go-ase: error storing column %d: %w", i, err)
+			}
+		}
+		batch.Len++
+		return nil
+	}
+
+	for batch.Len < batch.Size {
+		err := rows.nextRow(appendRow)
+		if err != nil {
+			if err == io.EOF && batch.Len > 0 {
+				batch.eof = true
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setup sets up the columns and vectors of the batch for the current
+// result set of rows.
+func (batch *ColumnBatch) setup(rows *Rows) {
+	batch.rowFmt = rows.RowFmt
+	batch.Columns = rows.Columns()
+
+	decoders := rows.decoders()
+
+	if cap(batch.Vectors) < len(batch.Columns) {
+		batch.Vectors = make([]ColumnVector, len(batch.Columns))
+	}
+	batch.Vectors = batch.Vectors[:len(batch.Columns)]
+
+	for i, fieldFmt := range rows.RowFmt.Fmts {
+		kind := columnKind(fieldFmt)
+		if decoders[i] != nil {
+			kind = ColumnValues
+		}
+		batch.Vectors[i].Kind = kind
+	}
+}
+
+// columnKind returns the kind of vector the values of a column with
+// the field format are stored in.
+func columnKind(fieldFmt tds.FieldFmt) ColumnKind {
+	if isUnicodeFmt(fieldFmt) {
+		return ColumnString
+	}
+
+	switch fieldFmt.DataType() {
+	case asetypes.INT1, asetypes.INT2, asetypes.INT4, asetypes.INT8, asetypes.INTN,
+		asetypes.UINT2, asetypes.UINT4, asetypes.UINT8, asetypes.UINTN:
+		return ColumnInt64
+	case asetypes.FLT4, asetypes.FLT8, asetypes.FLTN:
+		return ColumnFloat64
+	case asetypes.CHAR, asetypes.VARCHAR, asetypes.LONGCHAR, asetypes.TEXT:
+		return ColumnString
+	case asetypes.BINARY, asetypes.VARBINARY, asetypes.LONGBINARY, asetypes.IMAGE:
+		return ColumnBytes
+	default:
+		return ColumnValues
+	}
+}
+
+// append stores value as row i of the vector.
+func (vec *ColumnVector) append(i int, value driver.Value) error {
+	if value == nil {
+		vec.Nulls[i/64] |= 1 << uint(i%64)
+	}
+
+	switch vec.Kind {
+	case ColumnInt64:
+		var v int64
+		switch typed := value.(type) {
+		case nil:
+		case int:
+			v = int64(typed)
+		case int8:
+			v = int64(typed)
+		case int16:
+			v = int64(typed)
+		case int32:
+			v = int64(typed)
+		case int64:
+			v = typed
+		case uint:
+			if uint64(typed) > math.MaxInt64 {
+				return fmt.Errorf("value %d overflows int64", typed)
+			}
+			v = int64(typed)
+		case uint8:
+			v = int64(typed)
+		case uint16:
+			v = int64(typed)
+		case uint32:
+			v = int64(typed)
+		case uint64:
+			if typed > math.MaxInt64 {
+				return fmt.Errorf("value %d overflows int64", typed)
+			}
+			v = int64(typed)
+		default:
+			return fmt.Errorf("unexpected value of type %T for integer column", value)
+		}
+		vec.Int64 = append(vec.Int64, v)
+	case ColumnFloat64:
+		var v float64
+		switch typed := value.(type) {
+		case nil:
+		case float32:
+			v = float64(typed)
+		case float64:
+			v = typed
+		default:
+			return fmt.Errorf("unexpected value of type %T for float column", value)
+		}
+		vec.Float64 = append(vec.Float64, v)
+	case ColumnString:
+		var v string
+		switch typed := value.(type) {
+		case nil:
+		case string:
+			v = typed
+		default:
+			return fmt.Errorf("unexpected value of type %T for character column", value)
+		}
+		vec.String = append(vec.String, v)
+	case ColumnBytes:
+		var v []byte
+		switch typed := value.(type) {
+		case nil:
+		case []byte:
+			v = typed
+		default:
+			return fmt.Errorf("unexpected value of type %T for binary column", value)
+		}
+		vec.Bytes = append(vec.Bytes, v)
+	default:
+		vec.Values = append(vec.Values, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,480 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// nullableColumns are the columns of the result set of "nullable".
+var nullableColumns = []aseserver.Column{
+	{Name: "id", DataType: asetypes.INT4},
+	{Name: "amount", DataType: asetypes.INTN, Length: 8, Nullable: true},
+	{Name: "price", DataType: asetypes.FLTN, Length: 8, Nullable: true},
+	{Name: "name", DataType: asetypes.VARCHAR, Length: 16, Nullable: true},
+	{Name: "data", DataType: asetypes.VARBINARY, Length: 16, Nullable: true},
+}
+
+// nullableRow returns row i of "nullable", every third row is NULL
+// except for the id.
+func nullableRow(i int) []interface{} {
+	if i%3 == 0 {
+		return []interface{}{int32(i), nil, nil, nil, nil}
+	}
+	return []interface{}{int32(i), int64(i) * 10, float64(i) / 2, fmt.Sprintf("row %d", i), []byte{byte(i)}}
+}
+
+// columnBatchServer responds to the queries of the column batch tests.
+var columnBatchServer = multiServer{
+	// nullable returns 130 rows, which spans three words of the
+	// NULL bitmaps.
+	"nullable": func(w *aseserver.ResponseWriter) error {
+		if err := w.WriteRowFmt(nullableColumns...); err != nil {
+			return err
+		}
+		for i := 0; i < 130; i++ {
+			if err := w.WriteRow(nullableRow(i)...); err != nil {
+				return err
+			}
+		}
+		return w.WriteDone(tds.TDS_DONE_COUNT, 130)
+	},
+	"five": func(w *aseserver.ResponseWriter) error {
+		return writeSelect(w, 0, 1, 2, 3, 4, 5)
+	},
+	"sets": func(w *aseserver.ResponseWriter) error {
+		if err := writeSelect(w, tds.TDS_DONE_MORE, 1, 2, 3); err != nil {
+			return err
+		}
+		if err := w.WriteRowFmt(aseserver.Column{Name: "name", DataType: asetypes.VARCHAR, Length: 8}); err != nil {
+			return err
+		}
+		for _, name := range []string{"a", "b"} {
+			if err := w.WriteRow(name); err != nil {
+				return err
+			}
+		}
+		return w.WriteDone(tds.TDS_DONE_COUNT, 2)
+	},
+	"unsigned": func(w *aseserver.ResponseWriter) error {
+		if err := w.WriteRowFmt(aseserver.Column{Name: "value", DataType: asetypes.UINT8}); err != nil {
+			return err
+		}
+		for _, value := range []uint64{math.MaxInt64, math.MaxInt64 + 1} {
+			if err := w.WriteRow(value); err != nil {
+				return err
+			}
+		}
+		return w.WriteDone(tds.TDS_DONE_COUNT, 2)
+	},
+}
+
+// withBatchRows passes the rows of query executed on columnBatchServer
+// to fn.
+func withBatchRows(t *testing.T, query string, codecs []ase.ResultCodec, fn func(rows *ase.Rows)) {
+	connector := &ase.Connector{
+		DSN:          fakeInfo(t, fakeServer(t, columnBatchServer)),
+		ResultCodecs: codecs,
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		rows, _, err := driverConn.(*ase.Conn).GenericExec(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		fn(rows.(*ase.Rows))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenericExec failed: %v", err)
+	}
+
+	if err := conn.PingContext(ctx); err != nil {
+		t.Errorf("Connection unusable: %v", err)
+	}
+}
+
+func TestRows_NextColumnBatchNulls(t *testing.T) {
+	cases := map[string]struct {
+		size int
+	}{
+		"single batch":        {size: 200},
+		"batches":             {size: 50},
+		"batches of one word": {size: 64},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				withBatchRows(t, "nullable", nil, func(rows *ase.Rows) {
+					batch := ase.NewColumnBatch(cas.size)
+					read := 0
+
+					for {
+						err := rows.NextColumnBatch(batch)
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							t.Fatalf("NextColumnBatch failed: %v", err)
+						}
+
+						kinds := []ase.ColumnKind{ase.ColumnInt64, ase.ColumnInt64, ase.ColumnFloat64, ase.ColumnString, ase.ColumnBytes}
+						for j, vec := range batch.Vectors {
+							if vec.Kind != kinds[j] {
+								t.Fatalf("Expected kind %d of column %d, received %d", kinds[j], j, vec.Kind)
+							}
+						}
+
+						for j := 0; j < batch.Len; j++ {
+							i := read + j
+							expect := nullableRow(i)
+
+							received := []interface{}{
+								int32(batch.Vectors[0].Int64[j]),
+								batch.Vectors[1].Int64[j],
+								batch.Vectors[2].Float64[j],
+								batch.Vectors[3].String[j],
+								batch.Vectors[4].Bytes[j],
+							}
+
+							for k, vec := range batch.Vectors {
+								if isNull := vec.IsNull(j); isNull != (expect[k] == nil) {
+									t.Errorf("Row %d, column %d: expected NULL %t, received %t", i, k, expect[k] == nil, isNull)
+									continue
+								}
+
+								if expect[k] == nil {
+									// The values of NULL rows are the zero
+									// value.
+									if !reflect.ValueOf(received[k]).IsZero() {
+										t.Errorf("Row %d, column %d: expected zero value, received %v", i, k, received[k])
+									}
+									continue
+								}
+
+								if !reflect.DeepEqual(received[k], expect[k]) {
+									t.Errorf("Row %d, column %d: expected %v, received %v", i, k, expect[k], received[k])
+								}
+							}
+						}
+
+						read += batch.Len
+					}
+
+					if read != 130 {
+						t.Errorf("Expected 130 rows, received %d", read)
+					}
+				})
+			},
+		)
+	}
+}
+
+func TestRows_NextNulls(t *testing.T) {
+	withBatchRows(t, "nullable", nil, func(rows *ase.Rows) {
+		dst := make([]driver.Value, len(nullableColumns))
+		for i := 0; i < 3; i++ {
+			if err := rows.Next(dst); err != nil {
+				t.Fatalf("Next failed: %v", err)
+			}
+
+			for k, value := range nullableRow(i) {
+				if !reflect.DeepEqual(dst[k], value) {
+					t.Errorf("Row %d, column %d: expected %#v, received %#v", i, k, value, dst[k])
+				}
+			}
+		}
+	})
+}
+
+func TestRows_NextColumnBatchPartial(t *testing.T) {
+	cases := map[string]struct {
+		size       int
+		expectLens []int
+	}{
+		"size one":         {size: 1, expectLens: []int{1, 1, 1, 1, 1}},
+		"partial batch":    {size: 2, expectLens: []int{2, 2, 1}},
+		"exact batch":      {size: 5, expectLens: []int{5}},
+		"larger than rows": {size: 10, expectLens: []int{5}},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				withBatchRows(t, "five", nil, func(rows *ase.Rows) {
+					batch := ase.NewColumnBatch(cas.size)
+
+					lens := []int{}
+					values := []int64{}
+					for {
+						err := rows.NextColumnBatch(batch)
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							t.Fatalf("NextColumnBatch failed: %v", err)
+						}
+
+						lens = append(lens, batch.Len)
+						values = append(values, batch.Vectors[0].Int64[:batch.Len]...)
+					}
+
+					if !reflect.DeepEqual(lens, cas.expectLens) {
+						t.Errorf("Expected batches of %v rows, received %v", cas.expectLens, lens)
+					}
+					if !reflect.DeepEqual(values, []int64{1, 2, 3, 4, 5}) {
+						t.Errorf("Expected values 1 to 5, received %v", values)
+					}
+
+					// The result set stays exhausted.
+					if err := rows.NextColumnBatch(batch); err != io.EOF {
+						t.Errorf("Expected io.EOF, received %v", err)
+					}
+					if batch.Len != 0 {
+						t.Errorf("Expected an empty batch, received %d rows", batch.Len)
+					}
+				})
+			},
+		)
+	}
+}
+
+func TestRows_NextColumnBatchResultSets(t *testing.T) {
+	cases := map[string]struct {
+		size int
+		// nextResultSet calls NextResultSet before reading the second
+		// result set.
+		nextResultSet bool
+	}{
+		"continue reading":       {size: 2},
+		"continue reading large": {size: 10},
+		"next result set":        {size: 2, nextResultSet: true},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				withBatchRows(t, "sets", nil, func(rows *ase.Rows) {
+					batch := ase.NewColumnBatch(cas.size)
+
+					ids := []int64{}
+					for {
+						err := rows.NextColumnBatch(batch)
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							t.Fatalf("NextColumnBatch failed: %v", err)
+						}
+						ids = append(ids, batch.Vectors[0].Int64[:batch.Len]...)
+					}
+
+					if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+						t.Errorf("Expected ids 1 to 3 in the first result set, received %v", ids)
+					}
+
+					if !rows.HasNextResultSet() {
+						t.Fatalf("Expected a second result set")
+					}
+					if cas.nextResultSet {
+						if err := rows.NextResultSet(); err != nil {
+							t.Fatalf("NextResultSet failed: %v", err)
+						}
+					}
+
+					if err := rows.NextColumnBatch(batch); err != nil {
+						t.Fatalf("NextColumnBatch failed: %v", err)
+					}
+
+					if !reflect.DeepEqual(batch.Columns, []string{"name"}) || batch.Vectors[0].Kind != ase.ColumnString {
+						t.Fatalf("Expected string column name, received %v of kind %d", batch.Columns, batch.Vectors[0].Kind)
+					}
+					if !reflect.DeepEqual(batch.Vectors[0].String, []string{"a", "b"}) {
+						t.Errorf("Expected names a and b, received %v", batch.Vectors[0].String)
+					}
+
+					if err := rows.NextColumnBatch(batch); err != io.EOF {
+						t.Errorf("Expected io.EOF at the end of the response, received %v", err)
+					}
+					if rows.HasNextResultSet() {
+						t.Errorf("Expected no further result set")
+					}
+				})
+			},
+		)
+	}
+}
+
+func TestRows_NextColumnBatchErrors(t *testing.T) {
+	cases := map[string]struct {
+		query string
+		read  func(rows *ase.Rows) error
+		// expectErr is a part of the expected error message.
+		expectErr string
+	}{
+		"zero size": {
+			query: "five",
+			read: func(rows *ase.Rows) error {
+				return rows.NextColumnBatch(ase.NewColumnBatch(0))
+			},
+			expectErr: "invalid batch size 0",
+		},
+		"negative size": {
+			query: "five",
+			read: func(rows *ase.Rows) error {
+				return rows.NextColumnBatch(ase.NewColumnBatch(-1))
+			},
+			expectErr: "invalid batch size -1",
+		},
+		"truncated vectors": {
+			query: "nullable",
+			read: func(rows *ase.Rows) error {
+				batch := ase.NewColumnBatch(1)
+				if err := rows.NextColumnBatch(batch); err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				batch.Vectors = batch.Vectors[:2]
+				return rows.NextColumnBatch(batch)
+			},
+			expectErr: "received row with 5 columns, expecting 2 columns",
+		},
+		"too few destinations": {
+			query: "nullable",
+			read: func(rows *ase.Rows) error {
+				return rows.Next(make([]driver.Value, 4))
+			},
+			expectErr: "expecting 5 destinations, got 4",
+		},
+		"too many destinations": {
+			query: "five",
+			read: func(rows *ase.Rows) error {
+				return rows.Next(make([]driver.Value, 2))
+			},
+			expectErr: "expecting 1 destinations, got 2",
+		},
+		"integer overflow": {
+			query: "unsigned",
+			read: func(rows *ase.Rows) error {
+				return rows.NextColumnBatch(ase.NewColumnBatch(2))
+			},
+			expectErr: "overflows int64",
+		},
+		"integer overflow in second batch": {
+			query: "unsigned",
+			read: func(rows *ase.Rows) error {
+				batch := ase.NewColumnBatch(1)
+				if err := rows.NextColumnBatch(batch); err != nil {
+					return fmt.Errorf("unexpected error: %w", err)
+				}
+				if batch.Vectors[0].Kind != ase.ColumnInt64 || batch.Vectors[0].Int64[0] != math.MaxInt64 {
+					return fmt.Errorf("expected %d in an integer vector, received %v", int64(math.MaxInt64), batch.Vectors[0])
+				}
+				return rows.NextColumnBatch(batch)
+			},
+			expectErr: "overflows int64",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				withBatchRows(t, cas.query, nil, func(rows *ase.Rows) {
+					err := cas.read(rows)
+					if err == nil || !strings.Contains(err.Error(), cas.expectErr) {
+						t.Errorf("Expected error containing %q, received %v", cas.expectErr, err)
+					}
+				})
+			},
+		)
+	}
+}
+
+// batchName is the type names are decoded into by the codec of
+// TestRows_NextColumnBatchCodec.
+type batchName struct {
+	name string
+}
+
+func TestRows_NextColumnBatchCodec(t *testing.T) {
+	cases := map[string]struct {
+		codec  ase.ResultCodec
+		expect []driver.Value
+	}{
+		"column": {
+			codec: ase.ResultCodec{
+				Column: "name",
+				Decode: func(value interface{}) (interface{}, error) {
+					return batchName{name: value.(string)}, nil
+				},
+			},
+			expect: []driver.Value{nil, batchName{name: "row 1"}, batchName{name: "row 2"}},
+		},
+		"data type": {
+			codec: ase.ResultCodec{
+				DataType: asetypes.VARCHAR,
+				Decode: func(value interface{}) (interface{}, error) {
+					return batchName{name: value.(string)}, nil
+				},
+			},
+			expect: []driver.Value{nil, batchName{name: "row 1"}, batchName{name: "row 2"}},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				withBatchRows(t, "nullable", []ase.ResultCodec{cas.codec}, func(rows *ase.Rows) {
+					batch := ase.NewColumnBatch(3)
+					if err := rows.NextColumnBatch(batch); err != nil {
+						t.Fatalf("NextColumnBatch failed: %v", err)
+					}
+
+					// Columns decoded by a codec are stored as values,
+					// other columns keep their vectors.
+					vec := batch.Vectors[3]
+					if vec.Kind != ase.ColumnValues {
+						t.Fatalf("Expected kind %d of the codec column, received %d", ase.ColumnValues, vec.Kind)
+					}
+					if batch.Vectors[0].Kind != ase.ColumnInt64 {
+						t.Errorf("Expected kind %d of column id, received %d", ase.ColumnInt64, batch.Vectors[0].Kind)
+					}
+
+					if !reflect.DeepEqual(vec.Values, cas.expect) {
+						t.Errorf("Expected %v, received %v", cas.expect, vec.Values)
+					}
+					if !vec.IsNull(0) || vec.IsNull(1) {
+						t.Errorf("Expected only row 0 to be NULL, received %b", vec.Nulls)
+					}
+				})
+			},
+		)
+	}
+}
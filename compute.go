@@ -0,0 +1,357 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ComputeRow is a row computed by a compute clause of a query.
+type ComputeRow struct {
+	// ID identifies the compute clause within the query, starting
+	// with 1.
+	ID int
+	// Columns describe the computed values.
+	Columns []ComputeColumn
+	// ByColumns are the indices of the columns of the result set the
+	// rows are grouped by. It is empty for compute clauses without by.
+	ByColumns []int
+	// Values are the computed values.
+	Values []driver.Value
+}
+
+// ComputeColumn describes a value computed by a compute clause.
+type ComputeColumn struct {
+	// Name is the name the server reported for the value, if any.
+	Name string
+	// Operator is the aggregate function, e.g. "sum".
+	Operator string
+	// Operand is the index of the column of the result set the value
+	// is computed of.
+	Operand int
+	// DatabaseTypeName is the data type of the value.
+	DatabaseTypeName string
+}
+
+type computeRowsCtxKey struct{}
+
+// WithComputeRows returns a context tagging queries executed with it to
+// pass the rows computed by compute clauses to fn. Compute rows of
+// queries executed without it are discarded.
+//
+// fn is called while the rows of the query are read, after the rows the
+// compute row was computed of:
+//
+//	ctx = ase.WithComputeRows(ctx, func(row ase.ComputeRow) {
+//		fmt.Println(row.Columns[0].Operator, row.Values[0])
+//	})
+//	rows, err := db.QueryContext(ctx, "select a, b from t order by a compute sum(b) by a")
+//
+// Statements executed with ExecMulti return their compute rows in
+// ResultSet.ComputeRows instead.
+func WithComputeRows(ctx context.Context, fn func(ComputeRow)) context.Context {
+	return context.WithValue(ctx, computeRowsCtxKey{}, fn)
+}
+
+// computeRowsFn returns the function passed to WithComputeRows if ctx
+// is tagged with it.
+func computeRowsFn(ctx context.Context) func(ComputeRow) {
+	fn, _ := ctx.Value(computeRowsCtxKey{}).(func(ComputeRow))
+	return fn
+}
+
+// computeOperators are the aggregate functions of compute clauses by
+// their TDS operator.
+var computeOperators = map[uint8]string{
+	0x4B: "count",
+	0x4D: "sum",
+	0x4F: "avg",
+	0x51: "min",
+	0x52: "max",
+}
+
+// computeFmt is the format of the rows of a compute clause.
+type computeFmt struct {
+	columns   []ComputeColumn
+	fieldFmts []tds.FieldFmt
+	byColumns []int
+}
+
+// isComputePackage reports whether pkg holds compute tokens. go-dblib
+// does not parse TDS_ALTNAME, TDS_ALTFMT, TDS_ALTROW and
+// TDS_ALTCONTROL and passes them on as tokenless packages.
+func isComputePackage(pkg tds.Package) (*tds.TokenlessPackage, bool) {
+	tokenless, ok := pkg.(*tds.TokenlessPackage)
+	if !ok || tokenless.Data == nil || tokenless.Data.Len() == 0 {
+		return nil, false
+	}
+
+	switch tds.Token(tokenless.Data.Bytes()[0]) {
+	case tds.TDS_ALTNAME, tds.TDS_ALTFMT, tds.TDS_ALTROW, tds.TDS_ALTCONTROL:
+		return tokenless, true
+	}
+	return nil, false
+}
+
+// computeRows decodes the compute tokens of pkg and returns the
+// computed rows. The formats of the compute clauses are stored in the
+// rows for the compute rows following them.
+func (rows *Rows) computeRows(pkg *tds.TokenlessPackage) ([]ComputeRow, error) {
+	ch := tds.NewPacketQueue(func() int { return tds.PacketHeaderSize + pkg.Data.Len() })
+	ch.AddPacket(&tds.Packet{
+		Header: tds.PacketHeader{Status: tds.TDS_BUFSTAT_EOM},
+		Data:   pkg.Data.Bytes(),
+	})
+
+	var computed []ComputeRow
+	for !ch.AllPacketsConsumed() {
+		token, err := ch.Byte()
+		if err != nil {
+			return nil, err
+		}
+
+		if tds.Token(token) == tds.TDS_ALTROW {
+			row, err := rows.computeRow(ch)
+			if err != nil {
+				return nil, fmt.Errorf("go-ase: error reading compute row: %w", err)
+			}
+			computed = append(computed, row)
+			continue
+		}
+
+		length, err := ch.Uint16()
+		if err != nil {
+			return nil, fmt.Errorf("go-ase: error reading length of %s: %w", tds.Token(token), err)
+		}
+
+		data, err := ch.Bytes(int(length))
+		if err != nil {
+			return nil, fmt.Errorf("go-ase: error reading %s: %w", tds.Token(token), err)
+		}
+
+		switch tds.Token(token) {
+		case tds.TDS_ALTNAME:
+			err = rows.computeNames(data)
+		case tds.TDS_ALTFMT:
+			err = rows.computeFormat(data)
+		case tds.TDS_ALTCONTROL:
+			// The control information is only relevant to report
+			// writers.
+		default:
+			err = fmt.Errorf("unexpected token %s", tds.Token(token))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("go-ase: error reading compute format: %w", err)
+		}
+	}
+
+	return computed, nil
+}
+
+// handleCompute passes the rows computed by pkg to the function passed
+// to WithComputeRows.
+func (rows *Rows) handleCompute(pkg *tds.TokenlessPackage) error {
+	computed, err := rows.computeRows(pkg)
+	if err != nil {
+		return err
+	}
+
+	if rows.computeFn != nil {
+		for _, row := range computed {
+			rows.computeFn(row)
+		}
+	}
+	return nil
+}
+
+// computeFormatFor returns the format of the compute clause with id.
+func (rows *Rows) computeFormatFor(id uint16) *computeFmt {
+	if rows.computeFmts == nil {
+		rows.computeFmts = map[uint16]*computeFmt{}
+	}
+
+	format, ok := rows.computeFmts[id]
+	if !ok {
+		format = &computeFmt{}
+		rows.computeFmts[id] = format
+	}
+	return format
+}
+
+// computeNames reads the body of a TDS_ALTNAME token.
+func (rows *Rows) computeNames(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("%s too short", tds.TDS_ALTNAME)
+	}
+
+	format := rows.computeFormatFor(uint16(data[0]) | uint16(data[1])<<8)
+
+	names := []string{}
+	for i := 2; i < len(data); {
+		end := i + 1 + int(data[i])
+		if end > len(data) {
+			return fmt.Errorf("name of compute column %d exceeds %s", len(names), tds.TDS_ALTNAME)
+		}
+		names = append(names, string(data[i+1:end]))
+		i = end
+	}
+
+	if len(format.columns) < len(names) {
+		format.columns = append(format.columns, make([]ComputeColumn, len(names)-len(format.columns))...)
+	}
+	for i, name := range names {
+		if decoded, err := rows.Conn.decodeString(name); err == nil {
+			name = decoded
+		}
+		format.columns[i].Name = name
+	}
+
+	return nil
+}
+
+// computeFormat reads the body of a TDS_ALTFMT token.
+func (rows *Rows) computeFormat(data []byte) error {
+	ch := tds.NewPacketQueue(func() int { return tds.PacketHeaderSize + len(data) })
+	ch.AddPacket(&tds.Packet{
+		Header: tds.PacketHeader{Status: tds.TDS_BUFSTAT_EOM},
+		Data:   data,
+	})
+
+	id, err := ch.Uint16()
+	if err != nil {
+		return err
+	}
+
+	count, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+
+	format := rows.computeFormatFor(id)
+	columns := make([]ComputeColumn, count)
+	copy(columns, format.columns)
+	format.columns = columns
+	format.fieldFmts = make([]tds.FieldFmt, count)
+
+	for i := range columns {
+		if err := readComputeColumn(ch, &columns[i], &format.fieldFmts[i]); err != nil {
+			return fmt.Errorf("error reading compute column %d: %w", i, err)
+		}
+	}
+
+	byCount, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+
+	format.byColumns = make([]int, byCount)
+	for i := range format.byColumns {
+		column, err := ch.Uint8()
+		if err != nil {
+			return err
+		}
+		// The server sends one-based column numbers.
+		format.byColumns[i] = int(column) - 1
+	}
+
+	return nil
+}
+
+// readComputeColumn reads the format of a compute column.
+func readComputeColumn(ch *tds.PacketQueue, column *ComputeColumn, fieldFmt *tds.FieldFmt) error {
+	operator, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+
+	column.Operator = computeOperators[operator]
+	if column.Operator == "" {
+		column.Operator = fmt.Sprintf("operator %#x", operator)
+	}
+
+	operand, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+	column.Operand = int(operand) - 1
+
+	userType, err := ch.Int32()
+	if err != nil {
+		return err
+	}
+
+	dataType, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+
+	*fieldFmt, err = tds.LookupFieldFmt(asetypes.DataType(dataType))
+	if err != nil {
+		return err
+	}
+	(*fieldFmt).SetUserType(userType)
+
+	if _, err := (*fieldFmt).ReadFrom(ch); err != nil {
+		return err
+	}
+
+	localeLen, err := ch.Uint8()
+	if err != nil {
+		return err
+	}
+	if _, err := ch.Bytes(int(localeLen)); err != nil {
+		return err
+	}
+
+	column.DatabaseTypeName = unicodeTypeName(*fieldFmt)
+	if column.DatabaseTypeName == "" {
+		column.DatabaseTypeName = (*fieldFmt).DataType().String()
+	}
+
+	return nil
+}
+
+// computeRow reads the body of a TDS_ALTROW token.
+func (rows *Rows) computeRow(ch *tds.PacketQueue) (ComputeRow, error) {
+	id, err := ch.Uint16()
+	if err != nil {
+		return ComputeRow{}, err
+	}
+
+	format, ok := rows.computeFmts[id]
+	if !ok || format.fieldFmts == nil {
+		return ComputeRow{}, fmt.Errorf("received compute row %d without format", id)
+	}
+
+	row := ComputeRow{
+		ID:        int(id),
+		Columns:   format.columns,
+		ByColumns: format.byColumns,
+		Values:    make([]driver.Value, len(format.fieldFmts)),
+	}
+
+	cs := rows.Conn.charset()
+	for i, fieldFmt := range format.fieldFmts {
+		field, err := tds.LookupFieldData(fieldFmt)
+		if err != nil {
+			return ComputeRow{}, err
+		}
+
+		if _, err := field.ReadFrom(ch); err != nil {
+			return ComputeRow{}, fmt.Errorf("error reading value %d: %w", i, err)
+		}
+
+		if row.Values[i], err = rows.convertValue(i, field, cs); err != nil {
+			return ComputeRow{}, err
+		}
+	}
+
+	return row, nil
+}
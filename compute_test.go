@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// computeToken returns a compute token with its length prefixed body.
+func computeToken(token tds.Token, body ...byte) []byte {
+	bs := []byte{byte(token), 0, 0}
+	binary.LittleEndian.PutUint16(bs[1:], uint16(len(body)))
+	return append(bs, body...)
+}
+
+// computeFmtToken returns a TDS_ALTFMT of the compute clause with id
+// computing sum(b) of the second column with an INT4 by the first
+// column and count(*) with an INTN.
+func computeFmtToken(id byte) []byte {
+	return computeToken(tds.TDS_ALTFMT,
+		// ID and number of columns
+		id, 0, 2,
+		// sum of column 2: operator, operand, user type, data type
+		// and locale
+		0x4D, 2, 0, 0, 0, 0, byte(asetypes.INT4), 0,
+		// count of column 1 with a length of 4
+		0x4B, 1, 0, 0, 0, 0, byte(asetypes.INTN), 4, 0,
+		// by column 1
+		1, 1,
+	)
+}
+
+// computeRowToken returns a TDS_ALTROW of the compute clause with id.
+func computeRowToken(id byte, sum, count int32) []byte {
+	bs := []byte{byte(tds.TDS_ALTROW), id, 0}
+	bs = append(bs, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(bs[len(bs)-4:], uint32(sum))
+	bs = append(bs, 4, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(bs[len(bs)-4:], uint32(count))
+	return bs
+}
+
+func tokenless(tokens ...[]byte) *tds.TokenlessPackage {
+	return &tds.TokenlessPackage{Data: bytes.NewBuffer(bytes.Join(tokens, nil))}
+}
+
+func TestRows_computeRows(t *testing.T) {
+	columns := []ComputeColumn{
+		{Name: "sum", Operator: "sum", Operand: 1, DatabaseTypeName: "INT4"},
+		{Name: "count", Operator: "count", Operand: 0, DatabaseTypeName: "INTN"},
+	}
+
+	cases := map[string]struct {
+		pkgs      []*tds.TokenlessPackage
+		expect    []ComputeRow
+		expectErr bool
+	}{
+		"format and rows": {
+			pkgs: []*tds.TokenlessPackage{
+				tokenless(
+					computeToken(tds.TDS_ALTNAME, 1, 0, 3, 's', 'u', 'm', 5, 'c', 'o', 'u', 'n', 't'),
+					computeFmtToken(1),
+					computeToken(tds.TDS_ALTCONTROL, 0, 0),
+					computeRowToken(1, 10, 2),
+				),
+				tokenless(computeRowToken(1, 5, 1)),
+			},
+			expect: []ComputeRow{
+				{ID: 1, Columns: columns, ByColumns: []int{0}, Values: []driver.Value{int32(10), int32(2)}},
+				{ID: 1, Columns: columns, ByColumns: []int{0}, Values: []driver.Value{int32(5), int32(1)}},
+			},
+		},
+		"names after format": {
+			pkgs: []*tds.TokenlessPackage{
+				tokenless(computeFmtToken(2)),
+				tokenless(computeToken(tds.TDS_ALTNAME, 2, 0, 3, 's', 'u', 'm', 5, 'c', 'o', 'u', 'n', 't')),
+				tokenless(computeRowToken(2, 1, 1)),
+			},
+			expect: []ComputeRow{
+				{ID: 2, Columns: columns, ByColumns: []int{0}, Values: []driver.Value{int32(1), int32(1)}},
+			},
+		},
+		"row without format": {
+			pkgs:      []*tds.TokenlessPackage{tokenless(computeRowToken(1, 1, 1))},
+			expectErr: true,
+		},
+		"truncated format": {
+			pkgs:      []*tds.TokenlessPackage{tokenless(computeFmtToken(1)[:8])},
+			expectErr: true,
+		},
+		"truncated row": {
+			pkgs:      []*tds.TokenlessPackage{tokenless(computeFmtToken(1), computeRowToken(1, 1, 1)[:5])},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				computed := []ComputeRow{}
+				rows := &Rows{
+					Conn:      &Conn{session: &sessionState{}},
+					computeFn: func(row ComputeRow) { computed = append(computed, row) },
+				}
+
+				for _, pkg := range cas.pkgs {
+					if _, ok := isComputePackage(pkg); !ok {
+						t.Fatalf("Package not recognized as compute package: %v", pkg.Data.Bytes())
+					}
+
+					// Rows.Next passes compute rows on and continues
+					// reading.
+					ok, err := rows.handlePackage(pkg, nil)
+					if err != nil {
+						if !cas.expectErr {
+							t.Fatalf("Handling compute package failed: %v", err)
+						}
+						return
+					}
+					if ok {
+						t.Errorf("Expected reading to continue after compute package")
+					}
+				}
+
+				if cas.expectErr {
+					t.Fatalf("Expected an error, received %v", computed)
+				}
+
+				if !reflect.DeepEqual(computed, cas.expect) {
+					t.Errorf("Expected compute rows %v, received %v", cas.expect, computed)
+				}
+			},
+		)
+	}
+}
+
+func TestIsComputePackage(t *testing.T) {
+	cases := map[string]struct {
+		pkg    tds.Package
+		expect bool
+	}{
+		"compute format": {
+			pkg:    tokenless(computeFmtToken(1)),
+			expect: true,
+		},
+		"compute row": {
+			pkg:    tokenless(computeRowToken(1, 1, 1)),
+			expect: true,
+		},
+		"other token": {
+			pkg: tokenless([]byte{byte(tds.TDS_CURDECLARE)}),
+		},
+		"empty": {
+			pkg: tds.NewTokenlessPackage(),
+		},
+		"other package": {
+			pkg: &tds.DonePackage{},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if _, ok := isComputePackage(cas.pkg); ok != cas.expect {
+					t.Errorf("Expected %t, received %t", cas.expect, ok)
+				}
+			},
+		)
+	}
+}
+
+func TestWithComputeRows(t *testing.T) {
+	if fn := computeRowsFn(context.Background()); fn != nil {
+		t.Errorf("Expected no function without WithComputeRows")
+	}
+
+	called := false
+	ctx := WithComputeRows(context.Background(), func(ComputeRow) { called = true })
+	fn := computeRowsFn(ctx)
+	if fn == nil {
+		t.Fatalf("Expected the function passed to WithComputeRows")
+	}
+
+	fn(ComputeRow{})
+	if !called {
+		t.Errorf("Expected the function passed to WithComputeRows to be called")
+	}
+}
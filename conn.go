@@ -7,9 +7,14 @@ package ase
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/SAP/go-ase/internal/sqllex"
 	"github.com/SAP/go-dblib/dsn"
 	"github.com/SAP/go-dblib/tds"
 )
@@ -21,6 +26,9 @@ var (
 	_ driver.ExecerContext      = (*Conn)(nil)
 	_ driver.QueryerContext     = (*Conn)(nil)
 	_ driver.Pinger             = (*Conn)(nil)
+	_ driver.Validator          = (*Conn)(nil)
+	_ driver.SessionResetter    = (*Conn)(nil)
+	_ driver.NamedValueChecker  = (*Conn)(nil)
 )
 
 // Conn implements the driver.Conn interface.
@@ -29,6 +37,40 @@ type Conn struct {
 	Channel *tds.Channel
 	DSN     *dsn.Info
 
+	// transport is the connection to the server if it was established
+	// by go-ase.
+	transport net.Conn
+
+	// addr is the address of the server the connection is established
+	// to.
+	addr          string
+	health        *connHealth
+	failoverHooks []FailoverHook
+
+	// connector is used to reconnect if reconnect is enabled.
+	connector *Connector
+	reconnect bool
+	session   *sessionState
+	// txDepth is the number of open transactions.
+	txDepth int
+
+	location     *time.Location
+	timeRounding TimeRounding
+	codecs       *codecs
+
+	// strictReturnStatus is true if non-zero return statuses of stored
+	// procedures are reported as errors.
+	strictReturnStatus bool
+	// lastInsertID is true if the identity of rows inserted by insert
+	// statements is received.
+	lastInsertID bool
+	// placeholders configures the placeholders recognized in queries.
+	placeholders sqllex.Options
+	// closeAttentionRows is the number of remaining rows Rows.Close
+	// discards before it cancels the response with an attention. It
+	// is negative if the response is always read completely.
+	closeAttentionRows int
+
 	// TODO I don't particularly like locking statements like this
 	stmts map[int]*Stmt
 	// TODO: iirc conns aren't used in multiple threads at the same time
@@ -42,17 +84,128 @@ func NewConn(ctx context.Context, dsn *dsn.Info) (*Conn, error) {
 
 // NewConnWithHooks returns a connection with the passed configuration.
 func NewConnWithHooks(ctx context.Context, dsn *dsn.Info, envChangeHooks []tds.EnvChangeHook, eedHooks []tds.EEDHook) (*Conn, error) {
+	return newConn(ctx, &Connector{
+		DSN:            dsn,
+		EnvChangeHooks: envChangeHooks,
+		EEDHooks:       eedHooks,
+	})
+}
+
+// newConn returns a connection with the configuration of the
+// connector.
+//
+// If multiple servers are configured the servers are tried in order
+// until a connection is established.
+func newConn(ctx context.Context, connector *Connector) (*Conn, error) {
+	loginTimeout, err := strconv.Atoi(connector.DSN.PropDefault("login-timeout", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing login-timeout: %w", err)
+	}
+
+	if loginTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(loginTimeout)*time.Second)
+		defer cancel()
+	}
+
+	reconnect, err := strconv.ParseBool(connector.DSN.PropDefault("reconnect", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing reconnect: %w", err)
+	}
+
+	strictReturnStatus, err := strconv.ParseBool(connector.DSN.PropDefault("strict-return-status", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing strict-return-status: %w", err)
+	}
+
+	lastInsertID, err := strconv.ParseBool(connector.DSN.PropDefault("last-insert-id", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing last-insert-id: %w", err)
+	}
+
+	numberedPlaceholders, err := strconv.ParseBool(connector.DSN.PropDefault("numbered-placeholders", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing numbered-placeholders: %w", err)
+	}
+
+	closeAttentionRows, err := strconv.Atoi(connector.DSN.PropDefault("close-attention-rows", "-1"))
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing close-attention-rows: %w", err)
+	}
+
+	location, timeRounding, err := timeSettings(connector)
+	if err != nil {
+		return nil, err
+	}
+
+	codecs, err := newCodecs(connector)
+	if err != nil {
+		return nil, err
+	}
+
+	if charset := connector.DSN.PropDefault("charset", ""); charset != "" {
+		if _, ok := lookupCharset(charset); !ok {
+			return nil, fmt.Errorf("go-ase: unsupported charset %s", charset)
+		}
+	}
+
+	addrs, err := serverAddrs(connector.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing server addresses: %w", err)
+	}
+
+	// TODO follow login redirections of HADR and cluster edition
+	// servers once go-dblib requests the capability and exposes the
+	// redirection sent with the login acknowledgement.
+	for i, addr := range addrs {
+		serverConnector := *connector
+		serverInfo := *connector.DSN
+		serverInfo.Host, serverInfo.Port = addr.host, addr.port
+		serverConnector.DSN = &serverInfo
+
+		conn, err := connectServer(ctx, &serverConnector)
+		if err == nil {
+			conn.connector = connector
+			conn.reconnect = reconnect
+			conn.location = location
+			conn.timeRounding = timeRounding
+			conn.codecs = codecs
+			conn.strictReturnStatus = strictReturnStatus
+			conn.lastInsertID = lastInsertID
+			conn.placeholders = sqllex.Options{Numbered: numberedPlaceholders}
+			conn.closeAttentionRows = closeAttentionRows
+			return conn, nil
+		}
+
+		if ctx.Err() != nil || i == len(addrs)-1 {
+			return nil, err
+		}
+
+		callFailoverHooks(connector, addr.String(), addrs[i+1].String(), err)
+	}
+
+	// unreachable, serverAddrs returns at least one address
+	return nil, errors.New("go-ase: no server configured")
+}
+
+// connectServer returns a connection to the server configured in the
+// DSN of the connector.
+func connectServer(ctx context.Context, connector *Connector) (*Conn, error) {
+	dsn := connector.DSN
+	envChangeHooks := connector.EnvChangeHooks
+	eedHooks := connector.EEDHooks
+
 	conn := &Conn{
-		stmts:    map[int]*Stmt{},
-		stmtLock: &sync.RWMutex{},
+		addr:          net.JoinHostPort(dsn.Host, dsn.Port),
+		health:        &connHealth{},
+		failoverHooks: connector.FailoverHooks,
+		session:       newSessionState(),
+		stmts:         map[int]*Stmt{},
+		stmtLock:      &sync.RWMutex{},
 	}
 
-	// Cannot pass the passed context along here as tds.NewConn creates
-	// a child context from the passed context.
-	// Otherwise the context isn't being used, so using
-	// context.Background is fine.
 	var err error
-	conn.Conn, err = tds.NewConn(context.Background(), dsn)
+	conn.Conn, conn.transport, err = openTDSConn(ctx, connector)
 	if err != nil {
 		return nil, fmt.Errorf("go-ase: error opening connection to TDS server: %w", err)
 	}
@@ -63,6 +216,10 @@ func NewConnWithHooks(ctx context.Context, dsn *dsn.Info, envChangeHooks []tds.E
 		return nil, fmt.Errorf("go-ase: error opening logical channel: %w", err)
 	}
 
+	if err := conn.Channel.RegisterEnvChangeHooks(conn.session.envChangeHook()); err != nil {
+		return nil, fmt.Errorf("go-ase: error registering session EnvChangeHook: %w", err)
+	}
+
 	if drv.envChangeHooks != nil {
 		if err := conn.Channel.RegisterEnvChangeHooks(drv.envChangeHooks...); err != nil {
 			return nil, fmt.Errorf("go-ase: error registering driver EnvChangeHooks: %w", err)
@@ -87,6 +244,18 @@ func NewConnWithHooks(ctx context.Context, dsn *dsn.Info, envChangeHooks []tds.E
 		}
 	}
 
+	failoverMessages, err := parseFailoverMessages(dsn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("go-ase: error parsing failover-messages: %w", err)
+	}
+
+	if len(failoverMessages) > 0 {
+		if err := conn.Channel.RegisterEEDHooks(conn.failoverEEDHook(failoverMessages)); err != nil {
+			return nil, fmt.Errorf("go-ase: error registering failover EEDHook: %w", err)
+		}
+	}
+
 	loginConfig, err := tds.NewLoginConfig(dsn)
 	if err != nil {
 		conn.Close()
@@ -95,14 +264,29 @@ func NewConnWithHooks(ctx context.Context, dsn *dsn.Info, envChangeHooks []tds.E
 
 	loginConfig.AppName = dsn.PropDefault("appname", "github.com/SAP/go-ase/purego")
 
+	// The server reports the charset of the session if it differs.
+	loginConfig.CharSet = dsn.PropDefault("charset", loginConfig.CharSet)
+	conn.session.charset = loginConfig.CharSet
+
 	if err := conn.Channel.Login(ctx, loginConfig); err != nil {
+		if ctx.Err() != nil {
+			conn.abort()
+			return nil, fmt.Errorf("go-ase: error logging in: %w", ctx.Err())
+		}
 		conn.Close()
 		return nil, fmt.Errorf("go-ase: error logging in: %w", err)
 	}
 
-	// TODO can this be passed another way?
-	if dsn.Database != "" {
-		if _, err = conn.ExecContext(ctx, "use "+dsn.Database, nil); err != nil {
+	// The TDS 5.0 login record has no field for the database. The
+	// database is only switched if the default database of the login
+	// reported during the login differs.
+	if dsn.Database != "" && dsn.Database != conn.CurrentDatabase() {
+		if err := conn.languageExec(ctx, "use "+quoteIdentifier(dsn.Database)); err != nil {
+			if ctx.Err() != nil {
+				conn.abort()
+				return nil, fmt.Errorf("go-ase: error switching to database %s: %w", dsn.Database, ctx.Err())
+			}
+			conn.Close()
 			return nil, fmt.Errorf("go-ase: error switching to database %s: %w", dsn.Database, err)
 		}
 	}
@@ -119,12 +303,29 @@ func (c *Conn) Close() error {
 	return nil
 }
 
+// abort closes the connection without waiting for the server to
+// acknowledge the logout.
+//
+// If go-dblib established the connection it cannot be closed directly
+// and the logout is completed in the background instead.
+func (c *Conn) abort() {
+	if c.transport != nil {
+		c.transport.Close()
+	}
+
+	go c.Conn.Close()
+}
+
 // ExecContext implements the driver.ExecerContext.
 func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
 	rows, result, err := c.GenericExec(ctx, query, args)
 
+	// Result sets are discarded, errors of the discarded response are
+	// returned.
 	if rows != nil {
-		rows.Close()
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			return nil, closeErr
+		}
 	}
 
 	return result, err
@@ -136,12 +337,72 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 	return rows, err
 }
 
+// CheckNamedValue implements the driver.NamedValueChecker interface.
+//
+// Arguments are checked to be of a type supported by ASE and
+// driver.Valuers are resolved. Statements with arguments are prepared
+// as dynamic SQL and their arguments are converted according to the
+// parameters of the statement by Stmt.CheckNamedValue, the same as
+// arguments of prepared statements.
+//
+// Output parameters (sql.Out) are rejected. Dynamic SQL only passes
+// input parameters to the server and does not return parameter values,
+// hence output parameters of stored procedures cannot be retrieved
+// through arguments.
+func (c *Conn) CheckNamedValue(named *driver.NamedValue) error {
+	if _, ok := c.codecs.param(named.Value); ok {
+		return nil
+	}
+
+	list, ok := named.Value.(InList)
+	if !ok {
+		value, err := checkArgument(named.Value)
+		if err != nil {
+			return err
+		}
+		named.Value = value
+		return nil
+	}
+
+	if list.err != nil {
+		return list.err
+	}
+
+	values := make([]interface{}, len(list.values))
+	for i, value := range list.values {
+		if _, ok := c.codecs.param(value); ok {
+			values[i] = value
+			continue
+		}
+
+		checked, err := checkArgument(value)
+		if err != nil {
+			return fmt.Errorf("go-ase: error checking element %d of InList: %w", i, err)
+		}
+		values[i] = checked
+	}
+	named.Value = InList{values: values}
+
+	return nil
+}
+
 // Ping implements the driver.Pinger interface.
-func (c Conn) Ping(ctx context.Context) error {
-	// TODO implement ErrBadConn check
+func (c *Conn) Ping(ctx context.Context) error {
+	if err := c.ensureValid(ctx); err != nil {
+		return err
+	}
+
 	rows, _, err := c.language(ctx, "select 'ping'")
 	if err != nil {
-		return fmt.Errorf("go-ase: error pinging database: %w", err)
+		c.checkConnErr(err)
+		if !c.retryAfterReconnect(ctx, true) {
+			return fmt.Errorf("go-ase: error pinging database: %w", err)
+		}
+
+		if rows, _, err = c.language(ctx, "select 'ping'"); err != nil {
+			c.checkConnErr(err)
+			return fmt.Errorf("go-ase: error pinging database: %w", err)
+		}
 	}
 
 	if err := rows.Close(); err != nil {
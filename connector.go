@@ -6,8 +6,10 @@ package ase
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql/driver"
 	"fmt"
+	"time"
 
 	"github.com/SAP/go-dblib/dsn"
 	"github.com/SAP/go-dblib/tds"
@@ -23,6 +25,48 @@ type Connector struct {
 	DSN            *dsn.Info
 	EnvChangeHooks []tds.EnvChangeHook
 	EEDHooks       []tds.EEDHook
+
+	// Dialer is used to connect to the server if set. Otherwise the
+	// connection is established by go-dblib based on the DSN.
+	//
+	// The context passed to Connect is passed to the dialer.
+	Dialer Dialer
+
+	// TLSConfig is used to establish TLS connections if set. The TLS
+	// options of the DSN are ignored and TLS is used regardless of the
+	// tls property.
+	//
+	// If TLSConfig.ServerName is empty the hostname is taken from the
+	// DSN.
+	TLSConfig *tls.Config
+
+	// FailoverHooks are called when go-ase fails over to another
+	// server.
+	FailoverHooks []FailoverHook
+
+	// ReconnectHooks are called when go-ase reconnected a lost
+	// connection. Reconnecting is enabled with the reconnect property.
+	ReconnectHooks []ReconnectHook
+
+	// Location is the time zone the values of date and time types are
+	// interpreted in and time.Time parameters are converted into. If
+	// nil the location property is used, without it values are
+	// returned in UTC and parameters are sent with their wall clock.
+	Location *time.Location
+
+	// TimeRounding defines how time.Time parameters are adjusted to
+	// the precision of the data type. If zero the time-rounding
+	// property is used.
+	TimeRounding TimeRounding
+
+	// ParamCodecs convert parameters of custom Go types. They take
+	// precedence over codecs added with AddParamCodecs.
+	ParamCodecs []ParamCodec
+
+	// ResultCodecs convert values of result columns into custom Go
+	// types. They take precedence over codecs added with
+	// AddResultCodecs.
+	ResultCodecs []ResultCodec
 }
 
 // NewConnector returns a new connector with the passed configuration.
@@ -61,5 +105,5 @@ func (c Connector) Driver() driver.Driver {
 
 // Connect implements the driver.Connector interface.
 func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return NewConnWithHooks(ctx, c.DSN, c.EnvChangeHooks, c.EEDHooks)
+	return newConn(ctx, c)
 }
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// resolveValuer returns the value of a driver.Valuer. Other values are
+// returned as is.
+//
+// Like database/sql nil pointers whose Value method has a value
+// receiver are resolved to nil.
+func resolveValuer(value interface{}) (interface{}, error) {
+	valuer, ok := value.(driver.Valuer)
+	if !ok {
+		return value, nil
+	}
+
+	if rv := reflect.ValueOf(valuer); rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+		return nil, nil
+	}
+
+	resolved, err := valuer.Value()
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error calling Value of %T: %w", value, err)
+	}
+
+	return resolved, nil
+}
+
+// checkInteger converts signed and unsigned integers to the Go type of
+// the integer data type of fieldFmt. The second return value is false
+// if value is not an integer or fieldFmt is not an integer data type.
+//
+// go-dblib does not check the range and panics when converting
+// unsigned integers to signed data types and vice versa.
+func checkInteger(fieldFmt tds.FieldFmt, value interface{}) (interface{}, bool, error) {
+	var neg bool
+	var mag uint64
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		neg = i < 0
+		mag = uint64(i)
+		if neg {
+			mag = uint64(-(i + 1)) + 1
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		mag = rv.Uint()
+	default:
+		return nil, false, nil
+	}
+
+	var lower, upper uint64
+	var convert func() interface{}
+
+	switch fieldFmt.DataType() {
+	case asetypes.INT1:
+		upper, convert = math.MaxUint8, func() interface{} { return uint8(mag) }
+	case asetypes.INT2:
+		lower, upper, convert = -math.MinInt16, math.MaxInt16, func() interface{} { return int16(signed(neg, mag)) }
+	case asetypes.INT4:
+		lower, upper, convert = -math.MinInt32, math.MaxInt32, func() interface{} { return int32(signed(neg, mag)) }
+	case asetypes.INT8, asetypes.INTN:
+		lower, upper, convert = -math.MinInt64, math.MaxInt64, func() interface{} { return signed(neg, mag) }
+	case asetypes.UINT2:
+		upper, convert = math.MaxUint16, func() interface{} { return uint16(mag) }
+	case asetypes.UINT4:
+		upper, convert = math.MaxUint32, func() interface{} { return uint32(mag) }
+	case asetypes.UINT8, asetypes.UINTN:
+		upper, convert = math.MaxUint64, func() interface{} { return mag }
+	default:
+		return nil, false, nil
+	}
+
+	if (neg && mag > lower) || (!neg && mag > upper) {
+		return nil, true, fmt.Errorf("go-ase: %v overflows %s", value, fieldFmt.DataType())
+	}
+
+	return convert(), true, nil
+}
+
+// signed returns the int64 with the sign neg and the magnitude mag.
+func signed(neg bool, mag uint64) int64 {
+	if neg {
+		return -int64(mag-1) - 1
+	}
+	return int64(mag)
+}
+
+// checkArgument checks that value can be sent as an argument of a
+// statement and resolves driver.Valuers. The conversion to the data
+// type of the parameter is done by Stmt.CheckNamedValue once the
+// statement is prepared.
+func checkArgument(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case sql.Out:
+		return nil, fmt.Errorf("go-ase: output parameters are not supported")
+	case InList:
+		return nil, fmt.Errorf("go-ase: InLists cannot be nested")
+	case UniChar, Decimal, *Decimal, NullDecimal:
+		return value, nil
+	}
+
+	resolved, err := resolveValuer(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resolved.(type) {
+	case nil, bool, string, []byte, time.Time, UniChar, Decimal, *Decimal, NullDecimal:
+		return resolved, nil
+	}
+
+	// go-dblib converts integers and floats by their kind.
+	switch reflect.ValueOf(resolved).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return resolved, nil
+	}
+
+	if _, ok := value.(driver.Valuer); ok {
+		return nil, fmt.Errorf("go-ase: unsupported type %T returned by Value of %T", resolved, value)
+	}
+	return nil, fmt.Errorf("go-ase: unsupported argument type %T", value)
+}
@@ -0,0 +1,344 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+type valueValuer struct{ value interface{} }
+
+func (v valueValuer) Value() (driver.Value, error) { return v.value, nil }
+
+type pointerValuer struct{ value interface{} }
+
+func (v *pointerValuer) Value() (driver.Value, error) {
+	if v == nil {
+		return "nil receiver", nil
+	}
+	return v.value, nil
+}
+
+type failingValuer struct{}
+
+func (failingValuer) Value() (driver.Value, error) { return nil, errors.New("no value") }
+
+type namedInt int32
+
+func TestResolveValuer(t *testing.T) {
+	cases := map[string]struct {
+		value     interface{}
+		expect    interface{}
+		expectErr bool
+	}{
+		"no valuer": {
+			value:  "a",
+			expect: "a",
+		},
+		"value receiver": {
+			value:  valueValuer{int64(1)},
+			expect: int64(1),
+		},
+		"nil pointer with value receiver": {
+			value:  (*valueValuer)(nil),
+			expect: nil,
+		},
+		"pointer receiver": {
+			value:  &pointerValuer{"b"},
+			expect: "b",
+		},
+		"nil pointer with pointer receiver": {
+			value:  (*pointerValuer)(nil),
+			expect: "nil receiver",
+		},
+		"null string": {
+			value:  sql.NullString{},
+			expect: nil,
+		},
+		"error": {
+			value:     failingValuer{},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				resolved, err := resolveValuer(cas.value)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %v", resolved)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Resolving failed: %v", err)
+				}
+
+				if !reflect.DeepEqual(resolved, cas.expect) {
+					t.Errorf("Expected %T(%v), received %T(%v)", cas.expect, cas.expect, resolved, resolved)
+				}
+			},
+		)
+	}
+}
+
+func TestCheckInteger(t *testing.T) {
+	cases := map[string]struct {
+		dataType    asetypes.DataType
+		value       interface{}
+		expect      interface{}
+		expectNoInt bool
+		expectErr   bool
+	}{
+		"tinyint": {
+			dataType: asetypes.INT1,
+			value:    255,
+			expect:   uint8(255),
+		},
+		"tinyint overflow": {
+			dataType:  asetypes.INT1,
+			value:     256,
+			expectErr: true,
+		},
+		"tinyint negative": {
+			dataType:  asetypes.INT1,
+			value:     -1,
+			expectErr: true,
+		},
+		"smallint minimum": {
+			dataType: asetypes.INT2,
+			value:    math.MinInt16,
+			expect:   int16(math.MinInt16),
+		},
+		"smallint underflow": {
+			dataType:  asetypes.INT2,
+			value:     math.MinInt16 - 1,
+			expectErr: true,
+		},
+		"int from unsigned": {
+			dataType: asetypes.INT4,
+			value:    uint32(math.MaxInt32),
+			expect:   int32(math.MaxInt32),
+		},
+		"int overflow from unsigned": {
+			dataType:  asetypes.INT4,
+			value:     uint32(math.MaxInt32 + 1),
+			expectErr: true,
+		},
+		"bigint minimum": {
+			dataType: asetypes.INT8,
+			value:    int64(math.MinInt64),
+			expect:   int64(math.MinInt64),
+		},
+		"bigint overflow from unsigned": {
+			dataType:  asetypes.INT8,
+			value:     uint64(math.MaxInt64 + 1),
+			expectErr: true,
+		},
+		"nullable int": {
+			dataType: asetypes.INTN,
+			value:    int8(-5),
+			expect:   int64(-5),
+		},
+		"unsigned smallint": {
+			dataType: asetypes.UINT2,
+			value:    math.MaxUint16,
+			expect:   uint16(math.MaxUint16),
+		},
+		"unsigned int negative": {
+			dataType:  asetypes.UINT4,
+			value:     -1,
+			expectErr: true,
+		},
+		"unsigned bigint maximum": {
+			dataType: asetypes.UINT8,
+			value:    uint64(math.MaxUint64),
+			expect:   uint64(math.MaxUint64),
+		},
+		"nullable unsigned int from signed": {
+			dataType: asetypes.UINTN,
+			value:    int64(math.MaxInt64),
+			expect:   uint64(math.MaxInt64),
+		},
+		"named type": {
+			dataType: asetypes.INT2,
+			value:    namedInt(-3),
+			expect:   int16(-3),
+		},
+		"float value": {
+			dataType:    asetypes.INT4,
+			value:       1.0,
+			expectNoInt: true,
+		},
+		"float data type": {
+			dataType:    asetypes.FLT8,
+			value:       1,
+			expectNoInt: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				fieldFmt, err := tds.LookupFieldFmt(cas.dataType)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				converted, isInt, err := checkInteger(fieldFmt, cas.value)
+				if isInt == cas.expectNoInt {
+					t.Fatalf("Expected checkInteger to report %t, received %t", !cas.expectNoInt, isInt)
+				}
+
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %T(%v)", converted, converted)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Checking failed: %v", err)
+				}
+
+				if converted != cas.expect {
+					t.Errorf("Expected %T(%v), received %T(%v)", cas.expect, cas.expect, converted, converted)
+				}
+			},
+		)
+	}
+}
+
+func TestCheckArgument(t *testing.T) {
+	now := time.Now()
+	decimal := DecimalFromInt64(1)
+
+	cases := map[string]struct {
+		value     interface{}
+		expect    interface{}
+		expectErr bool
+	}{
+		"nil":                {value: nil, expect: nil},
+		"bool":               {value: true, expect: true},
+		"string":             {value: "a", expect: "a"},
+		"bytes":              {value: []byte{1}, expect: []byte{1}},
+		"time":               {value: now, expect: now},
+		"int":                {value: 1, expect: 1},
+		"unsigned bigint":    {value: uint64(math.MaxUint64), expect: uint64(math.MaxUint64)},
+		"named integer":      {value: namedInt(2), expect: namedInt(2)},
+		"float32":            {value: float32(1.5), expect: float32(1.5)},
+		"unichar":            {value: UniChar("ü"), expect: UniChar("ü")},
+		"decimal":            {value: decimal, expect: decimal},
+		"decimal pointer":    {value: &decimal, expect: &decimal},
+		"null decimal":       {value: NullDecimal{}, expect: NullDecimal{}},
+		"valuer":             {value: valueValuer{uint64(3)}, expect: uint64(3)},
+		"null valuer":        {value: sql.NullInt64{}, expect: nil},
+		"valuer of decimal":  {value: valueValuer{decimal}, expect: decimal},
+		"valuer error":       {value: failingValuer{}, expectErr: true},
+		"valuer of struct":   {value: valueValuer{struct{}{}}, expectErr: true},
+		"output parameter":   {value: sql.Out{Dest: new(int)}, expectErr: true},
+		"nested in list":     {value: In([]int{1}), expectErr: true},
+		"struct":             {value: struct{}{}, expectErr: true},
+		"map":                {value: map[string]int{}, expectErr: true},
+		"int slice":          {value: []int{1}, expectErr: true},
+		"pointer to integer": {value: new(int), expectErr: true},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				checked, err := checkArgument(cas.value)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %T(%v)", checked, checked)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Checking failed: %v", err)
+				}
+
+				if !reflect.DeepEqual(checked, cas.expect) {
+					t.Errorf("Expected %T(%v), received %T(%v)", cas.expect, cas.expect, checked, checked)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_CheckNamedValue(t *testing.T) {
+	c := &Conn{
+		codecs: &codecs{
+			params: map[reflect.Type]ParamCodec{
+				reflect.TypeOf(codecID{}): {
+					Type:   reflect.TypeOf(codecID{}),
+					Encode: func(value interface{}) (interface{}, error) { return nil, nil },
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		value     interface{}
+		expect    interface{}
+		expectErr bool
+	}{
+		"value": {
+			value:  int8(1),
+			expect: int8(1),
+		},
+		"valuer": {
+			value:  sql.NullString{String: "a", Valid: true},
+			expect: "a",
+		},
+		"codec": {
+			value:  codecID{1, 2},
+			expect: codecID{1, 2},
+		},
+		"unsupported": {
+			value:     struct{}{},
+			expectErr: true,
+		},
+		"in list": {
+			value:  In([]interface{}{1, sql.NullInt64{Int64: 2, Valid: true}, codecID{3}}),
+			expect: InList{values: []interface{}{1, int64(2), codecID{3}}},
+		},
+		"in list with unsupported element": {
+			value:     In([]interface{}{1, struct{}{}}),
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				named := driver.NamedValue{Ordinal: 1, Value: cas.value}
+				err := c.CheckNamedValue(&named)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %T(%v)", named.Value, named.Value)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Checking failed: %v", err)
+				}
+
+				if !reflect.DeepEqual(named.Value, cas.expect) {
+					t.Errorf("Expected %T(%v), received %T(%v)", cas.expect, cas.expect, named.Value, named.Value)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// TimeRounding defines how time.Time parameters are adjusted to the
+// precision of ASE date and time types.
+//
+// datetime and time have a precision of 1/300 seconds, smalldatetime of
+// one minute and bigdatetime and bigtime of one microsecond.
+type TimeRounding int
+
+const (
+	// TimeRound rounds to the nearest value of the data type.
+	TimeRound TimeRounding = iota + 1
+	// TimeTruncate truncates to the previous value of the data type.
+	TimeTruncate
+	// TimeError returns an error if the value cannot be represented
+	// by the data type.
+	TimeError
+)
+
+func (rounding TimeRounding) String() string {
+	switch rounding {
+	case TimeRound:
+		return "round"
+	case TimeTruncate:
+		return "truncate"
+	case TimeError:
+		return "error"
+	default:
+		return fmt.Sprintf("TimeRounding(%d)", int(rounding))
+	}
+}
+
+// parseTimeRounding parses the time-rounding property.
+func parseTimeRounding(s string) (TimeRounding, error) {
+	for _, rounding := range []TimeRounding{TimeRound, TimeTruncate, TimeError} {
+		if s == rounding.String() {
+			return rounding, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown time rounding %q", s)
+}
+
+// timeSettings returns the location and time rounding of the
+// connector. The fields of the connector take precedence over the
+// properties of the DSN.
+func timeSettings(connector *Connector) (*time.Location, TimeRounding, error) {
+	location := connector.Location
+	if location == nil {
+		if name := connector.DSN.PropDefault("location", ""); name != "" {
+			var err error
+			location, err = time.LoadLocation(name)
+			if err != nil {
+				return nil, 0, fmt.Errorf("go-ase: error loading location: %w", err)
+			}
+		}
+	}
+
+	rounding := connector.TimeRounding
+	if rounding == 0 {
+		var err error
+		rounding, err = parseTimeRounding(connector.DSN.PropDefault("time-rounding", "round"))
+		if err != nil {
+			return nil, 0, fmt.Errorf("go-ase: error parsing time-rounding: %w", err)
+		}
+	}
+
+	return location, rounding, nil
+}
+
+// inLocation returns t with the wall clock of t in loc.
+//
+// Date and time types of ASE have no time zone, go-dblib returns them
+// in UTC.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// timeResolution returns the resolution of the data type of fieldFmt as
+// fraction num/den of nanoseconds. Zero is returned for types that are
+// not adjusted.
+func timeResolution(fieldFmt tds.FieldFmt) (num, den int64) {
+	switch fieldFmt.DataType() {
+	case asetypes.DATETIME, asetypes.TIME, asetypes.TIMEN:
+		return int64(time.Second), 300
+	case asetypes.SHORTDATE:
+		return int64(time.Minute), 1
+	case asetypes.DATETIMEN:
+		// DATETIMEN is either datetime or smalldatetime.
+		if fieldFmt.MaxLength() == 4 {
+			return int64(time.Minute), 1
+		}
+		return int64(time.Second), 300
+	case asetypes.BIGDATETIMEN, asetypes.BIGTIMEN:
+		return int64(time.Microsecond), 1
+	default:
+		return 0, 0
+	}
+}
+
+// checkTime converts t into the location of the connection and adjusts
+// it to the precision of the data type of fieldFmt.
+func (c *Conn) checkTime(fieldFmt tds.FieldFmt, t time.Time) (time.Time, error) {
+	if c.location != nil {
+		t = t.In(c.location)
+	}
+
+	num, den := timeResolution(fieldFmt)
+	if num == 0 {
+		return t, nil
+	}
+
+	year, month, day := t.Date()
+	ns := int64(t.Hour())*int64(time.Hour) + int64(t.Minute())*int64(time.Minute) +
+		int64(t.Second())*int64(time.Second) + int64(t.Nanosecond())
+
+	ticks := ns * den / num
+	rem := ns*den - ticks*num
+	if rem == 0 {
+		return t, nil
+	}
+
+	switch c.timeRounding {
+	case TimeError:
+		return time.Time{}, fmt.Errorf("go-ase: %s cannot be represented as %s without losing precision",
+			t.Format(time.RFC3339Nano), fieldFmt.DataType())
+	case TimeRound:
+		if 2*rem >= num {
+			ticks++
+		}
+	}
+
+	// The nanoseconds are truncated, go-dblib rounds to the nearest
+	// value of the data type when encoding. Rounding up at the end of
+	// the day is normalized to the next day by time.Date.
+	ns = ticks * num / den
+	return time.Date(year, month, day, 0, 0, int(ns/int64(time.Second)), int(ns%int64(time.Second)), t.Location()), nil
+}
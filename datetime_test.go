@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// lengthFmt overrides the maximum length of a field format.
+type lengthFmt struct {
+	tds.FieldFmt
+	length int64
+}
+
+func (f lengthFmt) MaxLength() int64 {
+	return f.length
+}
+
+func TestConn_checkTime(t *testing.T) {
+	day := func(hour, min, sec, nsec int) time.Time {
+		return time.Date(2020, 12, 31, hour, min, sec, nsec, time.UTC)
+	}
+
+	cases := map[string]struct {
+		dataType  asetypes.DataType
+		length    int64
+		rounding  TimeRounding
+		input     time.Time
+		expect    time.Time
+		expectErr bool
+	}{
+		"datetime exact": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeError,
+			input:    day(12, 0, 0, 10000000),
+			expect:   day(12, 0, 0, 10000000),
+		},
+		"datetime round down": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 1000000),
+			expect:   day(12, 0, 0, 0),
+		},
+		"datetime round up": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 2000000),
+			expect:   day(12, 0, 0, 3333333),
+		},
+		"datetime below half tick": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 1666666),
+			expect:   day(12, 0, 0, 0),
+		},
+		"datetime above half tick": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 1666667),
+			expect:   day(12, 0, 0, 3333333),
+		},
+		"datetime round to next second": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 999000000),
+			expect:   day(12, 0, 1, 0),
+		},
+		"datetime round to next day": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeRound,
+			input:    day(23, 59, 59, 999000000),
+			expect:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"datetime truncate": {
+			dataType: asetypes.DATETIME,
+			rounding: TimeTruncate,
+			input:    day(23, 59, 59, 999000000),
+			expect:   day(23, 59, 59, 996666666),
+		},
+		"datetime error": {
+			dataType:  asetypes.DATETIME,
+			rounding:  TimeError,
+			input:     day(12, 0, 0, 1000000),
+			expectErr: true,
+		},
+		"time round up": {
+			dataType: asetypes.TIMEN,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 2000000),
+			expect:   day(12, 0, 0, 3333333),
+		},
+		"smalldatetime below half minute": {
+			dataType: asetypes.SHORTDATE,
+			rounding: TimeRound,
+			input:    day(12, 0, 29, 999999999),
+			expect:   day(12, 0, 0, 0),
+		},
+		"smalldatetime half minute": {
+			dataType: asetypes.SHORTDATE,
+			rounding: TimeRound,
+			input:    day(12, 0, 30, 0),
+			expect:   day(12, 1, 0, 0),
+		},
+		"smalldatetime round to next day": {
+			dataType: asetypes.SHORTDATE,
+			rounding: TimeRound,
+			input:    day(23, 59, 30, 0),
+			expect:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"smalldatetime truncate": {
+			dataType: asetypes.SHORTDATE,
+			rounding: TimeTruncate,
+			input:    day(12, 0, 59, 0),
+			expect:   day(12, 0, 0, 0),
+		},
+		"smalldatetime error": {
+			dataType:  asetypes.SHORTDATE,
+			rounding:  TimeError,
+			input:     day(12, 0, 1, 0),
+			expectErr: true,
+		},
+		"nullable smalldatetime": {
+			dataType: asetypes.DATETIMEN,
+			length:   4,
+			rounding: TimeRound,
+			input:    day(12, 0, 30, 0),
+			expect:   day(12, 1, 0, 0),
+		},
+		"nullable datetime": {
+			dataType: asetypes.DATETIMEN,
+			length:   8,
+			rounding: TimeRound,
+			input:    day(12, 0, 30, 2000000),
+			expect:   day(12, 0, 30, 3333333),
+		},
+		"bigdatetime round up": {
+			dataType: asetypes.BIGDATETIMEN,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 1500),
+			expect:   day(12, 0, 0, 2000),
+		},
+		"bigdatetime round down": {
+			dataType: asetypes.BIGDATETIMEN,
+			rounding: TimeRound,
+			input:    day(12, 0, 0, 1499),
+			expect:   day(12, 0, 0, 1000),
+		},
+		"bigtime error": {
+			dataType:  asetypes.BIGTIMEN,
+			rounding:  TimeError,
+			input:     day(12, 0, 0, 1),
+			expectErr: true,
+		},
+		"other data type": {
+			dataType: asetypes.VARCHAR,
+			rounding: TimeError,
+			input:    day(12, 0, 0, 1),
+			expect:   day(12, 0, 0, 1),
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				fieldFmt, err := tds.LookupFieldFmt(cas.dataType)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c := &Conn{timeRounding: cas.rounding}
+				adjusted, err := c.checkTime(lengthFmt{fieldFmt, cas.length}, cas.input)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %s", adjusted.Format(time.RFC3339Nano))
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("checkTime failed: %v", err)
+				}
+
+				if !adjusted.Equal(cas.expect) {
+					t.Errorf("Expected %s, received %s",
+						cas.expect.Format(time.RFC3339Nano), adjusted.Format(time.RFC3339Nano))
+				}
+			},
+		)
+	}
+}
+
+func TestConn_checkTimeLocation(t *testing.T) {
+	fieldFmt, err := tds.LookupFieldFmt(asetypes.BIGDATETIMEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	c := &Conn{location: loc, timeRounding: TimeError}
+
+	adjusted, err := c.checkTime(fieldFmt, time.Date(2020, 12, 31, 23, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := time.Date(2021, 1, 1, 1, 0, 0, 0, loc); !adjusted.Equal(expect) || adjusted.Location() != loc {
+		t.Errorf("Expected %s, received %s", expect, adjusted)
+	}
+
+	// The wall clock of values read from the server is kept.
+	read := inLocation(time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC), loc)
+	if !read.Equal(adjusted) {
+		t.Errorf("Expected %s, received %s", adjusted, read)
+	}
+}
+
+func TestParseTimeRounding(t *testing.T) {
+	for _, rounding := range []TimeRounding{TimeRound, TimeTruncate, TimeError} {
+		parsed, err := parseTimeRounding(rounding.String())
+		if err != nil || parsed != rounding {
+			t.Errorf("Expected %s to be parsed, received %s: %v", rounding, parsed, err)
+		}
+	}
+
+	if _, err := parseTimeRounding("nearest"); err == nil {
+		t.Errorf("Expected parsing unknown rounding to fail")
+	}
+}
@@ -0,0 +1,542 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Interface satisfaction checks.
+var (
+	_ sql.Scanner   = (*Decimal)(nil)
+	_ driver.Valuer = Decimal{}
+	_ sql.Scanner   = (*NullDecimal)(nil)
+	_ driver.Valuer = NullDecimal{}
+)
+
+// MaxDecimalPrecision is the maximum precision of the ASE data types
+// decimal and numeric.
+const MaxDecimalPrecision = 38
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+// Decimal is an exact decimal number as stored in the ASE data types
+// decimal, numeric, money and smallmoney.
+//
+// A Decimal consists of an unscaled integer value, a scale and
+// a precision. The value of a Decimal is unscaled * 10^-scale, the
+// precision is the maximum number of digits of the unscaled value.
+//
+// Decimals are immutable, operations return a new Decimal. The zero
+// value is 0 with precision and scale 0.
+//
+// Decimals can be scanned from and passed as arguments for decimal,
+// numeric and money columns. When passed as argument to a statement the
+// Decimal is converted to the precision and scale of the parameter, an
+// error is returned if digits would be lost.
+type Decimal struct {
+	unscaled  *big.Int
+	precision int
+	scale     int
+}
+
+// NewDecimal returns a Decimal with the unscaled value and scale.
+//
+// The precision is the number of digits of the unscaled value, but at
+// least the scale.
+func NewDecimal(unscaled *big.Int, scale int) (Decimal, error) {
+	if scale < 0 {
+		return Decimal{}, fmt.Errorf("go-ase: negative scale %d", scale)
+	}
+
+	return checkedDecimal(new(big.Int).Set(unscaled), scale)
+}
+
+// checkedDecimal returns newDecimal(unscaled, scale) or an error if the
+// precision exceeds MaxDecimalPrecision.
+func checkedDecimal(unscaled *big.Int, scale int) (Decimal, error) {
+	dec := newDecimal(unscaled, scale)
+	if dec.precision > MaxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("go-ase: precision %d exceeds maximum precision %d",
+			dec.precision, MaxDecimalPrecision)
+	}
+
+	return dec, nil
+}
+
+// newDecimal returns a Decimal with the smallest precision required
+// for the unscaled value and scale. unscaled must not be modified
+// afterwards.
+func newDecimal(unscaled *big.Int, scale int) Decimal {
+	precision := numDigits(unscaled)
+	if precision < scale {
+		precision = scale
+	}
+	if precision == 0 {
+		precision = 1
+	}
+
+	return Decimal{
+		unscaled:  unscaled,
+		precision: precision,
+		scale:     scale,
+	}
+}
+
+// ParseDecimal parses a decimal number in the form
+// [+-]digits[.digits].
+//
+// The scale is the number of digits after the decimal point.
+func ParseDecimal(s string) (Decimal, error) {
+	trimmed := strings.TrimSpace(s)
+
+	digits := strings.TrimLeft(trimmed, "+-")
+	if len(trimmed)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("go-ase: invalid decimal %q", s)
+	}
+
+	intPart, fracPart := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPart, fracPart = digits[:i], digits[i+1:]
+	}
+
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("go-ase: invalid decimal %q", s)
+	}
+
+	for _, part := range []string{intPart, fracPart} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return Decimal{}, fmt.Errorf("go-ase: invalid decimal %q", s)
+			}
+		}
+	}
+
+	unscaled, ok := new(big.Int).SetString("0"+intPart+fracPart, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("go-ase: invalid decimal %q", s)
+	}
+
+	if strings.HasPrefix(trimmed, "-") {
+		unscaled.Neg(unscaled)
+	}
+
+	return NewDecimal(unscaled, len(fracPart))
+}
+
+// DecimalFromInt returns a Decimal with the value of i and scale 0.
+func DecimalFromInt(i *big.Int) (Decimal, error) {
+	return NewDecimal(i, 0)
+}
+
+// DecimalFromInt64 returns a Decimal with the value of i and scale 0.
+func DecimalFromInt64(i int64) Decimal {
+	return newDecimal(big.NewInt(i), 0)
+}
+
+// DecimalFromRat returns a Decimal with the value of r rounded half
+// away from zero to the scale.
+func DecimalFromRat(r *big.Rat, scale int) (Decimal, error) {
+	if scale < 0 {
+		return Decimal{}, fmt.Errorf("go-ase: negative scale %d", scale)
+	}
+
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	return NewDecimal(roundQuo(num, r.Denom()), scale)
+}
+
+// DecimalFromFloat64 returns a Decimal with the value of f rounded half
+// away from zero to the scale.
+//
+// The exact binary value of f is rounded, e.g. 0.1 is stored as
+// 0.1000000000000000055511151231257827. Use ParseDecimal with
+// strconv.FormatFloat to use the shortest decimal representation
+// instead.
+func DecimalFromFloat64(f float64, scale int) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("go-ase: cannot convert %v to decimal", f)
+	}
+
+	return DecimalFromRat(new(big.Rat).SetFloat64(f), scale)
+}
+
+// Precision returns the precision of d.
+func (d Decimal) Precision() int {
+	if d.precision == 0 {
+		return 1
+	}
+	return d.precision
+}
+
+// Scale returns the scale of d.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Unscaled returns the unscaled value of d.
+func (d Decimal) Unscaled() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(d.unscaled)
+}
+
+// Int returns the integer part of d.
+func (d Decimal) Int() *big.Int {
+	return new(big.Int).Quo(d.Unscaled(), pow10(d.scale))
+}
+
+// Rat returns the value of d.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Unscaled(), pow10(d.scale))
+}
+
+// Float64 returns the float64 value nearest to d and whether the
+// conversion is exact.
+func (d Decimal) Float64() (float64, bool) {
+	return d.Rat().Float64()
+}
+
+// String returns d with all digits of its scale, e.g. -12.30 for
+// a Decimal with scale 2.
+func (d Decimal) String() string {
+	unscaled := d.Unscaled()
+
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+
+	s := digits
+	if d.scale > 0 {
+		s = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+
+	if unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+// Sign returns -1, 0 or 1 if d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	if d.unscaled == nil {
+		return 0
+	}
+	return d.unscaled.Sign()
+}
+
+// Cmp compares the values of d and other and returns -1, 0 or 1 if d is
+// less than, equal to or greater than other. Precision and scale are
+// not compared.
+func (d Decimal) Cmp(other Decimal) int {
+	x, y, _ := alignScales(d, other)
+	return x.Cmp(y)
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{
+		unscaled:  new(big.Int).Neg(d.Unscaled()),
+		precision: d.precision,
+		scale:     d.scale,
+	}
+}
+
+// Abs returns the absolute value of d.
+func (d Decimal) Abs() Decimal {
+	return Decimal{
+		unscaled:  new(big.Int).Abs(d.Unscaled()),
+		precision: d.precision,
+		scale:     d.scale,
+	}
+}
+
+// Add returns d + other with the larger of both scales.
+//
+// An error is returned if the result exceeds MaxDecimalPrecision.
+func (d Decimal) Add(other Decimal) (Decimal, error) {
+	x, y, scale := alignScales(d, other)
+	return checkedDecimal(x.Add(x, y), scale)
+}
+
+// Sub returns d - other with the larger of both scales.
+//
+// An error is returned if the result exceeds MaxDecimalPrecision.
+func (d Decimal) Sub(other Decimal) (Decimal, error) {
+	x, y, scale := alignScales(d, other)
+	return checkedDecimal(x.Sub(x, y), scale)
+}
+
+// Mul returns d * other with the sum of both scales.
+//
+// An error is returned if the result exceeds MaxDecimalPrecision. Use
+// Round on the factors to reduce the scale of the result.
+func (d Decimal) Mul(other Decimal) (Decimal, error) {
+	unscaled := new(big.Int).Mul(d.Unscaled(), other.Unscaled())
+	return checkedDecimal(unscaled, d.scale+other.scale)
+}
+
+// Quo returns d / other rounded half away from zero to the scale.
+func (d Decimal) Quo(other Decimal, scale int) (Decimal, error) {
+	if other.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("go-ase: division by zero")
+	}
+
+	return DecimalFromRat(new(big.Rat).Quo(d.Rat(), other.Rat()), scale)
+}
+
+// Round returns d rounded half away from zero to the scale.
+//
+// An error is returned if increasing the scale exceeds
+// MaxDecimalPrecision.
+func (d Decimal) Round(scale int) (Decimal, error) {
+	if scale < 0 {
+		scale = 0
+	}
+
+	if scale >= d.scale {
+		unscaled := new(big.Int).Mul(d.Unscaled(), pow10(scale-d.scale))
+		return checkedDecimal(unscaled, scale)
+	}
+
+	return checkedDecimal(roundQuo(d.Unscaled(), pow10(d.scale-scale)), scale)
+}
+
+// Rescale returns d with the precision and scale.
+//
+// An error is returned if d cannot be represented exactly with the
+// precision and scale.
+func (d Decimal) Rescale(precision, scale int) (Decimal, error) {
+	if precision < 1 || precision > MaxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("go-ase: invalid precision %d", precision)
+	}
+
+	if scale < 0 || scale > precision {
+		return Decimal{}, fmt.Errorf("go-ase: invalid scale %d for precision %d", scale, precision)
+	}
+
+	unscaled := d.Unscaled()
+	if scale >= d.scale {
+		unscaled.Mul(unscaled, pow10(scale-d.scale))
+	} else {
+		rem := new(big.Int)
+		unscaled.QuoRem(unscaled, pow10(d.scale-scale), rem)
+		if rem.Sign() != 0 {
+			return Decimal{}, fmt.Errorf("go-ase: %s cannot be represented with scale %d without rounding",
+				d, scale)
+		}
+	}
+
+	if numDigits(unscaled) > precision {
+		return Decimal{}, fmt.Errorf("go-ase: %s exceeds precision %d with scale %d", d, precision, scale)
+	}
+
+	return Decimal{
+		unscaled:  unscaled,
+		precision: precision,
+		scale:     scale,
+	}, nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Decimal) Scan(src interface{}) error {
+	switch typed := src.(type) {
+	case *asetypes.Decimal:
+		*d = Decimal{
+			unscaled:  typed.Int(),
+			precision: typed.Precision,
+			scale:     typed.Scale,
+		}
+		return nil
+	case string:
+		dec, err := ParseDecimal(typed)
+		if err != nil {
+			return err
+		}
+		*d = dec
+		return nil
+	case []byte:
+		return d.Scan(string(typed))
+	case int64:
+		*d = DecimalFromInt64(typed)
+		return nil
+	case float64:
+		return d.Scan(strconv.FormatFloat(typed, 'f', -1, 64))
+	case nil:
+		return fmt.Errorf("go-ase: cannot scan NULL into Decimal, use NullDecimal or *Decimal")
+	default:
+		return fmt.Errorf("go-ase: cannot scan %T into Decimal", src)
+	}
+}
+
+// Value implements the driver.Valuer interface.
+//
+// go-ase converts Decimals to the precision and scale of the parameter.
+// The value is returned as string for use with other drivers.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// NullDecimal is a Decimal that may be NULL.
+type NullDecimal struct {
+	Decimal Decimal
+	// Valid is true if Decimal is not NULL.
+	Valid bool
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullDecimal) Scan(src interface{}) error {
+	if src == nil {
+		*n = NullDecimal{}
+		return nil
+	}
+
+	if err := n.Decimal.Scan(src); err != nil {
+		return err
+	}
+
+	n.Valid = true
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullDecimal) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Decimal.Value()
+}
+
+// checkDecimal converts Decimals to the *asetypes.Decimal with the
+// precision and scale of fieldFmt.
+//
+// The value is returned as is if it is not a Decimal or fieldFmt is not
+// a decimal or money format.
+func checkDecimal(fieldFmt tds.FieldFmt, value interface{}) (interface{}, error) {
+	var d Decimal
+	switch typed := value.(type) {
+	case Decimal:
+		d = typed
+	case *Decimal:
+		if typed == nil {
+			return nil, nil
+		}
+		d = *typed
+	case NullDecimal:
+		if !typed.Valid {
+			return nil, nil
+		}
+		d = typed.Decimal
+	default:
+		return value, nil
+	}
+
+	var precision, scale int
+	var limit *big.Int
+	switch fieldFmt.DataType() {
+	case asetypes.DECN, asetypes.NUMN:
+		precisionScale, ok := fieldFmt.(interface {
+			Precision() uint8
+			Scale() uint8
+		})
+		if !ok {
+			return nil, fmt.Errorf("field format %T does not provide precision and scale", fieldFmt)
+		}
+		precision, scale = int(precisionScale.Precision()), int(precisionScale.Scale())
+	case asetypes.MONEY:
+		precision, scale = asetypes.ASEMoneyPrecision, asetypes.ASEMoneyScale
+		limit = big.NewInt(math.MaxInt64)
+	case asetypes.SHORTMONEY:
+		precision, scale = asetypes.ASEShortMoneyPrecision, asetypes.ASEShortMoneyScale
+		limit = big.NewInt(math.MaxInt32)
+	default:
+		return d.Value()
+	}
+
+	d, err := d.Rescale(precision, scale)
+	if err != nil {
+		return nil, err
+	}
+
+	// Money is stored as scaled integer and has a smaller range than
+	// its precision suggests.
+	if limit != nil && (d.unscaled.Cmp(limit) > 0 || d.unscaled.Cmp(new(big.Int).Neg(limit)) < 0) {
+		return nil, fmt.Errorf("go-ase: %s exceeds the range of %s", d, fieldFmt.DataType())
+	}
+
+	dec, err := asetypes.NewDecimal(precision, scale)
+	if err != nil {
+		return nil, err
+	}
+
+	dec.SetBytes(new(big.Int).Abs(d.unscaled).Bytes())
+	if d.unscaled.Sign() < 0 {
+		dec.Negate()
+	}
+
+	return dec, nil
+}
+
+// alignScales returns the unscaled values of x and y with the larger of
+// both scales.
+func alignScales(x, y Decimal) (*big.Int, *big.Int, int) {
+	xi, yi := x.Unscaled(), y.Unscaled()
+
+	switch {
+	case x.scale > y.scale:
+		yi.Mul(yi, pow10(x.scale-y.scale))
+		return xi, yi, x.scale
+	case y.scale > x.scale:
+		xi.Mul(xi, pow10(y.scale-x.scale))
+		return xi, yi, y.scale
+	default:
+		return xi, yi, x.scale
+	}
+}
+
+// roundQuo returns num / den rounded half away from zero.
+func roundQuo(num, den *big.Int) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	// Round away from zero if the remainder is at least half of the
+	// denominator.
+	rem.Abs(rem).Lsh(rem, 1)
+	if rem.Cmp(new(big.Int).Abs(den)) >= 0 {
+		if num.Sign()*den.Sign() < 0 {
+			quo.Sub(quo, bigOne)
+		} else {
+			quo.Add(quo, bigOne)
+		}
+	}
+
+	return quo
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// numDigits returns the number of decimal digits of i.
+func numDigits(i *big.Int) int {
+	if i.Sign() == 0 {
+		return 0
+	}
+	return len(new(big.Int).Abs(i).String())
+}
@@ -0,0 +1,411 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	cases := map[string]struct {
+		input           string
+		expect          string
+		expectPrecision int
+		expectScale     int
+		expectErr       bool
+	}{
+		"integer": {
+			input:           "123",
+			expect:          "123",
+			expectPrecision: 3,
+		},
+		"fraction": {
+			input:           "-12.30",
+			expect:          "-12.30",
+			expectPrecision: 4,
+			expectScale:     2,
+		},
+		"leading point": {
+			input:           ".5",
+			expect:          "0.5",
+			expectPrecision: 1,
+			expectScale:     1,
+		},
+		"trailing point": {
+			input:           "+5.",
+			expect:          "5",
+			expectPrecision: 1,
+		},
+		"leading zeros": {
+			input:           "0.001",
+			expect:          "0.001",
+			expectPrecision: 3,
+			expectScale:     3,
+		},
+		"zero": {
+			input:           "0",
+			expect:          "0",
+			expectPrecision: 1,
+		},
+		"whitespace": {
+			input:           " 1.5 ",
+			expect:          "1.5",
+			expectPrecision: 2,
+			expectScale:     1,
+		},
+		"maximum precision": {
+			input:           strings.Repeat("9", 38),
+			expect:          strings.Repeat("9", 38),
+			expectPrecision: 38,
+		},
+		"exceeding precision": {
+			input:     strings.Repeat("9", 39),
+			expectErr: true,
+		},
+		"empty": {
+			input:     "",
+			expectErr: true,
+		},
+		"point only": {
+			input:     ".",
+			expectErr: true,
+		},
+		"two signs": {
+			input:     "--1",
+			expectErr: true,
+		},
+		"sign after digits": {
+			input:     "1-",
+			expectErr: true,
+		},
+		"two points": {
+			input:     "1.2.3",
+			expectErr: true,
+		},
+		"exponent": {
+			input:     "1e5",
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				d, err := ParseDecimal(cas.input)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected parsing %q to fail, received %s", cas.input, d)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Parsing %q failed: %v", cas.input, err)
+				}
+
+				if d.String() != cas.expect || d.Precision() != cas.expectPrecision || d.Scale() != cas.expectScale {
+					t.Errorf("Expected %s(%d, %d), received %s(%d, %d)",
+						cas.expect, cas.expectPrecision, cas.expectScale,
+						d, d.Precision(), d.Scale())
+				}
+			},
+		)
+	}
+}
+
+func TestRoundQuo(t *testing.T) {
+	cases := map[string]struct {
+		num, den, expect int64
+	}{
+		"exact":                   {num: 10, den: 5, expect: 2},
+		"below half":              {num: 14, den: 10, expect: 1},
+		"half":                    {num: 15, den: 10, expect: 2},
+		"above half":              {num: 16, den: 10, expect: 2},
+		"negative below half":     {num: -14, den: 10, expect: -1},
+		"negative half":           {num: -15, den: 10, expect: -2},
+		"negative denominator":    {num: 15, den: -10, expect: -2},
+		"both negative":           {num: -15, den: -10, expect: 2},
+		"odd denominator half":    {num: 3, den: 2, expect: 2},
+		"odd denominator below":   {num: 4, den: 3, expect: 1},
+		"odd denominator above":   {num: 5, den: 3, expect: 2},
+		"smaller than half":       {num: 1, den: 3, expect: 0},
+		"negative numerator zero": {num: -1, den: 3, expect: 0},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				num, den := big.NewInt(cas.num), big.NewInt(cas.den)
+
+				if quo := roundQuo(num, den); quo.Int64() != cas.expect {
+					t.Errorf("Expected %d / %d to round to %d, received %s", cas.num, cas.den, cas.expect, quo)
+				}
+
+				if num.Int64() != cas.num || den.Int64() != cas.den {
+					t.Errorf("roundQuo modified its arguments")
+				}
+			},
+		)
+	}
+}
+
+func TestDecimal_Rescale(t *testing.T) {
+	cases := map[string]struct {
+		input            string
+		precision, scale int
+		expect           string
+		expectErr        bool
+	}{
+		"increase scale": {
+			input:     "1.5",
+			precision: 10,
+			scale:     3,
+			expect:    "1.500",
+		},
+		"decrease scale without loss": {
+			input:     "1.500",
+			precision: 10,
+			scale:     1,
+			expect:    "1.5",
+		},
+		"decrease scale with loss": {
+			input:     "1.55",
+			precision: 10,
+			scale:     1,
+			expectErr: true,
+		},
+		"exactly precision": {
+			input:     "-999.99",
+			precision: 5,
+			scale:     2,
+			expect:    "-999.99",
+		},
+		"exceeding precision": {
+			input:     "1000.5",
+			precision: 5,
+			scale:     2,
+			expectErr: true,
+		},
+		"maximum precision": {
+			input:     "1",
+			precision: 38,
+			scale:     37,
+			expect:    "1." + strings.Repeat("0", 37),
+		},
+		"invalid precision": {
+			input:     "1",
+			precision: 39,
+			expectErr: true,
+		},
+		"zero precision": {
+			input:     "0",
+			precision: 0,
+			expectErr: true,
+		},
+		"scale exceeding precision": {
+			input:     "0.1",
+			precision: 1,
+			scale:     2,
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				d, err := ParseDecimal(cas.input)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rescaled, err := d.Rescale(cas.precision, cas.scale)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected rescaling to fail, received %s", rescaled)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Rescaling failed: %v", err)
+				}
+
+				if rescaled.String() != cas.expect || rescaled.Precision() != cas.precision || rescaled.Scale() != cas.scale {
+					t.Errorf("Expected %s(%d, %d), received %s(%d, %d)",
+						cas.expect, cas.precision, cas.scale,
+						rescaled, rescaled.Precision(), rescaled.Scale())
+				}
+
+				if d.String() != cas.input {
+					t.Errorf("Rescale modified the Decimal to %s", d)
+				}
+			},
+		)
+	}
+}
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	maxDigits := strings.Repeat("9", 38)
+	maxFraction := "0." + strings.Repeat("9", 37)
+
+	cases := map[string]struct {
+		op        func(x, y Decimal) (Decimal, error)
+		x, y      string
+		expect    string
+		expectErr bool
+	}{
+		"add": {
+			op: Decimal.Add, x: "1.5", y: "2.25",
+			expect: "3.75",
+		},
+		"add exceeding precision": {
+			op: Decimal.Add, x: maxDigits, y: "1",
+			expectErr: true,
+		},
+		"add exceeding precision through scale": {
+			op: Decimal.Add, x: "1" + strings.Repeat("0", 30), y: "0.00000001",
+			expectErr: true,
+		},
+		"sub": {
+			op: Decimal.Sub, x: "1.5", y: "2.25",
+			expect: "-0.75",
+		},
+		"sub exceeding precision": {
+			op: Decimal.Sub, x: "-" + maxDigits, y: "1",
+			expectErr: true,
+		},
+		"mul": {
+			op: Decimal.Mul, x: "1.5", y: "-2.25",
+			expect: "-3.375",
+		},
+		"mul exceeding precision": {
+			op: Decimal.Mul, x: maxFraction, y: "0.55",
+			expectErr: true,
+		},
+		"quo": {
+			op:     func(x, y Decimal) (Decimal, error) { return x.Quo(y, 3) },
+			x:      "1",
+			y:      "3",
+			expect: "0.333",
+		},
+		"quo by zero": {
+			op:        func(x, y Decimal) (Decimal, error) { return x.Quo(y, 3) },
+			x:         "1",
+			y:         "0",
+			expectErr: true,
+		},
+		"round half away from zero": {
+			op:     func(x, _ Decimal) (Decimal, error) { return x.Round(1) },
+			x:      "-1.25",
+			expect: "-1.3",
+		},
+		"round up scale": {
+			op:     func(x, _ Decimal) (Decimal, error) { return x.Round(3) },
+			x:      "1.5",
+			expect: "1.500",
+		},
+		"round exceeding precision": {
+			op:        func(x, _ Decimal) (Decimal, error) { return x.Round(2) },
+			x:         maxDigits,
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				x, err := ParseDecimal(cas.x)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				y := DecimalFromInt64(0)
+				if cas.y != "" {
+					if y, err = ParseDecimal(cas.y); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				result, err := cas.op(x, y)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %s", result)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Operation failed: %v", err)
+				}
+
+				if result.String() != cas.expect {
+					t.Errorf("Expected %s, received %s", cas.expect, result)
+				}
+			},
+		)
+	}
+}
+
+func TestDecimal_Scan(t *testing.T) {
+	cases := map[string]struct {
+		src        interface{}
+		expect     string
+		expectNull bool
+		expectErr  bool
+	}{
+		"string":  {src: "1.25", expect: "1.25"},
+		"bytes":   {src: []byte("-3.5"), expect: "-3.5"},
+		"int64":   {src: int64(42), expect: "42"},
+		"float64": {src: 0.1, expect: "0.1"},
+		"null":    {src: nil, expectNull: true},
+		"invalid": {src: "abc", expectErr: true},
+		"bool":    {src: true, expectErr: true},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				var d Decimal
+				err := d.Scan(cas.src)
+				if cas.expectErr || cas.expectNull {
+					if err == nil {
+						t.Errorf("Expected scanning %v into Decimal to fail", cas.src)
+					}
+				} else if err != nil {
+					t.Errorf("Scanning into Decimal failed: %v", err)
+				} else if d.String() != cas.expect {
+					t.Errorf("Expected Decimal %s, received %s", cas.expect, d)
+				}
+
+				n := NullDecimal{Decimal: DecimalFromInt64(1), Valid: true}
+				err = n.Scan(cas.src)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected scanning %v into NullDecimal to fail", cas.src)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Scanning into NullDecimal failed: %v", err)
+				}
+
+				if n.Valid == cas.expectNull {
+					t.Errorf("Expected Valid to be %t, is %t", !cas.expectNull, n.Valid)
+				}
+
+				value, err := n.Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if cas.expectNull && value != nil {
+					t.Errorf("Expected NULL value, received %v", value)
+				}
+				if !cas.expectNull && value != cas.expect {
+					t.Errorf("Expected value %s, received %v", cas.expect, value)
+				}
+			},
+		)
+	}
+}
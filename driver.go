@@ -32,6 +32,10 @@ func init() {
 type Driver struct {
 	envChangeHooks []tds.EnvChangeHook
 	eedHooks       []tds.EEDHook
+	failoverHooks  []FailoverHook
+	reconnectHooks []ReconnectHook
+	paramCodecs    []ParamCodec
+	resultCodecs   []ResultCodec
 }
 
 // Open implements the driver.Driver interface.
@@ -77,3 +81,51 @@ func AddEEDHooks(fns ...tds.EEDHook) error {
 	drv.eedHooks = append(drv.eedHooks, fns...)
 	return nil
 }
+
+// AddFailoverHooks gathers the failoverHooks.
+func AddFailoverHooks(fns ...FailoverHook) error {
+	for _, fn := range fns {
+		if fn == nil {
+			return fmt.Errorf("go-ase: Received nil FailoverHook: %#v", fns)
+		}
+	}
+
+	drv.failoverHooks = append(drv.failoverHooks, fns...)
+	return nil
+}
+
+// AddReconnectHooks gathers the reconnectHooks.
+func AddReconnectHooks(fns ...ReconnectHook) error {
+	for _, fn := range fns {
+		if fn == nil {
+			return fmt.Errorf("go-ase: Received nil ReconnectHook: %#v", fns)
+		}
+	}
+
+	drv.reconnectHooks = append(drv.reconnectHooks, fns...)
+	return nil
+}
+
+// AddParamCodecs gathers the paramCodecs.
+func AddParamCodecs(codecs ...ParamCodec) error {
+	for _, codec := range codecs {
+		if err := codec.validate(); err != nil {
+			return err
+		}
+	}
+
+	drv.paramCodecs = append(drv.paramCodecs, codecs...)
+	return nil
+}
+
+// AddResultCodecs gathers the resultCodecs.
+func AddResultCodecs(codecs ...ResultCodec) error {
+	for _, codec := range codecs {
+		if err := codec.validate(); err != nil {
+			return err
+		}
+	}
+
+	drv.resultCodecs = append(drv.resultCodecs, codecs...)
+	return nil
+}
@@ -6,10 +6,12 @@ package ase
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/SAP/go-dblib"
 	"github.com/SAP/go-dblib/namepool"
@@ -35,6 +37,12 @@ type Stmt struct {
 
 	paramFmt *tds.ParamFmtPackage
 	rowFmt   *tds.RowFmtPackage
+
+	// query maps the arguments to the parameters of the statement.
+	query *parsedQuery
+	// identity is true if the statement selects the identity of the
+	// inserted row after the insert.
+	identity bool
 }
 
 // Prepare implements the driver.Conn interface.
@@ -49,8 +57,56 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 }
 
 // NewStmt creates a new statement.
+//
+// The statement is allocated again when the connection is
+// reestablished.
 func (c *Conn) NewStmt(ctx context.Context, name, query string, create_proc bool) (*Stmt, error) {
-	stmt := &Stmt{conn: c}
+	if err := c.ensureValid(ctx); err != nil {
+		return nil, err
+	}
+
+	// The identity is selected in the stored procedure.
+	identity := create_proc && c.lastInsertID && isInsert(query)
+	if identity {
+		query = selectIdentity(query)
+	}
+
+	stmt, err := c.newStmt(ctx, name, query, create_proc)
+	if err != nil {
+		c.checkConnErr(err)
+		if !c.retryAfterReconnect(ctx, true) {
+			return nil, err
+		}
+
+		if stmt, err = c.newStmt(ctx, name, query, create_proc); err != nil {
+			c.checkConnErr(err)
+			return nil, err
+		}
+	}
+
+	stmt.identity = identity
+
+	if stmt.stmtId != nil {
+		c.stmtLock.Lock()
+		c.stmts[int(stmt.stmtId.ID())] = stmt
+		c.stmtLock.Unlock()
+	}
+
+	return stmt, nil
+}
+
+func (c *Conn) newStmt(ctx context.Context, name, query string, create_proc bool) (*Stmt, error) {
+	parsed, err := parseQuery(query, c.placeholders)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := c.encodeString(parsed.query)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &Stmt{conn: c, query: parsed}
 
 	if name == "" {
 		// TODO different pools for procs and prepares
@@ -62,9 +118,9 @@ func (c *Conn) NewStmt(ctx context.Context, name, query string, create_proc bool
 	stmt.pkg.ID = name
 
 	if create_proc {
-		stmt.pkg.Stmt = fmt.Sprintf("create proc %s as %s", name, query)
+		stmt.pkg.Stmt = fmt.Sprintf("create proc %s as %s", name, encoded)
 	} else {
-		stmt.pkg.Stmt = query
+		stmt.pkg.Stmt = encoded
 	}
 
 	// Reset statement to default before proceeding
@@ -100,6 +156,7 @@ func (stmt *Stmt) allocateOnServer(ctx context.Context) error {
 				stmt.rowFmt = typed
 				return false, nil
 			case *tds.DonePackage:
+				stmt.conn.trackTransaction(typed)
 				ok, err := handleDonePackage(typed)
 				if err != nil {
 					return true, err
@@ -141,6 +198,10 @@ func (stmt *Stmt) Close() error {
 func (stmt *Stmt) close(ctx context.Context) error {
 	if stmt.stmtId != nil {
 		defer stmtIdPool.Release(stmt.stmtId)
+
+		stmt.conn.stmtLock.Lock()
+		delete(stmt.conn.stmts, int(stmt.stmtId.ID()))
+		stmt.conn.stmtLock.Unlock()
 	}
 
 	// communicate deallocation with server
@@ -164,6 +225,16 @@ func (stmt *Stmt) close(ctx context.Context) error {
 
 // NumInput implements the driver.Stmt interface.
 func (stmt Stmt) NumInput() int {
+	if n := stmt.query.numInput(); n >= 0 {
+		return n
+	}
+
+	// The row format of a statement selecting the identity describes
+	// the identity.
+	if stmt.identity && stmt.paramFmt == nil {
+		return 0
+	}
+
 	fieldFmts, err := stmt.fieldFmts()
 	if err != nil {
 		return -1
@@ -179,9 +250,15 @@ func (stmt Stmt) Exec(args []driver.Value) (driver.Result, error) {
 // ExecContext implements the driver.StmtExecContext interface.
 func (stmt Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	rows, result, err := stmt.GenericExec(ctx, args)
+
+	// Result sets are discarded, errors of the discarded response are
+	// returned.
 	if rows != nil {
-		rows.Close()
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			return nil, closeErr
+		}
 	}
+
 	return result, err
 }
 
@@ -223,68 +300,252 @@ func (stmt Stmt) DirectExec(ctx context.Context, args ...interface{}) (driver.Ro
 
 // GenericExec is the central method through which SQL statements are
 // sent to ASE.
+//
+// If reconnect is enabled and the connection to the server is lost
+// while no transaction is open the connection is reestablished. The
+// statement is only sent again if ctx is tagged with WithIdempotent.
 func (stmt Stmt) GenericExec(ctx context.Context, args []driver.NamedValue) (driver.Rows, driver.Result, error) {
-	// Prepare and send payload
-	stmt.pkg.Type = tds.TDS_DYN_EXEC
-	if stmt.paramFmt != nil {
-		stmt.pkg.Status |= tds.TDS_DYNAMIC_HASARGS
+	if err := stmt.conn.ensureValid(ctx); err != nil {
+		return nil, nil, err
 	}
-	if err := stmt.conn.Channel.QueuePackage(ctx, stmt.pkg); err != nil {
-		return nil, nil, fmt.Errorf("error queueing dynamic statement exec package: %w", err)
+
+	args, err := stmt.query.bind(args)
+	if err != nil {
+		return nil, nil, err
 	}
-	stmt.Reset()
 
-	if stmt.paramFmt != nil {
-		if err := stmt.conn.Channel.QueuePackage(ctx, stmt.paramFmt); err != nil {
-			return nil, nil, fmt.Errorf("error queueing dynamic statement parameter format: %w", err)
+	rows, result, err := stmt.genericExec(ctx, args)
+	if err != nil {
+		stmt.conn.checkConnErr(err)
+		if stmt.conn.retryAfterReconnect(ctx, isIdempotent(ctx)) {
+			rows, result, err = stmt.genericExec(ctx, args)
+			if err != nil {
+				stmt.conn.checkConnErr(err)
+			}
 		}
+	}
 
-		dataFields := []tds.FieldData{}
+	return rows, result, err
+}
+
+func (stmt Stmt) genericExec(ctx context.Context, args []driver.NamedValue) (driver.Rows, driver.Result, error) {
+	// Build the parameters before queueing any package, otherwise
+	// a failed conversion would leave an incomplete message queued.
+	paramFmt, dataFields, err := stmt.buildParams(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := stmt.sendExec(ctx, paramFmt, dataFields); err != nil {
+		return nil, nil, err
+	}
+
+	// Receive response
+	if err := stmt.recvDynAck(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	rows, result, err := stmt.conn.genericResults(ctx)
+	if err != nil || !stmt.identity {
+		return rows, result, err
+	}
+
+	return stmt.conn.readIdentity(ctx, rows, result)
+}
 
+// buildParams returns the parameter format and the parameters of an
+// execution with args.
+func (stmt Stmt) buildParams(args []driver.NamedValue) (*tds.ParamFmtPackage, []tds.FieldData, error) {
+	dataFields := []tds.FieldData{}
+	paramFmt := stmt.paramFmt
+	if stmt.paramFmt != nil {
 		for i, arg := range args {
 			fmtField := stmt.paramFmt.Fmts[i]
 
+			value := arg.Value
+			sendUnicode := isUnicodeFmt(fmtField)
+			if uni, ok := value.(UniChar); ok {
+				value = string(uni)
+				sendUnicode = true
+			}
+
+			// The format of the statement is left untouched, another
+			// execution may pass different values.
+			if _, ok := value.(string); ok && sendUnicode && !isUniCharFmt(fmtField) {
+				uniFmt, err := uniVarCharFmt(fmtField)
+				if err != nil {
+					return nil, nil, fmt.Errorf("unable to create univarchar format: %w", err)
+				}
+
+				if paramFmt == stmt.paramFmt {
+					fmtCopy := *stmt.paramFmt
+					fmtCopy.Fmts = append([]tds.FieldFmt(nil), stmt.paramFmt.Fmts...)
+					paramFmt = &fmtCopy
+				}
+				paramFmt.Fmts[i] = uniFmt
+				fmtField = uniFmt
+			}
+
 			dataField, err := tds.LookupFieldData(fmtField)
 			if err != nil {
 				return nil, nil, fmt.Errorf("unable to find FieldData for datatype %s: %w",
 					fmtField.DataType(), err)
 			}
 
-			dataField.SetValue(arg.Value)
+			if s, ok := value.(string); ok {
+				switch {
+				case isUnicodeFmt(fmtField):
+					value, err = encodeUTF16(s)
+				case isCharType(fmtField.DataType()):
+					value, err = stmt.conn.encodeString(s)
+				}
+				if err != nil {
+					return nil, nil, fmt.Errorf("error converting argument %d: %w", arg.Ordinal, err)
+				}
+			}
+
+			dataField.SetValue(value)
 
 			dataFields = append(dataFields, dataField)
 		}
+	}
 
-		if err := stmt.conn.Channel.QueuePackage(ctx, tds.NewParamsPackage(dataFields...)); err != nil {
-			return nil, nil, fmt.Errorf("error queueing dynamic statement parameters: %w", err)
-		}
+	return paramFmt, dataFields, nil
+}
+
+// sendExec sends the execution of the statement with the parameters.
+func (stmt Stmt) sendExec(ctx context.Context, paramFmt *tds.ParamFmtPackage, dataFields []tds.FieldData) error {
+	if err := stmt.queueExec(ctx, paramFmt, dataFields); err != nil {
+		return err
 	}
 
 	if err := stmt.conn.Channel.SendRemainingPackets(ctx); err != nil {
-		return nil, nil, fmt.Errorf("error sending queued packages for dynamic statement execution: %w", err)
+		return fmt.Errorf("error sending queued packages for dynamic statement execution: %w", err)
 	}
 
-	// Receive response
-	if err := stmt.recvDynAck(ctx); err != nil {
-		return nil, nil, err
+	return nil
+}
+
+// queueExec queues the execution of the statement with the parameters
+// without ending the message.
+func (stmt Stmt) queueExec(ctx context.Context, paramFmt *tds.ParamFmtPackage, dataFields []tds.FieldData) error {
+	// Prepare and send payload
+	stmt.pkg.Type = tds.TDS_DYN_EXEC
+	if stmt.paramFmt != nil {
+		stmt.pkg.Status |= tds.TDS_DYNAMIC_HASARGS
+	}
+	if err := stmt.conn.Channel.QueuePackage(ctx, stmt.pkg); err != nil {
+		return fmt.Errorf("error queueing dynamic statement exec package: %w", err)
 	}
+	stmt.Reset()
 
-	return stmt.conn.genericResults(ctx)
+	if stmt.paramFmt != nil {
+		if err := stmt.conn.Channel.QueuePackage(ctx, paramFmt); err != nil {
+			return fmt.Errorf("error queueing dynamic statement parameter format: %w", err)
+		}
+
+		if err := stmt.conn.Channel.QueuePackage(ctx, tds.NewParamsPackage(dataFields...)); err != nil {
+			return fmt.Errorf("error queueing dynamic statement parameters: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // CheckNamedValue implements the driver.NamedValueChecker interface.
+//
+// Output parameters (sql.Out) are rejected as dynamic SQL does not
+// return parameter values.
 func (stmt Stmt) CheckNamedValue(named *driver.NamedValue) error {
 	fieldFmts, err := stmt.fieldFmts()
 	if err != nil {
 		return fmt.Errorf("go-ase: no formats are set: %w", err)
 	}
 
-	if named.Ordinal-1 >= len(fieldFmts) {
+	// Arguments used for multiple placeholders are converted according
+	// to the first parameter.
+	index := stmt.query.position(*named)
+	if stmt.query.skipped(*named) {
+		return nil
+	}
+
+	if index < 0 {
+		return fmt.Errorf("go-ase: argument %d does not match any placeholder", named.Ordinal)
+	}
+
+	if index >= len(fieldFmts) {
 		return fmt.Errorf("go-ase: ordinal %d (index %d) is larger than the number of expected arguments %d",
-			named.Ordinal, named.Ordinal-1, len(fieldFmts))
+			named.Ordinal, index, len(fieldFmts))
+	}
+
+	fieldFmt := fieldFmts[index]
+
+	// Values with a codec are encoded first and then converted like
+	// any other value.
+	if codec, ok := stmt.conn.codecs.param(named.Value); ok {
+		val, err := codec.encode(named.Value)
+		if err != nil {
+			return err
+		}
+		named.Value = val
+	}
+
+	switch value := named.Value.(type) {
+	case sql.Out:
+		return fmt.Errorf("go-ase: output parameters are not supported by dynamic SQL")
+	case InList:
+		return fmt.Errorf("go-ase: In cannot be used with prepared statements")
+	case Decimal, *Decimal, NullDecimal:
+		// Decimals are converted according to the parameter below.
+	default:
+		val, err := resolveValuer(value)
+		if err != nil {
+			return err
+		}
+		named.Value = val
+	}
+
+	// go-dblib cannot send NULL values.
+	if named.Value == nil {
+		return fmt.Errorf("go-ase: NULL parameters are not supported")
+	}
+
+	switch value := named.Value.(type) {
+	// Strings for unicode parameters and UniChar values are encoded
+	// as UTF-16 when the parameters are sent.
+	case UniChar:
+		return nil
+	case string:
+		if isUnicodeFmt(fieldFmt) {
+			return nil
+		}
+	case Decimal, *Decimal, NullDecimal:
+		val, err := checkDecimal(fieldFmt, named.Value)
+		if err != nil {
+			return fmt.Errorf("go-ase: error converting value: %w", err)
+		}
+
+		if val == nil {
+			return fmt.Errorf("go-ase: NULL parameters are not supported")
+		}
+		named.Value = val
+	case time.Time:
+		val, err := stmt.conn.checkTime(fieldFmt, value)
+		if err != nil {
+			return fmt.Errorf("go-ase: error converting value: %w", err)
+		}
+		named.Value = val
+	}
+
+	if val, ok, err := checkInteger(fieldFmt, named.Value); ok {
+		if err != nil {
+			return fmt.Errorf("go-ase: error converting value: %w", err)
+		}
+		named.Value = val
+		return nil
 	}
 
-	val, err := fieldFmts[named.Ordinal-1].DataType().ConvertValue(named.Value)
+	val, err := fieldFmt.DataType().ConvertValue(named.Value)
 	if err != nil {
 		return fmt.Errorf("go-ase: error converting value: %w", err)
 	}
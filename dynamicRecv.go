@@ -16,6 +16,10 @@ import (
 func (stmt Stmt) recvDynAck(ctx context.Context) error {
 	_, err := stmt.conn.Channel.NextPackageUntil(ctx, true,
 		func(pkg tds.Package) (bool, error) {
+			if done, ok := pkg.(*tds.DonePackage); ok {
+				stmt.conn.trackTransaction(done)
+			}
+
 			ack, ok := pkg.(*tds.DynamicPackage)
 			if !ok {
 				return false, nil
@@ -43,6 +47,7 @@ func (stmt Stmt) recvDoneFinal(ctx context.Context) error {
 			if !ok {
 				return false, nil
 			}
+			stmt.conn.trackTransaction(done)
 
 			if done.Status != tds.TDS_DONE_FINAL {
 				return false, fmt.Errorf("DonePackage does not have status TDS_DONE_FINAL set: %s", done)
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// This example shows how to implement a TDS server with the aseserver
+// package and how to access it using the pure go driver.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/dsn"
+)
+
+func main() {
+	if err := DoMain(); err != nil {
+		log.Printf("Failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// handler answers 'select <string literal>' and echoes the arguments
+// of prepared statements.
+type handler struct{}
+
+func (handler) HandleLogin(ctx context.Context, req *aseserver.LoginRequest) error {
+	if req.Username != "user" || req.Password != "pass" {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func (handler) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	query := strings.TrimSpace(req.Query)
+
+	if !strings.HasPrefix(query, "select '") || !strings.HasSuffix(query, "'") {
+		return &aseserver.Error{
+			MsgNumber: 156,
+			Severity:  15,
+			State:     2,
+			Message:   fmt.Sprintf("Unsupported query: %s", query),
+		}
+	}
+
+	value := strings.TrimSuffix(strings.TrimPrefix(query, "select '"), "'")
+
+	if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.VARCHAR, Length: int64(len(value))}); err != nil {
+		return err
+	}
+
+	return w.WriteRow(value)
+}
+
+func (handler) PrepareDynamic(ctx context.Context, session *aseserver.Session, query string) ([]aseserver.Column, error) {
+	if query != "select ?, ?" {
+		return nil, fmt.Errorf("unsupported query: %s", query)
+	}
+
+	return []aseserver.Column{
+		{DataType: asetypes.INT4},
+		{DataType: asetypes.VARCHAR},
+	}, nil
+}
+
+func (handler) HandleDynamic(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.DynamicRequest) error {
+	cols := make([]aseserver.Column, len(req.Params))
+	values := make([]interface{}, len(req.Params))
+	for i, param := range req.Params {
+		cols[i] = aseserver.Column{DataType: param.DataType}
+		values[i] = param.Value
+	}
+
+	if err := w.WriteRowFmt(cols...); err != nil {
+		return err
+	}
+
+	return w.WriteRow(values...)
+}
+
+func DoMain() error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	srv := &aseserver.Server{Handler: handler{}}
+	defer srv.Close()
+
+	go srv.Serve(l)
+
+	fmt.Println("Opening database")
+	info := dsn.NewInfo()
+	info.Host, info.Port, _ = net.SplitHostPort(l.Addr().String())
+	info.Username = "user"
+	info.Password = "pass"
+
+	connector, err := ase.NewConnector(info)
+	if err != nil {
+		return fmt.Errorf("failed to create connector: %w", err)
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("select 'hello world'").Scan(&s); err != nil {
+		return fmt.Errorf("failed to query string: %w", err)
+	}
+	fmt.Printf("Language command returned: %s\n", s)
+
+	var i int
+	if err := db.QueryRow("select ?, ?", 42, "answer").Scan(&i, &s); err != nil {
+		return fmt.Errorf("failed to query arguments: %w", err)
+	}
+	fmt.Printf("Dynamic SQL returned: %d, %s\n", i, s)
+
+	if _, err := db.Exec("drop table answers"); err != nil {
+		fmt.Println("Unsupported query failed")
+	}
+
+	return nil
+}
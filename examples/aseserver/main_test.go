@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "log"
+
+func ExampleDoMain() {
+	if err := DoMain(); err != nil {
+		log.Printf("Failed to execute example: %v", err)
+	}
+	// Output:
+	//
+	// Opening database
+	// Language command returned: hello world
+	// Dynamic SQL returned: 42, answer
+	// Unsupported query failed
+}
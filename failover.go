@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SAP/go-dblib/dsn"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// FailoverHook defines the signature of functions called when go-ase
+// fails over from one server to another.
+//
+// from is the address of the server that failed and reason the error
+// that caused the failover.
+// to is the address of the server go-ase connects to next. If the
+// failover was announced by the server during a session to is empty;
+// the connection is marked as bad and the connection pool connects to
+// the next available server.
+type FailoverHook func(from, to string, reason error)
+
+// ErrFailover is the reason passed to FailoverHooks when a server
+// announced a failover.
+var ErrFailover = errors.New("go-ase: server announced failover")
+
+func callFailoverHooks(connector *Connector, from, to string, reason error) {
+	for _, fn := range drv.failoverHooks {
+		fn(from, to, reason)
+	}
+
+	for _, fn := range connector.FailoverHooks {
+		fn(from, to, reason)
+	}
+}
+
+// serverAddr is the address of a server.
+type serverAddr struct {
+	host, port string
+}
+
+func (addr serverAddr) String() string {
+	return net.JoinHostPort(addr.host, addr.port)
+}
+
+// serverAddrs returns the addresses of the servers to connect to in
+// order.
+//
+// The host of the DSN may contain a comma-separated list of servers,
+// additional servers are read from the properties hosts and secondary.
+// Servers without a port use the port of the DSN.
+func serverAddrs(info *dsn.Info) ([]serverAddr, error) {
+	lists := []string{info.Host}
+	lists = append(lists, info.ConnectProps["hosts"]...)
+	lists = append(lists, info.ConnectProps["secondary"]...)
+
+	addrs := []serverAddr{}
+	for _, list := range lists {
+		for _, entry := range strings.Split(list, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			addr, err := parseServerAddr(entry, info.Port)
+			if err != nil {
+				return nil, err
+			}
+
+			addrs = append(addrs, addr)
+		}
+	}
+
+	if len(addrs) == 0 {
+		// Let go-dblib report the missing host.
+		addrs = append(addrs, serverAddr{host: info.Host, port: info.Port})
+	}
+
+	return addrs, nil
+}
+
+// parseServerAddr parses a server in the form host, host:port,
+// [host] or [host]:port. IPv6 addresses must be enclosed in brackets
+// if a port is given. Servers without port use defaultPort.
+func parseServerAddr(entry, defaultPort string) (serverAddr, error) {
+	switch {
+	case strings.HasPrefix(entry, "[") && strings.HasSuffix(entry, "]"):
+		return serverAddr{host: entry[1 : len(entry)-1], port: defaultPort}, nil
+	case strings.HasPrefix(entry, "["), strings.Count(entry, ":") == 1:
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			return serverAddr{}, fmt.Errorf("error parsing server address %q: %w", entry, err)
+		}
+		return serverAddr{host: host, port: port}, nil
+	default:
+		// Hostnames, IPv4 addresses and IPv6 addresses without port.
+		return serverAddr{host: entry, port: defaultPort}, nil
+	}
+}
+
+// parseFailoverMessages returns the message numbers of EEDs that
+// announce a failover.
+func parseFailoverMessages(info *dsn.Info) (map[uint32]bool, error) {
+	msgNumbers := map[uint32]bool{}
+
+	for _, list := range info.ConnectProps["failover-messages"] {
+		for _, entry := range strings.Split(list, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			msgNumber, err := strconv.ParseUint(entry, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing message number %q: %w", entry, err)
+			}
+
+			msgNumbers[uint32(msgNumber)] = true
+		}
+	}
+
+	return msgNumbers, nil
+}
+
+// connHealth records whether a connection can still be used and
+// whether it may be reconnected.
+//
+// The health is shared between copies of a Conn and may be updated from
+// the goroutine of go-dblib calling hooks.
+type connHealth struct {
+	sync.Mutex
+	err error
+
+	// inXact is set while the server reports an open transaction with
+	// TDS_DONE_INXACT.
+	inXact bool
+	// responseEnded is set after a done package ending a response. The
+	// TDS_DONE_FINAL the channel appends afterwards carries no
+	// transaction state.
+	responseEnded bool
+}
+
+func (health *connHealth) markBad(err error) bool {
+	health.Lock()
+	defer health.Unlock()
+
+	if health.err != nil {
+		return false
+	}
+
+	health.err = err
+	return true
+}
+
+func (health *connHealth) bad() bool {
+	health.Lock()
+	defer health.Unlock()
+
+	return health.err != nil
+}
+
+// IsValid implements the driver.Validator interface.
+//
+// A connection is invalid after the connection to the server was lost
+// or the server announced a failover.
+func (c Conn) IsValid() bool {
+	return c.health == nil || !c.health.bad()
+}
+
+// ResetSession implements the driver.SessionResetter interface.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+// checkConnErr marks the connection as bad if err signals that the
+// connection to the server was lost.
+func (c Conn) checkConnErr(err error) {
+	if c.health == nil || !isConnErr(err) {
+		return
+	}
+
+	c.health.markBad(err)
+}
+
+// failover marks the connection as bad after the server announced
+// a failover.
+func (c Conn) failover() {
+	if c.health == nil || !c.health.markBad(ErrFailover) {
+		return
+	}
+
+	for _, fn := range drv.failoverHooks {
+		fn(c.addr, "", ErrFailover)
+	}
+
+	for _, fn := range c.failoverHooks {
+		fn(c.addr, "", ErrFailover)
+	}
+}
+
+// failoverEEDHook returns an EEDHook calling failover when an EED with
+// one of the passed message numbers is received.
+func (c Conn) failoverEEDHook(msgNumbers map[uint32]bool) tds.EEDHook {
+	return func(eed tds.EEDPackage) {
+		if msgNumbers[eed.MsgNumber] {
+			c.failover()
+		}
+	}
+}
+
+// handleMsgPackage handles messages the server sends alongside results.
+func (c Conn) handleMsgPackage(msg *tds.MsgPackage) {
+	if msg.MsgId == tds.TDS_MSG_HAFAILOVER {
+		c.failover()
+	}
+}
+
+// isConnErr reports whether err signals that the connection to the
+// server was lost.
+func isConnErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, tds.ErrEOFAfterZeroRead) || errors.Is(err, tds.ErrChannelClosed) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
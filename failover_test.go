@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// namedServer responds to queries with its name and announces
+// a failover on request.
+type namedServer struct {
+	name   string
+	logins int32
+}
+
+func (s *namedServer) HandleLogin(ctx context.Context, req *aseserver.LoginRequest) error {
+	atomic.AddInt32(&s.logins, 1)
+	return nil
+}
+
+func (s *namedServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	switch req.Query {
+	case "announce failover":
+		if err := w.WritePackage(tds.NewMsgPackage(0, tds.TDS_MSG_HAFAILOVER)); err != nil {
+			return err
+		}
+		return w.WriteDone(tds.TDS_DONE_COUNT, 0)
+	case "announce eed":
+		return &aseserver.Error{MsgNumber: 9999, Severity: 16, State: 1, Message: "server going down"}
+	default:
+		if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.VARCHAR, Length: 30}); err != nil {
+			return err
+		}
+		return w.WriteRow(s.name)
+	}
+}
+
+// failoverEvent is a call of a FailoverHook.
+type failoverEvent struct {
+	from, to string
+}
+
+func TestConnector_Failover(t *testing.T) {
+	primary := &namedServer{name: "primary"}
+	secondary := &namedServer{name: "secondary"}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primarySrv := &aseserver.Server{Handler: primary, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go primarySrv.Serve(l)
+	defer primarySrv.Close()
+	primaryAddr := l.Addr().String()
+
+	secondaryAddr := fakeServer(t, secondary)
+
+	// The first server in the list is not reachable.
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.Addr().String()
+	dead.Close()
+
+	info := fakeInfo(t, deadAddr, "secondary", secondaryAddr, "failover-messages", "9999")
+	info.Host = deadAddr + "," + primaryAddr
+
+	var mu sync.Mutex
+	var events []failoverEvent
+	connector := &ase.Connector{
+		DSN: info,
+		FailoverHooks: []ase.FailoverHook{
+			func(from, to string, reason error) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, failoverEvent{from, to})
+			},
+		},
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	expectServer := func(expect string, expectLogins int32) {
+		t.Helper()
+
+		var name string
+		if err := db.QueryRow("select name").Scan(&name); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+
+		if name != expect {
+			t.Errorf("Expected to be connected to %s, connected to %s", expect, name)
+		}
+
+		if logins := atomic.LoadInt32(&primary.logins); logins != expectLogins {
+			t.Errorf("Expected %d logins on primary, received %d", expectLogins, logins)
+		}
+	}
+
+	expectServer("primary", 1)
+
+	if _, err := db.Exec("announce failover"); err != nil {
+		t.Fatalf("Announcing failover failed: %v", err)
+	}
+	expectServer("primary", 2)
+
+	if _, err := db.Exec("announce eed"); err == nil || !strings.Contains(err.Error(), "server going down") {
+		t.Fatalf("Expected error of announced failover, received: %v", err)
+	}
+	expectServer("primary", 3)
+
+	primarySrv.Close()
+
+	// The first query may fail as the loss of the connection is only
+	// detected when the connection is used.
+	var name string
+	if err := db.QueryRow("select name").Scan(&name); err != nil {
+		t.Logf("Query after closing primary failed: %v", err)
+	}
+	expectServer("secondary", 3)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expectEvents := []failoverEvent{
+		{deadAddr, primaryAddr},
+		{primaryAddr, ""},
+		{deadAddr, primaryAddr},
+		{primaryAddr, ""},
+		{deadAddr, primaryAddr},
+		{deadAddr, primaryAddr},
+		{primaryAddr, secondaryAddr},
+	}
+
+	if len(events) != len(expectEvents) {
+		t.Fatalf("Expected failover events %v, received %v", expectEvents, events)
+	}
+	for i := range events {
+		if events[i] != expectEvents[i] {
+			t.Errorf("Expected failover events %v, received %v", expectEvents, events)
+			break
+		}
+	}
+}
+
+func TestConnector_IPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	srv := &aseserver.Server{Handler: selectOne}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		host, port string
+		props      []string
+	}{
+		"bare address": {
+			host: "::1",
+			port: port,
+		},
+		"bracketed address": {
+			host: "[::1]",
+			port: port,
+		},
+		"bracketed address with port": {
+			host: "[::1]:" + port,
+			port: "1",
+		},
+		"hosts": {
+			host:  "127.0.0.1",
+			port:  "1",
+			props: []string{"hosts", "::1,[::1]:" + port},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				info := fakeInfo(t, "127.0.0.1:1", cas.props...)
+				info.Host, info.Port = cas.host, cas.port
+
+				db := sql.OpenDB(&ase.Connector{DSN: info})
+				defer db.Close()
+
+				var n int
+				if err := db.QueryRow("select 1").Scan(&n); err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/dsn"
+)
+
+// fakeServer starts an aseserver with handler and returns its address.
+func fakeServer(t *testing.T, handler aseserver.Handler) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &aseserver.Server{Handler: handler, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return l.Addr().String()
+}
+
+// fakeInfo returns the DSN of the server at addr with the passed
+// properties.
+func fakeInfo(t *testing.T, addr string, props ...string) *dsn.Info {
+	info := dsn.NewInfo()
+
+	var err error
+	info.Host, info.Port, err = net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Username = "user"
+	info.Password = "pass"
+
+	for i := 0; i+1 < len(props); i += 2 {
+		info.ConnectProps.Set(props[i], props[i+1])
+	}
+
+	return info
+}
+
+// fakeDB returns a database connected to a server running handler with
+// a single connection.
+func fakeDB(t *testing.T, handler aseserver.Handler, props ...string) *sql.DB {
+	connector, err := ase.NewConnector(fakeInfo(t, fakeServer(t, handler), props...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -35,37 +35,124 @@ func (c *Conn) DirectExec(ctx context.Context, query string, args ...interface{}
 
 // GenericExec is the central method through which SQL statements are
 // sent to ASE.
+//
+// If reconnect is enabled and the connection to the server is lost
+// while no transaction is open the connection is reestablished. The
+// statement is only sent again if ctx is tagged with WithIdempotent.
+//
+// Statements with arguments are prepared as dynamic SQL, which is
+// deallocated when the returned rows are closed.
 func (c *Conn) GenericExec(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, driver.Result, error) {
+	if err := c.ensureValid(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	identity := c.lastInsertID && isInsert(query)
+
+	rows, result, err := c.genericExec(ctx, query, args, identity)
+	if err != nil && c.retryAfterReconnect(ctx, isIdempotent(ctx)) {
+		rows, result, err = c.genericExec(ctx, query, args, identity)
+	}
+
+	return rows, result, err
+}
+
+// genericExec executes query. If identity is true the identity of the
+// inserted row is read into the result.
+func (c *Conn) genericExec(ctx context.Context, query string, args []driver.NamedValue, identity bool) (driver.Rows, driver.Result, error) {
+	if identity {
+		query = selectIdentity(query)
+	}
+
+	if len(args) > 0 {
+		parsed, err := parseQuery(query, c.placeholders)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if args, err = parsed.bind(args); err != nil {
+			return nil, nil, err
+		}
+		query = parsed.query
+	}
+
+	query, args, err := expandIn(query, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if len(args) == 0 {
 		rows, result, err := c.language(ctx, query)
 		if err != nil && !errors.Is(err, io.EOF) {
+			c.checkConnErr(err)
 			return nil, nil, fmt.Errorf("go-ase: error executing statement: %w", err)
 		}
+		c.session.recordRole(query)
+		if identity {
+			return c.readIdentity(ctx, rows, result)
+		}
 		return rows, result, nil
 	}
 
-	stmt, err := c.NewStmt(ctx, "", query, true)
+	stmt, err := c.newStmt(ctx, "", query, true)
 	if err != nil {
+		c.checkConnErr(err)
 		return nil, nil, fmt.Errorf("go-ase: error preparing dynamic SQL: %w", err)
 	}
 
 	for i := range args {
 		if err := stmt.CheckNamedValue(&args[i]); err != nil {
+			c.releaseStmt(ctx, stmt)
 			return nil, nil, fmt.Errorf("go-ase: error checking argument: %w", err)
 		}
 	}
 
-	rows, result, err := stmt.GenericExec(ctx, args)
+	rows, result, err := stmt.genericExec(ctx, args)
 	if err != nil {
+		c.checkConnErr(err)
+		c.releaseStmt(ctx, stmt)
 		return nil, nil, fmt.Errorf("go-ase: error executing dynamic SQL: %w", err)
 	}
 
+	if identity {
+		if rows, result, err = c.readIdentity(ctx, rows, result); err != nil {
+			c.releaseStmt(ctx, stmt)
+			return nil, nil, err
+		}
+	}
+
+	// The statement is deallocated once the response is read, which
+	// may be when the rows are closed.
+	if aseRows, ok := rows.(*Rows); ok && !aseRows.complete {
+		aseRows.stmt = stmt
+		return rows, result, nil
+	}
+
+	if err := stmt.close(ctx); err != nil {
+		c.checkConnErr(err)
+		return nil, nil, fmt.Errorf("go-ase: error deallocating dynamic SQL: %w", err)
+	}
+
 	return rows, result, nil
 }
 
+// releaseStmt deallocates a statement after its execution failed. The
+// statement is kept if the connection is unusable, the server drops
+// it with the session.
+func (c *Conn) releaseStmt(ctx context.Context, stmt *Stmt) {
+	if !c.IsValid() {
+		return
+	}
+
+	if err := stmt.close(ctx); err != nil {
+		c.checkConnErr(err)
+	}
+}
+
 func (c *Conn) genericResults(ctx context.Context) (driver.Rows, driver.Result, error) {
-	rows := &Rows{Conn: c}
-	result := &Result{}
+	status := newProcStatus(ctx)
+	rows := &Rows{Conn: c, status: status, computeFn: computeRowsFn(ctx)}
+	result := &Result{status: status}
 
 	_, err := c.Channel.NextPackageUntil(ctx, true,
 		func(pkg tds.Package) (bool, error) {
@@ -74,6 +161,7 @@ func (c *Conn) genericResults(ctx context.Context) (driver.Rows, driver.Result,
 				rows.RowFmt = typed
 				return true, nil
 			case *tds.DonePackage:
+				c.trackTransaction(typed)
 				if typed.Status&tds.TDS_DONE_COUNT == tds.TDS_DONE_COUNT {
 					result.rowsAffected = int64(typed.Count)
 				}
@@ -85,10 +173,14 @@ func (c *Conn) genericResults(ctx context.Context) (driver.Rows, driver.Result,
 
 				return ok, nil
 			case *tds.ReturnStatusPackage:
-				if typed.ReturnValue != 0 {
-					return true, fmt.Errorf("go-ase: query failed with return status %d", typed.ReturnValue)
+				status.set(typed.ReturnValue)
+				if err := c.checkReturnStatus(typed.ReturnValue); err != nil {
+					return true, err
 				}
 				return false, nil
+			case *tds.MsgPackage:
+				c.handleMsgPackage(typed)
+				return false, nil
 			default:
 				return false, fmt.Errorf("go-ase: unhandled package type %T", typed)
 			}
@@ -98,5 +190,8 @@ func (c *Conn) genericResults(ctx context.Context) (driver.Rows, driver.Result,
 		return nil, nil, err
 	}
 
+	// Without result set the response was read up to its end.
+	rows.complete = rows.RowFmt == nil
+
 	return rows, result, nil
 }
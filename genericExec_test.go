@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+)
+
+// dynamicServer returns one row per argument and records the prepared
+// statements that were not deallocated.
+type dynamicServer struct {
+	sync.Mutex
+	prepared    int
+	deallocated int
+	allocated   map[string]string
+}
+
+func (srv *dynamicServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	return nil
+}
+
+func (srv *dynamicServer) PrepareDynamic(ctx context.Context, session *aseserver.Session, query string) ([]aseserver.Column, error) {
+	srv.Lock()
+	defer srv.Unlock()
+
+	srv.prepared++
+	cols := make([]aseserver.Column, strings.Count(query, "?"))
+	for i := range cols {
+		cols[i] = aseserver.Column{DataType: asetypes.INT4}
+	}
+	return cols, nil
+}
+
+func (srv *dynamicServer) HandleDynamic(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.DynamicRequest) error {
+	srv.Lock()
+	srv.allocated[req.ID] = req.Query
+	srv.Unlock()
+
+	if strings.HasPrefix(req.Query, "fail") {
+		return fmt.Errorf("execution failed")
+	}
+
+	if err := w.WriteRowFmt(aseserver.Column{Name: "value", DataType: asetypes.INT4}); err != nil {
+		return err
+	}
+
+	for _, param := range req.Params {
+		if err := w.WriteRow(param.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (srv *dynamicServer) DeallocDynamic(ctx context.Context, session *aseserver.Session, id string) error {
+	srv.Lock()
+	defer srv.Unlock()
+
+	srv.deallocated++
+	delete(srv.allocated, id)
+	return nil
+}
+
+func (srv *dynamicServer) state() (int, []string) {
+	srv.Lock()
+	defer srv.Unlock()
+
+	queries := []string{}
+	for _, query := range srv.allocated {
+		queries = append(queries, query)
+	}
+	return srv.prepared, queries
+}
+
+func (srv *dynamicServer) deallocations() int {
+	srv.Lock()
+	defer srv.Unlock()
+	return srv.deallocated
+}
+
+func TestConn_GenericExecDeallocates(t *testing.T) {
+	cases := map[string]struct {
+		exec      func(db *sql.DB, srv *dynamicServer) error
+		expectErr bool
+	}{
+		"exec": {
+			exec: func(db *sql.DB, _ *dynamicServer) error {
+				_, err := db.Exec("update t set a = ?", 1)
+				return err
+			},
+		},
+		"query row": {
+			exec: func(db *sql.DB, _ *dynamicServer) error {
+				var value int
+				return db.QueryRow("select ?", 1).Scan(&value)
+			},
+		},
+		"rows closed before end": {
+			exec: func(db *sql.DB, srv *dynamicServer) error {
+				rows, err := db.Query("select ?, ?, ?", 1, 2, 3)
+				if err != nil {
+					return err
+				}
+
+				if !rows.Next() {
+					rows.Close()
+					return fmt.Errorf("no row received: %v", rows.Err())
+				}
+
+				if _, allocated := srv.state(); len(allocated) != 1 {
+					rows.Close()
+					return fmt.Errorf("expected the statement to be allocated while reading rows, allocated: %v", allocated)
+				}
+
+				return rows.Close()
+			},
+		},
+		"in list": {
+			exec: func(db *sql.DB, _ *dynamicServer) error {
+				rows, err := db.Query("select * from t where id in (?)", ase.In([]int{1, 2, 3}))
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+
+				// The server returns one row per parameter, the list is
+				// padded to four parameters.
+				n := 0
+				for rows.Next() {
+					n++
+				}
+				if n != 4 {
+					return fmt.Errorf("expected 4 rows, received %d", n)
+				}
+				return rows.Err()
+			},
+		},
+		"execution error": {
+			exec: func(db *sql.DB, _ *dynamicServer) error {
+				_, err := db.Exec("fail ?", 1)
+				return err
+			},
+			expectErr: true,
+		},
+		"argument error": {
+			exec: func(db *sql.DB, _ *dynamicServer) error {
+				// The argument cannot be converted to the integer
+				// parameter after the statement was prepared.
+				_, err := db.Exec("update t set a = ?", "a")
+				return err
+			},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &dynamicServer{allocated: map[string]string{}}
+				db := fakeDB(t, srv)
+
+				for i := 1; i <= 3; i++ {
+					err := cas.exec(db, srv)
+					if cas.expectErr != (err != nil) {
+						t.Fatalf("Execution %d: expected error %t, received %v", i, cas.expectErr, err)
+					}
+
+					prepared, allocated := srv.state()
+					if prepared != i {
+						t.Errorf("Execution %d: expected %d prepared statements, received %d", i, i, prepared)
+					}
+					if len(allocated) != 0 {
+						t.Errorf("Execution %d: statements were not deallocated: %v", i, allocated)
+					}
+					if deallocated := srv.deallocations(); deallocated != i {
+						t.Errorf("Execution %d: expected %d deallocated statements, received %d", i, i, deallocated)
+					}
+				}
+
+				if err := db.Ping(); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_OutputParameters(t *testing.T) {
+	cases := map[string]struct {
+		exec           func(db *sql.DB) error
+		expectPrepared int
+	}{
+		"exec": {
+			exec: func(db *sql.DB) error {
+				_, err := db.Exec("exec p ?", sql.Out{Dest: new(int)})
+				return err
+			},
+		},
+		"query": {
+			exec: func(db *sql.DB) error {
+				rows, err := db.Query("exec p ?", sql.Out{Dest: new(int)})
+				if err == nil {
+					rows.Close()
+				}
+				return err
+			},
+		},
+		"prepared statement": {
+			exec: func(db *sql.DB) error {
+				stmt, err := db.Prepare("exec p ?")
+				if err != nil {
+					return fmt.Errorf("preparing failed: %w", err)
+				}
+				defer stmt.Close()
+
+				_, err = stmt.Exec(sql.Out{Dest: new(int)})
+				return err
+			},
+			expectPrepared: 1,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &dynamicServer{allocated: map[string]string{}}
+				db := fakeDB(t, srv)
+
+				err := cas.exec(db)
+				if err == nil || !strings.Contains(err.Error(), "output parameters are not supported") {
+					t.Fatalf("Expected output parameters to be rejected, received %v", err)
+				}
+
+				// Output parameters are rejected before statements are
+				// prepared.
+				prepared, allocated := srv.state()
+				if prepared != cas.expectPrepared {
+					t.Errorf("Expected %d prepared statements, received %d", cas.expectPrepared, prepared)
+				}
+				if len(allocated) != 0 {
+					t.Errorf("Statements were not deallocated: %v", allocated)
+				}
+
+				if err := db.Ping(); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
@@ -6,4 +6,7 @@ module github.com/SAP/go-ase
 
 go 1.15
 
-require github.com/SAP/go-dblib v0.0.0-20201130095755-e1f42a6f557f
+require (
+	github.com/SAP/go-dblib v0.0.0-20201130095755-e1f42a6f557f
+	golang.org/x/text v0.3.8
+)
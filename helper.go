@@ -7,6 +7,8 @@ package ase
 import (
 	"fmt"
 	"io"
+	"strings"
+	"unicode"
 
 	"github.com/SAP/go-dblib/tds"
 )
@@ -32,3 +34,69 @@ func handleDonePackage(pkg *tds.DonePackage) (bool, error) {
 
 	return false, fmt.Errorf("%T with unrecognized Status: %s", pkg, pkg)
 }
+
+// quoteIdentifier returns name as an identifier usable in statements.
+//
+// Names that are not valid regular identifiers are delimited with
+// brackets, which unlike double quotes do not depend on the
+// quoted_identifier option. Names that are already delimited are
+// returned as is if the delimiter is escaped within the name.
+func quoteIdentifier(name string) string {
+	if isRegularIdentifier(name) || isDelimitedIdentifier(name) {
+		return name
+	}
+
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// isRegularIdentifier reports whether name is a regular identifier,
+// which starts with a letter, @, # or _ followed by letters, digits,
+// @, #, $ or _.
+func isRegularIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == '@', r == '#':
+		case i > 0 && (unicode.IsDigit(r) || r == '$'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isDelimitedIdentifier reports whether name is enclosed in brackets or
+// double quotes and each closing delimiter within the name is doubled.
+func isDelimitedIdentifier(name string) bool {
+	if len(name) < 2 {
+		return false
+	}
+
+	var delim byte
+	switch {
+	case name[0] == '[' && name[len(name)-1] == ']':
+		delim = ']'
+	case name[0] == '"' && name[len(name)-1] == '"':
+		delim = '"'
+	default:
+		return false
+	}
+
+	inner := name[1 : len(name)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] != delim {
+			continue
+		}
+
+		if i+1 == len(inner) || inner[i+1] != delim {
+			return false
+		}
+		i++
+	}
+
+	return true
+}
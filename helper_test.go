@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import "testing"
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := map[string]struct {
+		name   string
+		expect string
+	}{
+		"regular": {
+			name:   "master",
+			expect: "master",
+		},
+		"regular with special characters": {
+			name:   "_db$1#",
+			expect: "_db$1#",
+		},
+		"leading digit": {
+			name:   "1db",
+			expect: "[1db]",
+		},
+		"space": {
+			name:   "my db",
+			expect: "[my db]",
+		},
+		"closing bracket": {
+			name:   "a]b",
+			expect: "[a]]b]",
+		},
+		"empty": {
+			name:   "",
+			expect: "[]",
+		},
+		"delimited with brackets": {
+			name:   "[my db]",
+			expect: "[my db]",
+		},
+		"delimited with escaped bracket": {
+			name:   "[a]]b]",
+			expect: "[a]]b]",
+		},
+		"delimited with double quotes": {
+			name:   `"my db"`,
+			expect: `"my db"`,
+		},
+		"delimited with escaped double quote": {
+			name:   `"a""b"`,
+			expect: `"a""b"`,
+		},
+		"unescaped bracket": {
+			name:   "[x] shutdown --]",
+			expect: "[[x]] shutdown --]]]",
+		},
+		"unescaped bracket at end": {
+			name:   "[x]]]",
+			expect: "[x]]]",
+		},
+		"odd brackets at end": {
+			name:   "[x]]",
+			expect: "[[x]]]]]",
+		},
+		"unescaped double quote": {
+			name:   `"x" shutdown --"`,
+			expect: `["x" shutdown --"]`,
+		},
+		"single bracket": {
+			name:   "[",
+			expect: "[[]",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if quoted := quoteIdentifier(cas.name); quoted != cas.expect {
+					t.Errorf("Expected %q to be quoted as %q, received %q", cas.name, cas.expect, quoted)
+				}
+			},
+		)
+	}
+}
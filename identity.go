@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/SAP/go-ase/internal/sqllex"
+	"github.com/SAP/go-dblib"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// InsertReturningIdentity executes an insert statement on conn and
+// returns the value of the IDENTITY column of the inserted row.
+//
+// The identity is returned regardless of the last-insert-id property.
+func InsertReturningIdentity(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) (int64, error) {
+	var namedArgs []driver.NamedValue
+	if len(args) > 0 {
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg
+		}
+		namedArgs = dblib.ValuesToNamedValues(values)
+	}
+
+	var id int64
+	err := conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return fmt.Errorf("go-ase: connection of type %T is not a go-ase connection", driverConn)
+		}
+
+		var err error
+		id, err = c.InsertReturningIdentity(ctx, query, namedArgs)
+		return err
+	})
+
+	return id, err
+}
+
+// InsertReturningIdentity executes an insert statement and returns the
+// value of the IDENTITY column of the inserted row.
+//
+// The identity is returned regardless of the last-insert-id property.
+// query must be a single insert statement.
+func (c *Conn) InsertReturningIdentity(ctx context.Context, query string, args []driver.NamedValue) (int64, error) {
+	if !isInsert(query) {
+		return 0, fmt.Errorf("go-ase: query is not a single insert statement")
+	}
+
+	if err := c.ensureValid(ctx); err != nil {
+		return 0, err
+	}
+
+	rows, result, err := c.genericExec(ctx, query, args, true)
+	if err != nil && c.retryAfterReconnect(ctx, isIdempotent(ctx)) {
+		rows, result, err = c.genericExec(ctx, query, args, true)
+	}
+	if err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	return result.LastInsertId()
+}
+
+// statementKeywords start statements that cannot be part of an insert
+// statement.
+var statementKeywords = map[string]bool{
+	"alter": true, "begin": true, "commit": true, "create": true,
+	"declare": true, "delete": true, "drop": true, "exec": true,
+	"execute": true, "if": true, "insert": true, "print": true,
+	"raiserror": true, "return": true, "rollback": true, "set": true,
+	"truncate": true, "update": true, "waitfor": true, "while": true,
+}
+
+// isInsert reports whether query is a single insert statement.
+//
+// Queries with further statements are not recognized as insert, even
+// if they start with one. Statements are only recognized if they are
+// separated by a semicolon or start with a keyword of
+// statementKeywords.
+func isInsert(query string) bool {
+	tokens, err := sqllex.Lex(query, sqllex.Options{})
+	if err != nil {
+		return false
+	}
+
+	first, terminated := true, false
+	for _, token := range tokens {
+		switch token.Kind {
+		case sqllex.LineComment, sqllex.BlockComment:
+			continue
+		case sqllex.Text:
+		default:
+			if first || terminated {
+				return false
+			}
+			continue
+		}
+
+		text := strings.ReplaceAll(token.Value, ";", " ; ")
+		words := strings.FieldsFunc(text, func(r rune) bool {
+			return !(r == ';' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+		})
+
+		for _, word := range words {
+			switch {
+			case terminated:
+				return false
+			case word == ";":
+				if first {
+					return false
+				}
+				terminated = true
+			case first:
+				if !strings.EqualFold(word, "insert") {
+					return false
+				}
+				first = false
+			case statementKeywords[strings.ToLower(word)]:
+				return false
+			}
+		}
+	}
+
+	return !first
+}
+
+// selectIdentity returns query followed by a select of the identity
+// of the last inserted row.
+//
+// @@identity is read directly after the insert in the same batch or
+// stored procedure. Inserts by triggers fired by the insert do not
+// affect it, ASE restores @@identity once a trigger completes.
+func selectIdentity(query string) string {
+	// The line break terminates a trailing line comment.
+	return query + "\nselect @@identity"
+}
+
+// readIdentity reads the remainder of the response and stores the
+// identity selected by selectIdentity in the result. The identity is
+// the first value of the last result set, result sets returned before
+// the identity, e.g. by triggers, are discarded.
+//
+// rows are returned without result set. The identity is read without
+// result codecs.
+func (c *Conn) readIdentity(ctx context.Context, rows driver.Rows, result driver.Result) (driver.Rows, driver.Result, error) {
+	aseRows, aseResult := rows.(*Rows), result.(*Result)
+	if aseRows.RowFmt == nil {
+		return nil, nil, fmt.Errorf("go-ase: no identity received")
+	}
+
+	var value interface{}
+	firstRow := true
+	var eedError *tds.EEDError
+	var resultErr error
+
+	for !aseRows.complete {
+		pkg, err := c.Channel.NextPackage(ctx, true)
+		if err != nil {
+			aseRows.complete = true
+			c.checkConnErr(err)
+			return nil, nil, fmt.Errorf("go-ase: error reading identity: %w", err)
+		}
+
+		switch typed := pkg.(type) {
+		case *tds.RowFmtPackage:
+			value, firstRow = nil, true
+		case *tds.RowPackage:
+			if firstRow {
+				value = typed.DataFields[0].Value()
+				firstRow = false
+			}
+		case *tds.OrderByPackage, *tds.OrderBy2Package:
+		case *tds.EEDPackage:
+			if eedError == nil {
+				eedError = &tds.EEDError{}
+			}
+			eedError.Add(typed)
+		case *tds.MsgPackage:
+			c.handleMsgPackage(typed)
+		case *tds.ReturnStatusPackage:
+			aseRows.status.set(typed.ReturnValue)
+			if err := c.checkReturnStatus(typed.ReturnValue); err != nil && resultErr == nil {
+				resultErr = err
+			}
+		case *tds.DonePackage:
+			c.trackTransaction(typed)
+			if typed.Status&tds.TDS_DONE_ERROR == tds.TDS_DONE_ERROR && resultErr == nil {
+				resultErr = fmt.Errorf("go-ase: query failed with errors")
+			}
+			// The channel terminates each response with a
+			// TDS_DONE_FINAL, even if the server does not send one.
+			aseRows.complete = typed.Status == tds.TDS_DONE_FINAL
+		default:
+			aseRows.complete = true
+			return nil, nil, fmt.Errorf("go-ase: unexpected package %T instead of identity", typed)
+		}
+	}
+
+	// The result set of the identity is not passed on.
+	aseRows.RowFmt = nil
+	aseRows.orderBy = nil
+	aseRows.hasNextResultSet = false
+
+	if resultErr != nil {
+		if eedError != nil {
+			eedError.WrappedError = resultErr
+			resultErr = eedError
+		}
+		return nil, nil, fmt.Errorf("go-ase: error reading identity: %w", resultErr)
+	}
+
+	id, err := identityValue(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aseResult.hasLastInsertID = true
+	aseResult.lastInsertID = id
+	if id == 0 {
+		// ASE sets @@identity to 0 after inserts into tables without
+		// IDENTITY column.
+		aseResult.lastInsertIDErr = errNoIdentityColumn
+	}
+
+	return aseRows, aseResult, nil
+}
+
+// identityValue converts the value of @@identity, a numeric(38, 0).
+func identityValue(value interface{}) (int64, error) {
+	switch typed := value.(type) {
+	case *asetypes.Decimal:
+		i := typed.Int()
+		if !i.IsInt64() {
+			return 0, fmt.Errorf("go-ase: identity %s overflows int64", i)
+		}
+		return i.Int64(), nil
+	case int64:
+		return typed, nil
+	case nil:
+		return 0, fmt.Errorf("go-ase: no identity received")
+	default:
+		return 0, fmt.Errorf("go-ase: unexpected identity of type %T", value)
+	}
+}
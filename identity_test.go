@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// identityServer records the received queries. Inserts into the table
+// noident do not insert an identity, inserts into the table trig fire
+// a trigger returning a result set and inserts into the table status
+// are executed by a stored procedure returning the status 3.
+type identityServer struct {
+	sync.Mutex
+	queries []string
+}
+
+func (srv *identityServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	srv.Lock()
+	srv.queries = append(srv.queries, req.Query)
+	srv.Unlock()
+
+	if strings.Contains(req.Query, "status") {
+		if err := w.WriteReturnStatus(3); err != nil {
+			return err
+		}
+	}
+
+	if err := w.WriteDone(tds.TDS_DONE_COUNT, 1); err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(req.Query, "select @@identity") {
+		return nil
+	}
+
+	if strings.Contains(req.Query, "trig") {
+		if err := w.WriteRowFmt(aseserver.Column{Name: "trigger", DataType: asetypes.INT8}); err != nil {
+			return err
+		}
+		if err := w.WriteRow(int64(1)); err != nil {
+			return err
+		}
+		if err := w.WriteDone(tds.TDS_DONE_COUNT, 1); err != nil {
+			return err
+		}
+	}
+
+	identity := int64(7)
+	if strings.Contains(req.Query, "noident") {
+		identity = 0
+	}
+
+	if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.INT8}); err != nil {
+		return err
+	}
+	return w.WriteRow(identity)
+}
+
+func TestLastInsertId(t *testing.T) {
+	cases := map[string]struct {
+		query          string
+		expectIdentity bool
+		expectID       int64
+		expectIDErr    bool
+	}{
+		"insert": {
+			query:          "insert into t values (1)",
+			expectIdentity: true,
+			expectID:       7,
+		},
+		"insert with comment": {
+			query:          "/* a */ insert into t values (1); -- b",
+			expectIdentity: true,
+			expectID:       7,
+		},
+		"insert select": {
+			query:          "insert into t select a from s where b = 'update'",
+			expectIdentity: true,
+			expectID:       7,
+		},
+		"trigger with result set": {
+			query:          "insert into trig values (1)",
+			expectIdentity: true,
+			expectID:       7,
+		},
+		"table without identity": {
+			query:          "insert into noident values (1)",
+			expectIdentity: true,
+			expectIDErr:    true,
+		},
+		"update": {
+			query:       "update t set a = 1",
+			expectIDErr: true,
+		},
+		"statements separated by semicolon": {
+			query:       "insert into t values (1); select 1",
+			expectIDErr: true,
+		},
+		"statements without separator": {
+			query:       "insert into t values (1) update t set a = 2",
+			expectIDErr: true,
+		},
+		"multiple inserts": {
+			query:       "insert into t values (1)\ninsert into t values (2)",
+			expectIDErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &identityServer{}
+				db := fakeDB(t, srv, "last-insert-id", "true")
+
+				result, err := db.Exec(cas.query)
+				if err != nil {
+					t.Fatalf("Executing failed: %v", err)
+				}
+
+				srv.Lock()
+				query := srv.queries[len(srv.queries)-1]
+				srv.Unlock()
+				if selected := strings.HasSuffix(query, "select @@identity"); selected != cas.expectIdentity {
+					t.Errorf("Expected identity to be selected %t, received query %q", cas.expectIdentity, query)
+				}
+
+				if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+					t.Errorf("Expected 1 affected row, received %d: %v", affected, err)
+				}
+
+				id, err := result.LastInsertId()
+				if cas.expectIDErr {
+					if err == nil {
+						t.Errorf("Expected LastInsertId to fail, received %d", id)
+					}
+				} else if err != nil || id != cas.expectID {
+					t.Errorf("Expected identity %d, received %d: %v", cas.expectID, id, err)
+				}
+
+				if err := db.Ping(); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
+
+func TestInsertReturningIdentity(t *testing.T) {
+	cases := map[string]struct {
+		query     string
+		expectID  int64
+		expectErr bool
+	}{
+		"insert": {
+			query:    "insert into t values (1)",
+			expectID: 7,
+		},
+		"table without identity": {
+			query:     "insert into noident values (1)",
+			expectErr: true,
+		},
+		"multiple statements": {
+			query:     "insert into t values (1); select 1",
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, &identityServer{})
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				id, err := ase.InsertReturningIdentity(ctx, conn, cas.query)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %d", id)
+					}
+					return
+				}
+				if err != nil || id != cas.expectID {
+					t.Errorf("Expected identity %d, received %d: %v", cas.expectID, id, err)
+				}
+			},
+		)
+	}
+}
+
+func TestLastInsertId_Rows(t *testing.T) {
+	cases := map[string]struct {
+		query        string
+		expectStatus bool
+	}{
+		"insert": {
+			query: "insert into t values (1)",
+		},
+		"trigger with result set": {
+			query: "insert into trig values (1)",
+		},
+		"return status": {
+			query:        "insert into status values (1)",
+			expectStatus: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, &identityServer{}, "last-insert-id", "true")
+				ctx := context.Background()
+
+				// database/sql receives empty rows instead of the
+				// result set of the identity.
+				sqlRows, err := db.Query(cas.query)
+				if err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+				if columns, err := sqlRows.Columns(); err != nil || len(columns) != 0 {
+					t.Errorf("Expected no columns, received %v: %v", columns, err)
+				}
+				if sqlRows.Next() {
+					t.Errorf("Expected no rows")
+				}
+				if err := sqlRows.Err(); err != nil {
+					t.Errorf("Reading rows failed: %v", err)
+				}
+				if err := sqlRows.Close(); err != nil {
+					t.Errorf("Closing rows failed: %v", err)
+				}
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				err = conn.Raw(func(driverConn interface{}) error {
+					rows, result, err := driverConn.(*ase.Conn).GenericExec(ctx, cas.query, nil)
+					if err != nil {
+						return err
+					}
+					defer rows.Close()
+
+					if columns := rows.Columns(); len(columns) != 0 {
+						t.Errorf("Expected no columns, received %v", columns)
+					}
+					if err := rows.Next(make([]driver.Value, 1)); err != io.EOF {
+						t.Errorf("Expected io.EOF, received %v", err)
+					}
+
+					if id, err := result.LastInsertId(); err != nil || id != 7 {
+						t.Errorf("Expected identity 7, received %d: %v", id, err)
+					}
+
+					status, ok := ase.ReturnStatus(rows)
+					if ok != cas.expectStatus || (ok && status != 3) {
+						t.Errorf("Expected return status 3 (%t), received %d (%t)", cas.expectStatus, status, ok)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("GenericExec failed: %v", err)
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
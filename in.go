@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/SAP/go-ase/internal/sqllex"
+)
+
+// InList is an argument that is expanded to one parameter per element.
+// InLists are created with In.
+type InList struct {
+	values []interface{}
+	// err is returned when the InList is passed as argument.
+	err error
+}
+
+// In returns an argument expanding the elements of slice to the
+// placeholder it is passed for:
+//
+//	db.Query("select * from t where id in (?)", ase.In([]int{1, 2, 3, 4}))
+//
+// is executed as
+//
+//	select * from t where id in (?, ?, ?, ?)
+//
+// The number of placeholders is rounded up to the next power of two by
+// repeating the last element, so that lists of similar lengths share
+// the same statement. An empty slice is expanded to NULL, which no
+// value is IN - note that NOT IN (NULL) is not true for any value
+// either.
+//
+// If slice is not a slice or array executing the statement fails.
+// InLists can only be passed to statements that are not prepared, e.g.
+// with db.Query or db.Exec.
+func In(slice interface{}) InList {
+	rv := reflect.ValueOf(slice)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return InList{err: fmt.Errorf("go-ase: In requires a slice or array, received %T", slice)}
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+
+	return InList{values: values}
+}
+
+// inBucket returns the number of placeholders for a list of n
+// elements.
+func inBucket(n int) int {
+	bucket := 1
+	for bucket < n {
+		bucket *= 2
+	}
+	return bucket
+}
+
+// expandIn replaces the placeholders of InList arguments with one
+// placeholder per element and the InLists with their elements.
+func expandIn(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	hasIn := false
+	for _, arg := range args {
+		if list, ok := arg.Value.(InList); ok {
+			if list.err != nil {
+				return "", nil, list.err
+			}
+			hasIn = true
+		}
+	}
+	if !hasIn {
+		return query, args, nil
+	}
+
+	positions, err := sqllex.Placeholders(query, sqllex.Options{})
+	if err != nil {
+		return "", nil, fmt.Errorf("go-ase: error parsing placeholders: %w", err)
+	}
+
+	if len(positions) != len(args) {
+		return "", nil, fmt.Errorf("go-ase: query has %d placeholders, received %d arguments",
+			len(positions), len(args))
+	}
+
+	expanded := make([]driver.NamedValue, 0, len(args))
+	query = sqllex.Replace(query, positions, func(i int, _ sqllex.PlaceholderInfo) string {
+		list, ok := args[i].Value.(InList)
+		if !ok {
+			arg := args[i]
+			arg.Ordinal = len(expanded) + 1
+			expanded = append(expanded, arg)
+			return "?"
+		}
+
+		if len(list.values) == 0 {
+			return "null"
+		}
+
+		n := inBucket(len(list.values))
+		for j := 0; j < n; j++ {
+			value := list.values[len(list.values)-1]
+			if j < len(list.values) {
+				value = list.values[j]
+			}
+			expanded = append(expanded, driver.NamedValue{Ordinal: len(expanded) + 1, Value: value})
+		}
+		return "?" + strings.Repeat(", ?", n-1)
+	})
+
+	return query, expanded, nil
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestIn(t *testing.T) {
+	cases := map[string]struct {
+		slice     interface{}
+		expect    []interface{}
+		expectErr bool
+	}{
+		"slice": {
+			slice:  []int{1, 2},
+			expect: []interface{}{1, 2},
+		},
+		"array": {
+			slice:  [2]string{"a", "b"},
+			expect: []interface{}{"a", "b"},
+		},
+		"empty": {
+			slice:  []int{},
+			expect: []interface{}{},
+		},
+		"nil slice": {
+			slice:  []int(nil),
+			expect: []interface{}{},
+		},
+		"no slice": {
+			slice:     1,
+			expectErr: true,
+		},
+		"nil": {
+			slice:     nil,
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				list := In(cas.slice)
+				if cas.expectErr {
+					if list.err == nil {
+						t.Errorf("Expected an error, received %v", list.values)
+					}
+
+					c := &Conn{}
+					named := driver.NamedValue{Ordinal: 1, Value: list}
+					if err := c.CheckNamedValue(&named); err == nil {
+						t.Errorf("Expected CheckNamedValue to fail")
+					}
+					return
+				}
+				if list.err != nil {
+					t.Fatalf("In failed: %v", list.err)
+				}
+
+				if !reflect.DeepEqual(list.values, cas.expect) {
+					t.Errorf("Expected %v, received %v", cas.expect, list.values)
+				}
+			},
+		)
+	}
+}
+
+func TestInBucket(t *testing.T) {
+	cases := map[string]struct {
+		n      int
+		expect int
+	}{
+		"one":          {n: 1, expect: 1},
+		"two":          {n: 2, expect: 2},
+		"three":        {n: 3, expect: 4},
+		"power of two": {n: 8, expect: 8},
+		"above":        {n: 9, expect: 16},
+		"large":        {n: 1000, expect: 1024},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if bucket := inBucket(cas.n); bucket != cas.expect {
+					t.Errorf("Expected %d placeholders for %d elements, received %d", cas.expect, cas.n, bucket)
+				}
+			},
+		)
+	}
+}
+
+func TestExpandIn(t *testing.T) {
+	cases := map[string]struct {
+		query        string
+		args         []interface{}
+		expectQuery  string
+		expectValues []interface{}
+		expectErr    bool
+	}{
+		"without in list": {
+			query:        "select ?",
+			args:         []interface{}{1},
+			expectQuery:  "select ?",
+			expectValues: []interface{}{1},
+		},
+		"in list": {
+			query:        "select * from t where id in (?)",
+			args:         []interface{}{In([]int{1, 2, 3, 4})},
+			expectQuery:  "select * from t where id in (?, ?, ?, ?)",
+			expectValues: []interface{}{1, 2, 3, 4},
+		},
+		"padded to power of two": {
+			query:        "select * from t where id in (?)",
+			args:         []interface{}{In([]int{1, 2, 3})},
+			expectQuery:  "select * from t where id in (?, ?, ?, ?)",
+			expectValues: []interface{}{1, 2, 3, 3},
+		},
+		"padded to next bucket": {
+			query:        "select * from t where id in (?)",
+			args:         []interface{}{In([]int{1, 2, 3, 4, 5})},
+			expectQuery:  "select * from t where id in (?, ?, ?, ?, ?, ?, ?, ?)",
+			expectValues: []interface{}{1, 2, 3, 4, 5, 5, 5, 5},
+		},
+		"single element": {
+			query:        "select * from t where id in (?)",
+			args:         []interface{}{In([]int{1})},
+			expectQuery:  "select * from t where id in (?)",
+			expectValues: []interface{}{1},
+		},
+		"empty": {
+			query:        "select * from t where id in (?) and a = ?",
+			args:         []interface{}{In([]int{}), "a"},
+			expectQuery:  "select * from t where id in (null) and a = ?",
+			expectValues: []interface{}{"a"},
+		},
+		"between arguments": {
+			query:        "select * from t where a = ? and id in (?) and b = ?",
+			args:         []interface{}{"a", In([]int{1, 2, 3}), "b"},
+			expectQuery:  "select * from t where a = ? and id in (?, ?, ?, ?) and b = ?",
+			expectValues: []interface{}{"a", 1, 2, 3, 3, "b"},
+		},
+		"placeholders in strings and comments": {
+			query:        "select '?' -- ?\nwhere id in (?) /* ? */",
+			args:         []interface{}{In([]int{1, 2})},
+			expectQuery:  "select '?' -- ?\nwhere id in (?, ?) /* ? */",
+			expectValues: []interface{}{1, 2},
+		},
+		"invalid in list": {
+			query:     "select * from t where id in (?)",
+			args:      []interface{}{In(1)},
+			expectErr: true,
+		},
+		"too few arguments": {
+			query:     "select * from t where id in (?) and a = ?",
+			args:      []interface{}{In([]int{1})},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				args := make([]driver.NamedValue, len(cas.args))
+				for i, arg := range cas.args {
+					args[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+				}
+
+				query, expanded, err := expandIn(cas.query, args)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %q", query)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expanding failed: %v", err)
+				}
+
+				if query != cas.expectQuery {
+					t.Errorf("Expected query %q, received %q", cas.expectQuery, query)
+				}
+
+				if len(expanded) != len(cas.expectValues) {
+					t.Fatalf("Expected %d arguments, received %d", len(cas.expectValues), len(expanded))
+				}
+
+				for i, arg := range expanded {
+					if arg.Ordinal != i+1 || !reflect.DeepEqual(arg.Value, cas.expectValues[i]) {
+						t.Errorf("Expected argument %d to be %v, received %d: %v",
+							i+1, cas.expectValues[i], arg.Ordinal, arg.Value)
+					}
+				}
+			},
+		)
+	}
+}
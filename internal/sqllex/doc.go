@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqllex splits ASE SQL into tokens to find placeholders.
+//
+// String literals, quoted and bracketed identifiers, comments and
+// variables are recognized as single tokens, question marks in them
+// are not placeholders.
+//
+// Besides question marks named (`:name`) and optionally numbered
+// (`$1`) placeholders are recognized, which allows to share queries
+// with drivers of other databases.
+package sqllex
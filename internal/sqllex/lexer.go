@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqllex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	// Text is any SQL that is not part of another token.
+	Text Kind = iota
+	// String is a string literal in single quotes.
+	String
+	// Quoted is a string literal or identifier in double quotes,
+	// depending on the option quoted_identifier.
+	Quoted
+	// Bracketed is an identifier in brackets.
+	Bracketed
+	// LineComment is a comment starting with two dashes.
+	LineComment
+	// BlockComment is a comment in slashes and asterisks. Block
+	// comments can be nested.
+	BlockComment
+	// Variable is a local (@name) or global (@@name) variable.
+	Variable
+	// Placeholder is a question mark, a dollar sign followed by
+	// digits or a colon followed by a name.
+	Placeholder
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case Text:
+		return "Text"
+	case String:
+		return "String"
+	case Quoted:
+		return "Quoted"
+	case Bracketed:
+		return "Bracketed"
+	case LineComment:
+		return "LineComment"
+	case BlockComment:
+		return "BlockComment"
+	case Variable:
+		return "Variable"
+	case Placeholder:
+		return "Placeholder"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(kind))
+	}
+}
+
+// Token is a part of a query.
+type Token struct {
+	Kind Kind
+	// Value is the token as it is written in the query.
+	Value string
+	// Pos is the byte offset of the token in the query.
+	Pos int
+}
+
+// End returns the byte offset after the token.
+func (token Token) End() int {
+	return token.Pos + len(token.Value)
+}
+
+// Options control which placeholders are recognized.
+type Options struct {
+	// Numbered enables numbered placeholders ($1). They are written
+	// the same as money literals ($5), which are recognized instead if
+	// Numbered is not set.
+	Numbered bool
+}
+
+// Lex splits query into tokens.
+//
+// An error is returned if a string literal, quoted identifier or
+// comment is not terminated.
+func Lex(query string, opts Options) ([]Token, error) {
+	l := &lexer{query: query, opts: opts}
+
+	for l.pos < len(query) {
+		start := l.pos
+
+		kind, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		l.emit(kind, start)
+	}
+	l.flushText(l.pos)
+
+	return l.tokens, nil
+}
+
+type lexer struct {
+	query  string
+	opts   Options
+	pos    int
+	tokens []Token
+
+	// textStart is the offset of the pending text token if hasText
+	// is set.
+	textStart int
+	hasText   bool
+}
+
+// emit records the token from start to the current position. Text is
+// collected until the next token of another kind.
+func (l *lexer) emit(kind Kind, start int) {
+	if kind == Text {
+		if !l.hasText {
+			l.textStart, l.hasText = start, true
+		}
+		return
+	}
+
+	l.flushText(start)
+	l.tokens = append(l.tokens, Token{Kind: kind, Value: l.query[start:l.pos], Pos: start})
+}
+
+// flushText records the pending text token ending at end.
+func (l *lexer) flushText(end int) {
+	if !l.hasText {
+		return
+	}
+
+	l.tokens = append(l.tokens, Token{Kind: Text, Value: l.query[l.textStart:end], Pos: l.textStart})
+	l.hasText = false
+}
+
+// next advances past the next token and returns its kind. Text is
+// advanced by single bytes.
+func (l *lexer) next() (Kind, error) {
+	rest := l.query[l.pos:]
+
+	switch c := rest[0]; {
+	case c == '\'':
+		return String, l.quoted('\'', "string literal")
+	case c == '"':
+		return Quoted, l.quoted('"', "quoted identifier")
+	case c == '[':
+		return Bracketed, l.quoted(']', "bracketed identifier")
+	case strings.HasPrefix(rest, "--"):
+		end := strings.IndexByte(rest, '\n')
+		if end < 0 {
+			end = len(rest)
+		}
+		l.pos += end
+		return LineComment, nil
+	case strings.HasPrefix(rest, "/*"):
+		return BlockComment, l.blockComment()
+	case c == '@':
+		l.pos++
+		if l.pos < len(l.query) && l.query[l.pos] == '@' {
+			l.pos++
+		}
+		l.skipIdentifier()
+		return Variable, nil
+	case c == '?':
+		l.pos++
+		return Placeholder, nil
+	case c == '$' && l.opts.Numbered && !l.afterIdentifier() && len(rest) > 1 && isDigit(rest[1]):
+		end := 1
+		for end < len(rest) && isDigit(rest[end]) {
+			end++
+		}
+		// Dollar signs also prefix money literals like $1.50.
+		if end < len(rest) && rest[end] == '.' {
+			l.pos += end
+			return Text, nil
+		}
+		l.pos += end
+		return Placeholder, nil
+	case c == ':' && !l.afterIdentifier() && !l.after(':') && len(rest) > 1 && isNameStart(rest[1]):
+		l.pos++
+		l.skipIdentifier()
+		return Placeholder, nil
+	case isIdentifier(c):
+		l.skipIdentifier()
+		return Text, nil
+	default:
+		l.pos++
+		return Text, nil
+	}
+}
+
+// quoted advances past a literal ending with quote. Quotes in the
+// literal are escaped by doubling them.
+func (l *lexer) quoted(quote byte, what string) error {
+	start := l.pos
+	for l.pos++; l.pos < len(l.query); l.pos++ {
+		if l.query[l.pos] != quote {
+			continue
+		}
+
+		if l.pos+1 < len(l.query) && l.query[l.pos+1] == quote {
+			l.pos++
+			continue
+		}
+
+		l.pos++
+		return nil
+	}
+
+	return fmt.Errorf("sqllex: unterminated %s at offset %d", what, start)
+}
+
+// blockComment advances past a possibly nested block comment.
+func (l *lexer) blockComment() error {
+	start := l.pos
+	depth := 0
+
+	for l.pos < len(l.query) {
+		rest := l.query[l.pos:]
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			depth++
+			l.pos += 2
+		case strings.HasPrefix(rest, "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return nil
+			}
+		default:
+			l.pos++
+		}
+	}
+
+	return fmt.Errorf("sqllex: unterminated comment at offset %d", start)
+}
+
+func (l *lexer) skipIdentifier() {
+	for l.pos < len(l.query) && isIdentifier(l.query[l.pos]) {
+		l.pos++
+	}
+}
+
+// afterIdentifier reports whether the current position directly follows
+// an identifier character, e.g. the dollar sign in t$1 is part of the
+// identifier.
+func (l *lexer) afterIdentifier() bool {
+	return l.pos > 0 && isIdentifier(l.query[l.pos-1])
+}
+
+func (l *lexer) after(c byte) bool {
+	return l.pos > 0 && l.query[l.pos-1] == c
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+// isIdentifier reports whether c can be part of an identifier. Bytes of
+// multibyte characters are treated as identifier characters.
+func isIdentifier(c byte) bool {
+	return isNameStart(c) || isDigit(c) || c == '@' || c == '#' || c == '$'
+}
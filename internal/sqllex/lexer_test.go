@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqllex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	cases := map[string]struct {
+		query  string
+		opts   Options
+		expect []Token
+	}{
+		"empty": {
+			query: "",
+		},
+		"text": {
+			query:  "select 1",
+			expect: []Token{{Text, "select 1", 0}},
+		},
+		"question mark": {
+			query: "select ? from t",
+			expect: []Token{
+				{Text, "select ", 0},
+				{Placeholder, "?", 7},
+				{Text, " from t", 8},
+			},
+		},
+		"string": {
+			query: "select 'a ? b'",
+			expect: []Token{
+				{Text, "select ", 0},
+				{String, "'a ? b'", 7},
+			},
+		},
+		"string with escaped quote": {
+			query: "select 'it''s ?', ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{String, "'it''s ?'", 7},
+				{Text, ", ", 16},
+				{Placeholder, "?", 18},
+			},
+		},
+		"empty string": {
+			query: "select '', ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{String, "''", 7},
+				{Text, ", ", 9},
+				{Placeholder, "?", 11},
+			},
+		},
+		"quoted identifier": {
+			query: `select "a ""?"" b" from t`,
+			expect: []Token{
+				{Text, "select ", 0},
+				{Quoted, `"a ""?"" b"`, 7},
+				{Text, " from t", 18},
+			},
+		},
+		"bracketed identifier": {
+			query: "select [a ? b] from t",
+			expect: []Token{
+				{Text, "select ", 0},
+				{Bracketed, "[a ? b]", 7},
+				{Text, " from t", 14},
+			},
+		},
+		"bracketed identifier with escaped bracket": {
+			query: "select [a]] ?] = ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{Bracketed, "[a]] ?]", 7},
+				{Text, " = ", 14},
+				{Placeholder, "?", 17},
+			},
+		},
+		"line comment": {
+			query: "select ? -- ?\n, ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{Placeholder, "?", 7},
+				{Text, " ", 8},
+				{LineComment, "-- ?", 9},
+				{Text, "\n, ", 13},
+				{Placeholder, "?", 16},
+			},
+		},
+		"line comment at end": {
+			query: "select 1 -- ?",
+			expect: []Token{
+				{Text, "select 1 ", 0},
+				{LineComment, "-- ?", 9},
+			},
+		},
+		"block comment": {
+			query: "select /* ? */ ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{BlockComment, "/* ? */", 7},
+				{Text, " ", 14},
+				{Placeholder, "?", 15},
+			},
+		},
+		"nested block comment": {
+			query: "select /* a /* ? */ ? */ ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{BlockComment, "/* a /* ? */ ? */", 7},
+				{Text, " ", 24},
+				{Placeholder, "?", 25},
+			},
+		},
+		"quotes in comments": {
+			query: "select /* it's */ ? -- it's\n",
+			expect: []Token{
+				{Text, "select ", 0},
+				{BlockComment, "/* it's */", 7},
+				{Text, " ", 17},
+				{Placeholder, "?", 18},
+				{Text, " ", 19},
+				{LineComment, "-- it's", 20},
+				{Text, "\n", 27},
+			},
+		},
+		"comment start in string": {
+			query: "select '/*', ?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{String, "'/*'", 7},
+				{Text, ", ", 11},
+				{Placeholder, "?", 13},
+			},
+		},
+		"variables": {
+			query: "select @a, @@identity, @a$1",
+			opts:  Options{Numbered: true},
+			expect: []Token{
+				{Text, "select ", 0},
+				{Variable, "@a", 7},
+				{Text, ", ", 9},
+				{Variable, "@@identity", 11},
+				{Text, ", ", 21},
+				{Variable, "@a$1", 23},
+			},
+		},
+		"money without numbered placeholders": {
+			query:  "select $5, $1.50",
+			expect: []Token{{Text, "select $5, $1.50", 0}},
+		},
+		"numbered placeholders": {
+			query: "select $1, $12",
+			opts:  Options{Numbered: true},
+			expect: []Token{
+				{Text, "select ", 0},
+				{Placeholder, "$1", 7},
+				{Text, ", ", 9},
+				{Placeholder, "$12", 11},
+			},
+		},
+		"money with numbered placeholders": {
+			query: "select $1.50, $1",
+			opts:  Options{Numbered: true},
+			expect: []Token{
+				{Text, "select $1.50, ", 0},
+				{Placeholder, "$1", 14},
+			},
+		},
+		"dollar sign in identifier": {
+			query:  "select t$1 from t",
+			opts:   Options{Numbered: true},
+			expect: []Token{{Text, "select t$1 from t", 0}},
+		},
+		"named placeholders": {
+			query: "select :a, :b_1",
+			expect: []Token{
+				{Text, "select ", 0},
+				{Placeholder, ":a", 7},
+				{Text, ", ", 9},
+				{Placeholder, ":b_1", 11},
+			},
+		},
+		"colon after identifier": {
+			query:  "label: select a::b, :1",
+			expect: []Token{{Text, "label: select a::b, :1", 0}},
+		},
+		"multibyte characters": {
+			query: "select 'ä', ü?",
+			expect: []Token{
+				{Text, "select ", 0},
+				{String, "'ä'", 7},
+				{Text, ", ü", 11},
+				{Placeholder, "?", 15},
+			},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				tokens, err := Lex(cas.query, cas.opts)
+				if err != nil {
+					t.Fatalf("Lexing failed: %v", err)
+				}
+
+				if !reflect.DeepEqual(tokens, cas.expect) {
+					t.Errorf("Expected tokens %v, received %v", cas.expect, tokens)
+				}
+			},
+		)
+	}
+}
+
+func TestLex_Errors(t *testing.T) {
+	cases := map[string]string{
+		"unterminated string":               "select 'a",
+		"unterminated escaped string":       "select 'a''",
+		"unterminated quoted identifier":    `select "a`,
+		"unterminated bracketed identifier": "select [a",
+		"unterminated escaped bracket":      "select [a]]",
+		"unterminated block comment":        "select /* a",
+		"unterminated nested block comment": "select /* a /* b */",
+	}
+
+	for title, query := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if tokens, err := Lex(query, Options{}); err == nil {
+					t.Errorf("Expected lexing %q to fail, received %v", query, tokens)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqllex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Style is the style of a placeholder.
+type Style int
+
+const (
+	// QuestionMark placeholders are bound by position.
+	QuestionMark Style = iota + 1
+	// Numbered placeholders ($1) are bound to the argument with the
+	// number.
+	Numbered
+	// Named placeholders (:name) are bound to the argument with the
+	// name.
+	Named
+)
+
+// PlaceholderInfo describes a placeholder in a query.
+type PlaceholderInfo struct {
+	Token
+	Style Style
+	// Index is the number of numbered placeholders.
+	Index int
+	// Name is the name of named placeholders.
+	Name string
+}
+
+// Placeholders returns the placeholders of query in order.
+//
+// Numbered and named placeholders are only recognized if query does
+// not contain question marks, so that queries written for question
+// marks keep their meaning. An error is returned if numbered and named
+// placeholders are mixed.
+func Placeholders(query string, opts Options) ([]PlaceholderInfo, error) {
+	tokens, err := Lex(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []PlaceholderInfo
+	hasQuestionMark := false
+
+	for _, token := range tokens {
+		if token.Kind != Placeholder {
+			continue
+		}
+
+		info := PlaceholderInfo{Token: token}
+		switch token.Value[0] {
+		case '?':
+			info.Style = QuestionMark
+			hasQuestionMark = true
+		case '$':
+			info.Style = Numbered
+			info.Index, err = strconv.Atoi(token.Value[1:])
+			if err != nil || info.Index == 0 {
+				return nil, fmt.Errorf("sqllex: invalid placeholder %s at offset %d", token.Value, token.Pos)
+			}
+		case ':':
+			info.Style = Named
+			info.Name = token.Value[1:]
+		}
+		infos = append(infos, info)
+	}
+
+	if hasQuestionMark {
+		filtered := infos[:0]
+		for _, info := range infos {
+			if info.Style == QuestionMark {
+				filtered = append(filtered, info)
+			}
+		}
+		return filtered, nil
+	}
+
+	for _, info := range infos {
+		if info.Style != infos[0].Style {
+			return nil, fmt.Errorf("sqllex: placeholder %s at offset %d mixes numbered and named placeholders",
+				info.Value, info.Pos)
+		}
+	}
+
+	return infos, nil
+}
+
+// Replace returns query with the placeholders replaced by the return
+// value of repl.
+func Replace(query string, placeholders []PlaceholderInfo, repl func(i int, info PlaceholderInfo) string) string {
+	var b strings.Builder
+	last := 0
+
+	for i, info := range placeholders {
+		b.WriteString(query[last:info.Pos])
+		b.WriteString(repl(i, info))
+		last = info.End()
+	}
+	b.WriteString(query[last:])
+
+	return b.String()
+}
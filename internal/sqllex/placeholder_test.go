@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sqllex
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	cases := map[string]struct {
+		query       string
+		opts        Options
+		expect      []string
+		expectStyle Style
+		expectErr   bool
+	}{
+		"none": {
+			query: "select 1",
+		},
+		"question marks": {
+			query:       "select ?, '?', ?",
+			expect:      []string{"?", "?"},
+			expectStyle: QuestionMark,
+		},
+		"question marks take precedence": {
+			query:       "select ?, :a, $1",
+			opts:        Options{Numbered: true},
+			expect:      []string{"?"},
+			expectStyle: QuestionMark,
+		},
+		"numbered": {
+			query:       "select $2, $1, $2",
+			opts:        Options{Numbered: true},
+			expect:      []string{"$2", "$1", "$2"},
+			expectStyle: Numbered,
+		},
+		"money literal": {
+			query:       "select $5 where a = :a",
+			expect:      []string{":a"},
+			expectStyle: Named,
+		},
+		"named": {
+			query:       "select :a, [:b], :a",
+			expect:      []string{":a", ":a"},
+			expectStyle: Named,
+		},
+		"numbered zero": {
+			query:     "select $0",
+			opts:      Options{Numbered: true},
+			expectErr: true,
+		},
+		"mixed": {
+			query:     "select $1, :a",
+			opts:      Options{Numbered: true},
+			expectErr: true,
+		},
+		"unterminated string": {
+			query:     "select '?",
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				infos, err := Placeholders(cas.query, cas.opts)
+				if cas.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error, received %v", infos)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Parsing placeholders failed: %v", err)
+				}
+
+				if len(infos) != len(cas.expect) {
+					t.Fatalf("Expected placeholders %v, received %v", cas.expect, infos)
+				}
+
+				for i, info := range infos {
+					if info.Value != cas.expect[i] || info.Style != cas.expectStyle {
+						t.Errorf("Expected placeholder %s of style %d, received %s of style %d",
+							cas.expect[i], cas.expectStyle, info.Value, info.Style)
+					}
+
+					switch info.Style {
+					case Numbered:
+						if "$"+strconv.Itoa(info.Index) != info.Value {
+							t.Errorf("Expected index of %s, received %d", info.Value, info.Index)
+						}
+					case Named:
+						if ":"+info.Name != info.Value {
+							t.Errorf("Expected name of %s, received %s", info.Value, info.Name)
+						}
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	query := "select :a, ':b', :c"
+
+	infos, err := Placeholders(query, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := Replace(query, infos, func(i int, info PlaceholderInfo) string {
+		return "@" + info.Name
+	})
+
+	if expect := "select @a, ':b', @c"; replaced != expect {
+		t.Errorf("Expected %q, received %q", expect, replaced)
+	}
+}
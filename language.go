@@ -13,6 +13,11 @@ import (
 )
 
 func (c Conn) language(ctx context.Context, query string) (driver.Rows, driver.Result, error) {
+	query, err := c.encodeString(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	langPkg := &tds.LanguagePackage{
 		Status: tds.TDS_LANGUAGE_NOARGS,
 		Cmd:    query,
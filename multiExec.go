@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ResultSet is a result set returned by a statement executed with
+// ExecMulti.
+type ResultSet struct {
+	Columns []string
+	// OrderBy are the indices of the columns the rows are ordered by,
+	// as returned by Rows.OrderBy.
+	OrderBy []int
+	Rows    [][]driver.Value
+	// ComputeRows are the rows computed by compute clauses, see
+	// WithComputeRows.
+	ComputeRows []ComputeRow
+}
+
+// StatementResult is the result of a statement executed with
+// ExecMulti.
+type StatementResult struct {
+	// RowsAffected is the last count of affected rows the statement
+	// reported or -1 if it did not report a count.
+	RowsAffected int64
+	// ResultSets are the result sets returned by the statement.
+	ResultSets []ResultSet
+	// ReturnStatus is the return status of a stored procedure executed
+	// by the statement, HasReturnStatus reports whether the statement
+	// returned a status. A non-zero status is only an error if the
+	// strict-return-status property is set.
+	ReturnStatus    int32
+	HasReturnStatus bool
+	// Messages are the errors and warnings the server sent while
+	// executing the statement. Informational messages are not passed
+	// on by go-dblib.
+	Messages []tds.EEDPackage
+	// Err is the error of the statement. Errors reported by the server
+	// are of type *tds.EEDError.
+	Err error
+}
+
+// ExecMulti executes a batch of statements and returns one result per
+// statement.
+//
+// Unlike GenericExec the results of all statements are kept apart,
+// result sets are read completely. Statements are separated by the
+// server, the statements executed by a stored procedure are part of
+// the result of the statement executing the procedure.
+//
+// The error is non-nil if any statement failed. Whether the statements
+// following a failed statement are executed is decided by the server.
+// If the results could not be read the results of the statements read
+// so far are returned along with the error.
+func (c *Conn) ExecMulti(ctx context.Context, query string) ([]StatementResult, error) {
+	if err := c.ensureValid(ctx); err != nil {
+		return nil, err
+	}
+
+	results, err := c.execMulti(ctx, query)
+	if err != nil && c.retryAfterReconnect(ctx, isIdempotent(ctx)) {
+		results, err = c.execMulti(ctx, query)
+	}
+
+	return results, err
+}
+
+func (c *Conn) execMulti(ctx context.Context, query string) ([]StatementResult, error) {
+	encoded, err := c.encodeString(query)
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: %w", err)
+	}
+
+	langPkg := &tds.LanguagePackage{
+		Status: tds.TDS_LANGUAGE_NOARGS,
+		Cmd:    encoded,
+	}
+
+	if err := c.Channel.SendPackage(ctx, langPkg); err != nil {
+		c.checkConnErr(err)
+		return nil, fmt.Errorf("go-ase: error sending language command: %w", err)
+	}
+
+	results, err := c.recvMulti(ctx)
+	if err != nil {
+		c.checkConnErr(err)
+		// The rest of the response is still pending.
+		if c.health != nil {
+			c.health.markBad(err)
+		}
+		return results, fmt.Errorf("go-ase: error reading results: %w", err)
+	}
+	c.session.recordRole(query)
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("go-ase: %d of %d statements failed", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// recvMulti reads the response to a batch of statements.
+func (c *Conn) recvMulti(ctx context.Context) ([]StatementResult, error) {
+	cs := c.charset()
+	rows := &Rows{Conn: c}
+
+	var results []StatementResult
+	current := StatementResult{RowsAffected: -1}
+	empty := true
+	// ended is true if the last statement ended the response, the
+	// channel terminates the response with another TDS_DONE_FINAL.
+	ended := false
+
+	for {
+		pkg, err := c.Channel.NextPackage(ctx, true)
+		if err != nil {
+			return results, err
+		}
+
+		switch typed := pkg.(type) {
+		case *tds.RowFmtPackage:
+			rows.RowFmt = typed
+			current.ResultSets = append(current.ResultSets, ResultSet{Columns: rows.Columns()})
+			empty = false
+		case *tds.RowPackage:
+			if len(current.ResultSets) == 0 {
+				return results, fmt.Errorf("received row without row format")
+			}
+
+			values := make([]driver.Value, len(typed.DataFields))
+			if err := rows.rowValues(typed, values, cs); err != nil && current.Err == nil {
+				current.Err = err
+			}
+
+			set := &current.ResultSets[len(current.ResultSets)-1]
+			set.Rows = append(set.Rows, values)
+		case *tds.OrderByPackage, *tds.OrderBy2Package:
+			if len(current.ResultSets) > 0 {
+				current.ResultSets[len(current.ResultSets)-1].OrderBy = orderByColumns(typed)
+			}
+		case *tds.EEDPackage:
+			current.Messages = append(current.Messages, *typed)
+			empty = false
+		case *tds.MsgPackage:
+			c.handleMsgPackage(typed)
+		case *tds.ReturnStatusPackage:
+			current.ReturnStatus = typed.ReturnValue
+			current.HasReturnStatus = true
+			if err := c.checkReturnStatus(typed.ReturnValue); err != nil && current.Err == nil {
+				current.Err = err
+			}
+			empty = false
+		case *tds.DonePackage:
+			c.trackTransaction(typed)
+			if ended && typed.Status == tds.TDS_DONE_FINAL && empty {
+				return results, nil
+			}
+
+			if typed.Status&tds.TDS_DONE_COUNT == tds.TDS_DONE_COUNT {
+				current.RowsAffected = int64(typed.Count)
+			}
+
+			if typed.Status&tds.TDS_DONE_ERROR == tds.TDS_DONE_ERROR && current.Err == nil {
+				current.Err = fmt.Errorf("go-ase: statement failed")
+			}
+
+			// Statements executed by a stored procedure are terminated
+			// with TDS_DONE_PROC, the procedure is terminated after
+			// its return status.
+			if typed.Status&tds.TDS_DONE_PROC == tds.TDS_DONE_PROC &&
+				typed.Status&tds.TDS_DONE_MORE == tds.TDS_DONE_MORE &&
+				!current.HasReturnStatus {
+				empty = false
+				continue
+			}
+
+			results = append(results, current.finish())
+			current = StatementResult{RowsAffected: -1}
+			empty = true
+
+			if typed.Status == tds.TDS_DONE_FINAL {
+				return results, nil
+			}
+			ended = typed.Status&tds.TDS_DONE_MORE != tds.TDS_DONE_MORE
+		default:
+			compute, ok := isComputePackage(pkg)
+			if !ok {
+				return results, fmt.Errorf("unhandled package type %T", typed)
+			}
+			if len(current.ResultSets) == 0 {
+				return results, fmt.Errorf("received compute row without result set")
+			}
+
+			computed, err := rows.computeRows(compute)
+			if err != nil {
+				return results, err
+			}
+
+			set := &current.ResultSets[len(current.ResultSets)-1]
+			set.ComputeRows = append(set.ComputeRows, computed...)
+		}
+	}
+}
+
+// finish sets the error of the result if the server reported an error
+// and returns the result.
+func (result StatementResult) finish() StatementResult {
+	eedError := &tds.EEDError{}
+	for i := range result.Messages {
+		// Messages with a severity of up to 10 are informational.
+		if result.Messages[i].Class > 10 {
+			eedError.Add(&result.Messages[i])
+		}
+	}
+
+	if len(eedError.EEDPackages) == 0 {
+		return result
+	}
+
+	if result.Err == nil {
+		result.Err = fmt.Errorf("go-ase: statement failed")
+	}
+	eedError.WrappedError = result.Err
+	result.Err = eedError
+
+	return result
+}
@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// multiServer responds to a language request with the function
+// registered for its query.
+type multiServer map[string]func(w *aseserver.ResponseWriter) error
+
+func (srv multiServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	if fn, ok := srv[req.Query]; ok {
+		return fn(w)
+	}
+	return nil
+}
+
+// writeSelect writes a result set with values as rows of a single
+// column.
+func writeSelect(w *aseserver.ResponseWriter, status tds.DoneState, values ...int32) error {
+	if err := w.WriteRowFmt(aseserver.Column{Name: "value", DataType: asetypes.INT4}); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := w.WriteRow(value); err != nil {
+			return err
+		}
+	}
+	return w.WriteDone(status|tds.TDS_DONE_COUNT, int32(len(values)))
+}
+
+func TestConn_ExecMulti(t *testing.T) {
+	type result struct {
+		rowsAffected int64
+		resultSets   [][][]driver.Value
+		returnStatus int32
+		hasStatus    bool
+		messages     int
+		serverErr    bool
+	}
+
+	cases := map[string]struct {
+		respond   func(w *aseserver.ResponseWriter) error
+		expect    []result
+		expectErr bool
+	}{
+		"statement without done": {
+			respond: func(w *aseserver.ResponseWriter) error { return nil },
+			expect:  []result{{rowsAffected: -1}},
+		},
+		"trailing done final": {
+			respond: func(w *aseserver.ResponseWriter) error {
+				return w.WriteDone(tds.TDS_DONE_COUNT, 3)
+			},
+			expect: []result{{rowsAffected: 3}},
+		},
+		"statements": {
+			respond: func(w *aseserver.ResponseWriter) error {
+				if err := writeSelect(w, 0, 1, 2); err != nil {
+					return err
+				}
+				if err := w.WriteDone(tds.TDS_DONE_COUNT, 5); err != nil {
+					return err
+				}
+				return writeSelect(w, 0)
+			},
+			expect: []result{
+				{rowsAffected: 2, resultSets: [][][]driver.Value{{{int32(1)}, {int32(2)}}}},
+				{rowsAffected: 5},
+				{rowsAffected: 0, resultSets: [][][]driver.Value{nil}},
+			},
+		},
+		"stored procedure": {
+			respond: func(w *aseserver.ResponseWriter) error {
+				if err := writeSelect(w, tds.TDS_DONE_PROC, 1); err != nil {
+					return err
+				}
+				if err := writeSelect(w, tds.TDS_DONE_PROC, 2, 3); err != nil {
+					return err
+				}
+				if err := w.WriteReturnStatus(4); err != nil {
+					return err
+				}
+				if err := w.WriteDone(tds.TDS_DONE_PROC, 0); err != nil {
+					return err
+				}
+				return w.WriteDone(tds.TDS_DONE_COUNT, 1)
+			},
+			expect: []result{
+				{
+					rowsAffected: 2,
+					resultSets:   [][][]driver.Value{{{int32(1)}}, {{int32(2)}, {int32(3)}}},
+					returnStatus: 4,
+					hasStatus:    true,
+				},
+				{rowsAffected: 1},
+			},
+		},
+		"error between statements": {
+			respond: func(w *aseserver.ResponseWriter) error {
+				if err := w.WriteDone(tds.TDS_DONE_COUNT, 1); err != nil {
+					return err
+				}
+				if err := w.WriteMessage(&aseserver.Error{MsgNumber: 208, Severity: 16, Message: "t not found"}); err != nil {
+					return err
+				}
+				if err := w.WriteDone(tds.TDS_DONE_ERROR, 0); err != nil {
+					return err
+				}
+				return w.WriteDone(tds.TDS_DONE_COUNT, 2)
+			},
+			expect: []result{
+				{rowsAffected: 1},
+				{rowsAffected: -1, messages: 1, serverErr: true},
+				{rowsAffected: 2},
+			},
+			expectErr: true,
+		},
+		"error ending the response": {
+			respond: func(w *aseserver.ResponseWriter) error {
+				if err := w.WriteDone(tds.TDS_DONE_COUNT, 1); err != nil {
+					return err
+				}
+				return errors.New("statement failed")
+			},
+			expect: []result{
+				{rowsAffected: 1},
+				{rowsAffected: -1, messages: 1, serverErr: true},
+			},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, multiServer{"batch": cas.respond})
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				var results []ase.StatementResult
+				err = conn.Raw(func(driverConn interface{}) error {
+					results, err = driverConn.(*ase.Conn).ExecMulti(ctx, "batch")
+					return err
+				})
+				if cas.expectErr != (err != nil) {
+					t.Errorf("Expected error %t, received %v", cas.expectErr, err)
+				}
+
+				if len(results) != len(cas.expect) {
+					t.Fatalf("Expected %d results, received %d: %v", len(cas.expect), len(results), results)
+				}
+
+				for i, result := range results {
+					expect := cas.expect[i]
+
+					if result.RowsAffected != expect.rowsAffected {
+						t.Errorf("Statement %d: expected %d affected rows, received %d", i, expect.rowsAffected, result.RowsAffected)
+					}
+
+					sets := make([][][]driver.Value, len(result.ResultSets))
+					for j, set := range result.ResultSets {
+						sets[j] = set.Rows
+					}
+					if len(sets) != len(expect.resultSets) || (len(sets) > 0 && !reflect.DeepEqual(sets, expect.resultSets)) {
+						t.Errorf("Statement %d: expected result sets %v, received %v", i, expect.resultSets, sets)
+					}
+
+					if result.ReturnStatus != expect.returnStatus || result.HasReturnStatus != expect.hasStatus {
+						t.Errorf("Statement %d: expected return status %d (%t), received %d (%t)",
+							i, expect.returnStatus, expect.hasStatus, result.ReturnStatus, result.HasReturnStatus)
+					}
+
+					if len(result.Messages) != expect.messages {
+						t.Errorf("Statement %d: expected %d messages, received %d", i, expect.messages, len(result.Messages))
+					}
+
+					var eedErr *tds.EEDError
+					if expect.serverErr != errors.As(result.Err, &eedErr) {
+						t.Errorf("Statement %d: expected server error %t, received %v", i, expect.serverErr, result.Err)
+					}
+					if !expect.serverErr && result.Err != nil {
+						t.Errorf("Statement %d: unexpected error: %v", i, result.Err)
+					}
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
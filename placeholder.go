@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/SAP/go-ase/internal/sqllex"
+)
+
+// parsedQuery is a query whose numbered or named placeholders are
+// rewritten to question marks, which are the only placeholders ASE
+// accepts.
+type parsedQuery struct {
+	query string
+	// params are the placeholders of the original query in the order
+	// of the question marks. params is nil if the query uses question
+	// marks.
+	params []sqllex.PlaceholderInfo
+	// names are the distinct names of named placeholders in the order
+	// of their first occurrence.
+	names []string
+}
+
+// parseQuery rewrites the numbered or named placeholders of query to
+// question marks.
+func parseQuery(query string, opts sqllex.Options) (*parsedQuery, error) {
+	placeholders, err := sqllex.Placeholders(query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("go-ase: error parsing placeholders: %w", err)
+	}
+
+	if len(placeholders) == 0 || placeholders[0].Style == sqllex.QuestionMark {
+		return &parsedQuery{query: query}, nil
+	}
+
+	parsed := &parsedQuery{params: placeholders}
+
+	seen := map[string]bool{}
+	for _, param := range placeholders {
+		if param.Style == sqllex.Named && !seen[param.Name] {
+			seen[param.Name] = true
+			parsed.names = append(parsed.names, param.Name)
+		}
+	}
+
+	parsed.query = sqllex.Replace(query, placeholders, func(int, sqllex.PlaceholderInfo) string {
+		return "?"
+	})
+
+	return parsed, nil
+}
+
+// numInput returns the number of arguments the query expects or -1 if
+// the query uses question marks.
+func (q *parsedQuery) numInput() int {
+	if q.params == nil {
+		return -1
+	}
+
+	if len(q.names) > 0 {
+		return len(q.names)
+	}
+
+	highest := 0
+	for _, param := range q.params {
+		if param.Index > highest {
+			highest = param.Index
+		}
+	}
+	return highest
+}
+
+// position returns the index of the first question mark arg is bound
+// to.
+func (q *parsedQuery) position(arg driver.NamedValue) int {
+	if q.params == nil {
+		return arg.Ordinal - 1
+	}
+
+	for i, param := range q.params {
+		switch {
+		case param.Style == sqllex.Numbered && param.Index == arg.Ordinal,
+			param.Style == sqllex.Named && param.Name == q.argName(arg):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// skipped reports whether arg is not bound to a placeholder as the
+// numbered placeholders of the query skip its number.
+func (q *parsedQuery) skipped(arg driver.NamedValue) bool {
+	return len(q.params) > 0 && len(q.names) == 0 &&
+		arg.Ordinal >= 1 && arg.Ordinal <= q.numInput() && q.position(arg) < 0
+}
+
+// argName returns the name of the named placeholder arg is bound to.
+// Arguments without name are bound to the names in the order of their
+// first occurrence.
+func (q *parsedQuery) argName(arg driver.NamedValue) string {
+	if arg.Name != "" {
+		return arg.Name
+	}
+
+	if arg.Ordinal >= 1 && arg.Ordinal <= len(q.names) {
+		return q.names[arg.Ordinal-1]
+	}
+
+	return ""
+}
+
+// bind returns the arguments in the order of the question marks.
+func (q *parsedQuery) bind(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	if q.params == nil {
+		return args, nil
+	}
+
+	if len(args) != q.numInput() {
+		return nil, fmt.Errorf("go-ase: query expects %d arguments, received %d", q.numInput(), len(args))
+	}
+
+	byPlaceholder := map[string]driver.NamedValue{}
+	for _, arg := range args {
+		key := q.argName(arg)
+		if len(q.names) == 0 {
+			key = fmt.Sprintf("$%d", arg.Ordinal)
+		}
+		byPlaceholder[key] = arg
+	}
+
+	bound := make([]driver.NamedValue, len(q.params))
+	for i, param := range q.params {
+		key := param.Name
+		if param.Style == sqllex.Numbered {
+			key = fmt.Sprintf("$%d", param.Index)
+		}
+
+		arg, ok := byPlaceholder[key]
+		if !ok {
+			return nil, fmt.Errorf("go-ase: no argument for placeholder %s", param.Value)
+		}
+
+		bound[i] = driver.NamedValue{Ordinal: i + 1, Value: arg.Value}
+	}
+
+	return bound, nil
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// ReconnectHook defines the signature of functions called when go-ase
+// reconnected a connection after the connection to the server was
+// lost.
+//
+// from is the address of the server the connection was lost to, to the
+// address of the server go-ase reconnected to and reason the error that
+// invalidated the connection.
+type ReconnectHook func(from, to string, reason error)
+
+type idempotentCtxKey struct{}
+
+// WithIdempotent returns a context tagging statements executed with it
+// as idempotent.
+//
+// If reconnecting is enabled idempotent statements are sent again after
+// the connection was reestablished. Other statements return the error
+// that caused the reconnect, the connection can be used afterwards.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentCtxKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	tagged, _ := ctx.Value(idempotentCtxKey{}).(bool)
+	return tagged
+}
+
+// canReconnect reports whether the connection is lost and may be
+// reconnected.
+//
+// Connections are only reconnected if reconnecting is enabled and the
+// connection is idle - lost transactions and results cannot be
+// restored. Besides transactions started with BeginTx this includes
+// transactions the server reported as open, e.g. after a language
+// command "begin tran".
+func (c *Conn) canReconnect(ctx context.Context) bool {
+	return c.reconnect && c.txDepth == 0 && !c.inXact() && !c.IsValid() && ctx.Err() == nil
+}
+
+// trackTransaction records the transaction state the server reports in
+// done packages.
+func (c Conn) trackTransaction(done *tds.DonePackage) {
+	if c.health == nil {
+		return
+	}
+
+	c.health.Lock()
+	defer c.health.Unlock()
+
+	if done.Status == tds.TDS_DONE_FINAL && c.health.responseEnded {
+		// Appended by the channel after the last done package of the
+		// server.
+		c.health.responseEnded = false
+		return
+	}
+
+	c.health.inXact = done.Status&tds.TDS_DONE_INXACT == tds.TDS_DONE_INXACT
+	c.health.responseEnded = done.Status != tds.TDS_DONE_FINAL && done.Status&tds.TDS_DONE_MORE != tds.TDS_DONE_MORE
+}
+
+// drainPackage discards the remainder of a response when passed to
+// NextPackageUntil and records its transaction state.
+func (c Conn) drainPackage(pkg tds.Package) (bool, error) {
+	done, ok := pkg.(*tds.DonePackage)
+	if !ok {
+		return false, nil
+	}
+
+	c.trackTransaction(done)
+	return done.Status == tds.TDS_DONE_FINAL, nil
+}
+
+// inXact reports whether the server reported an open transaction at
+// the end of the last statement.
+func (c Conn) inXact() bool {
+	if c.health == nil {
+		return false
+	}
+
+	c.health.Lock()
+	defer c.health.Unlock()
+
+	return c.health.inXact
+}
+
+// ensureValid is called before a statement is sent. If the connection
+// is lost it is reconnected if possible, otherwise driver.ErrBadConn is
+// returned.
+func (c *Conn) ensureValid(ctx context.Context) error {
+	if c.health != nil {
+		// The previous response was read completely. If go-dblib
+		// discarded its end the appended TDS_DONE_FINAL was not seen.
+		c.health.Lock()
+		c.health.responseEnded = false
+		c.health.Unlock()
+	}
+
+	if c.IsValid() {
+		return nil
+	}
+
+	// The statement has not been sent yet, database/sql can safely
+	// retry it on another connection.
+	if !c.canReconnect(ctx) || c.reestablish(ctx) != nil {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+// retryAfterReconnect is called after a statement failed. If the
+// connection was lost it is reconnected if possible.
+//
+// It returns true if the statement should be sent again.
+func (c *Conn) retryAfterReconnect(ctx context.Context, idempotent bool) bool {
+	if !c.canReconnect(ctx) {
+		return false
+	}
+
+	return c.reestablish(ctx) == nil && idempotent
+}
+
+// reestablish replaces the lost connection to the server with a new
+// connection and restores the session state.
+func (c *Conn) reestablish(ctx context.Context) error {
+	c.health.Lock()
+	reason := c.health.err
+	c.health.Unlock()
+
+	from := c.addr
+	session := c.session.snapshot()
+
+	conn, err := newConn(ctx, c.connector)
+	if err != nil {
+		return err
+	}
+
+	c.abort()
+
+	c.Conn = conn.Conn
+	c.Channel = conn.Channel
+	c.transport = conn.transport
+	c.addr = conn.addr
+	c.health = conn.health
+	c.session = conn.session
+
+	if err := c.restoreSession(ctx, session); err != nil {
+		c.health.markBad(err)
+		return err
+	}
+
+	for _, fn := range drv.reconnectHooks {
+		fn(from, c.addr, reason)
+	}
+
+	for _, fn := range c.connector.ReconnectHooks {
+		fn(from, c.addr, reason)
+	}
+
+	return nil
+}
+
+// restoreSession replays the recorded session state and allocates
+// the prepared statements on the new connection.
+func (c *Conn) restoreSession(ctx context.Context, session *sessionState) error {
+	// Options are queued and sent with the next statement.
+	for _, option := range session.optionOrder {
+		if err := c.queueOption(ctx, session.options[option]); err != nil {
+			return err
+		}
+	}
+
+	if session.database != "" && session.database != c.CurrentDatabase() {
+		if err := c.languageExec(ctx, "use "+quoteIdentifier(session.database)); err != nil {
+			return fmt.Errorf("go-ase: error switching to database %s: %w", session.database, err)
+		}
+	}
+
+	for _, role := range session.roleOrder {
+		if err := c.languageExec(ctx, session.roles[role]); err != nil {
+			return fmt.Errorf("go-ase: error enabling role %s: %w", role, err)
+		}
+		c.session.recordRole(session.roles[role])
+	}
+
+	c.stmtLock.RLock()
+	stmts := make([]*Stmt, 0, len(c.stmts))
+	for _, stmt := range c.stmts {
+		stmts = append(stmts, stmt)
+	}
+	c.stmtLock.RUnlock()
+
+	for _, stmt := range stmts {
+		if err := stmt.allocateOnServer(ctx); err != nil {
+			return fmt.Errorf("go-ase: error allocating dynamic statement '%s': %w", stmt.pkg.Stmt, err)
+		}
+	}
+
+	return nil
+}
+
+// languageExec sends a language command and discards its results.
+func (c *Conn) languageExec(ctx context.Context, query string) error {
+	rows, _, err := c.language(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
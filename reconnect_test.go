@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// xactServer reports open transactions with TDS_DONE_INXACT like ASE.
+var xactServer = aseserver.HandlerFunc(func(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	inXact, _ := w.Session().Data.(bool)
+
+	switch req.Query {
+	case "begin tran":
+		inXact = true
+	case "commit tran", "rollback tran":
+		inXact = false
+	default:
+		if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.INT4}); err != nil {
+			return err
+		}
+		if err := w.WriteRow(int32(1)); err != nil {
+			return err
+		}
+	}
+	w.Session().Data = inXact
+
+	status := tds.TDS_DONE_COUNT
+	if inXact {
+		status |= tds.TDS_DONE_INXACT
+	}
+	return w.WriteDone(status, 1)
+})
+
+// killableDialer records the dialed connections so they can be closed
+// to simulate the loss of the connection.
+type killableDialer struct {
+	sync.Mutex
+	conns []net.Conn
+}
+
+func (d *killableDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	nc, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.conns = append(d.conns, nc)
+	return nc, nil
+}
+
+func (d *killableDialer) kill() {
+	d.Lock()
+	defer d.Unlock()
+
+	for _, nc := range d.conns {
+		nc.Close()
+	}
+	d.conns = nil
+}
+
+func TestConn_Reconnect(t *testing.T) {
+	addr := fakeServer(t, xactServer)
+
+	cases := map[string]struct {
+		statements      []string
+		beginTx         bool
+		expectReconnect bool
+	}{
+		"idle": {
+			expectReconnect: true,
+		},
+		"language transaction": {
+			statements: []string{"begin tran"},
+		},
+		"language transaction with result": {
+			statements: []string{"begin tran", "select 1"},
+		},
+		"committed language transaction": {
+			statements:      []string{"begin tran", "select 1", "commit tran"},
+			expectReconnect: true,
+		},
+		"BeginTx": {
+			beginTx: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				var reconnects int32
+				dialer := &killableDialer{}
+				connector := &ase.Connector{
+					DSN:    fakeInfo(t, addr, "reconnect", "true"),
+					Dialer: dialer.DialContext,
+					ReconnectHooks: []ase.ReconnectHook{
+						func(from, to string, reason error) {
+							atomic.AddInt32(&reconnects, 1)
+						},
+					},
+				}
+
+				db := sql.OpenDB(connector)
+				defer db.Close()
+
+				ctx := context.Background()
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				for _, statement := range cas.statements {
+					if _, err := conn.ExecContext(ctx, statement); err != nil {
+						t.Fatalf("Executing %q failed: %v", statement, err)
+					}
+				}
+
+				queryer := interface {
+					QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+				}(conn)
+				if cas.beginTx {
+					tx, err := conn.BeginTx(ctx, nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer tx.Rollback()
+					queryer = tx
+				}
+
+				dialer.kill()
+
+				var n int
+				err = queryer.QueryRowContext(ase.WithIdempotent(ctx), "select 1").Scan(&n)
+				if cas.expectReconnect && err != nil {
+					t.Errorf("Expected statement to succeed after reconnecting, received: %v", err)
+				}
+				if !cas.expectReconnect && err == nil {
+					t.Errorf("Expected statement to fail without reconnecting")
+				}
+
+				expectReconnects := int32(0)
+				if cas.expectReconnect {
+					expectReconnects = 1
+				}
+				if got := atomic.LoadInt32(&reconnects); got != expectReconnects {
+					t.Errorf("Expected %d reconnects, received %d", expectReconnects, got)
+				}
+			},
+		)
+	}
+}
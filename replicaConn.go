@@ -0,0 +1,330 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Interface satisfaction checks
+var (
+	_ driver.Conn               = (*replicaConn)(nil)
+	_ driver.ConnPrepareContext = (*replicaConn)(nil)
+	_ driver.ExecerContext      = (*replicaConn)(nil)
+	_ driver.QueryerContext     = (*replicaConn)(nil)
+	_ driver.Pinger             = (*replicaConn)(nil)
+	_ driver.ConnBeginTx        = (*replicaConn)(nil)
+	_ driver.Validator          = (*replicaConn)(nil)
+	_ driver.SessionResetter    = (*replicaConn)(nil)
+	_ driver.NamedValueChecker  = (*replicaConn)(nil)
+	_ driver.Tx                 = (*replicaTx)(nil)
+)
+
+// replicaConn is a connection of a ReplicaConnector. It holds
+// a connection to the primary and borrows connections to replicas
+// from the connector for read-only transactions and tagged queries.
+type replicaConn struct {
+	connector *ReplicaConnector
+	primary   *Conn
+
+	// inTx is set during transactions. Statements of transactions are
+	// not routed by WithReplica.
+	inTx bool
+	// txReplica and txConn are set during a read-only transaction
+	// on a replica.
+	txReplica *replica
+	txConn    *Conn
+}
+
+// conn returns the connection statements are sent to by default.
+func (c *replicaConn) conn() *Conn {
+	if c.txConn != nil {
+		return c.txConn
+	}
+	return c.primary
+}
+
+// Prepare implements the driver.Conn interface.
+func (c *replicaConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext implements the driver.ConnPrepareContext interface.
+//
+// Statements prepared with a context tagged by WithReplica are
+// prepared on a replica. The replica connection is held until the
+// statement is closed.
+func (c *replicaConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if !c.inTx && usesReplica(ctx) {
+		for {
+			r, conn, err := c.connector.acquire(ctx)
+			if errors.Is(err, ErrNoReplica) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			stmt, err := conn.PrepareContext(ctx, query)
+			if err != nil {
+				r.release(conn)
+				if retryOnReplica(ctx, conn, err) {
+					continue
+				}
+				return nil, err
+			}
+
+			aseStmt, ok := stmt.(*Stmt)
+			if !ok {
+				stmt.Close()
+				r.release(conn)
+				return nil, fmt.Errorf("go-ase: unexpected statement type %T", stmt)
+			}
+
+			return &replicaStmt{Stmt: aseStmt, release: func() { r.release(conn) }}, nil
+		}
+	}
+
+	return c.conn().PrepareContext(ctx, query)
+}
+
+// Close implements the driver.Conn interface.
+func (c *replicaConn) Close() error {
+	if c.txConn != nil {
+		// Closing the connection aborts the transaction.
+		c.txReplica.discard(c.txConn)
+		c.txReplica, c.txConn = nil, nil
+	}
+
+	return c.primary.Close()
+}
+
+// Begin implements the driver.Conn interface.
+func (c *replicaConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), DefaultTxOptions())
+}
+
+// BeginTx implements the driver.ConnBeginTx interface.
+//
+// Read-only transactions are started on a replica. ASE does not
+// support read-only transactions, hence the transaction itself is
+// a regular transaction.
+func (c *replicaConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		return c.beginPrimaryTx(ctx, opts)
+	}
+
+	opts.ReadOnly = false
+
+	r, conn, err := c.connector.acquire(ctx)
+	if err != nil {
+		if errors.Is(err, ErrNoReplica) {
+			return c.beginPrimaryTx(ctx, opts)
+		}
+		return nil, err
+	}
+
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		r.release(conn)
+		return nil, err
+	}
+
+	c.inTx = true
+	c.txReplica, c.txConn = r, conn
+	return &replicaTx{conn: c, tx: tx}, nil
+}
+
+// beginPrimaryTx starts a transaction on the primary.
+func (c *replicaConn) beginPrimaryTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.primary.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.inTx = true
+	return &replicaTx{conn: c, tx: tx}, nil
+}
+
+// endTx returns the connection of a read-only transaction.
+func (c *replicaConn) endTx() {
+	if c.txConn != nil {
+		c.txReplica.release(c.txConn)
+		c.txReplica, c.txConn = nil, nil
+	}
+	c.inTx = false
+}
+
+// ExecContext implements the driver.ExecerContext interface.
+func (c *replicaConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !c.inTx && usesReplica(ctx) {
+		for {
+			r, conn, err := c.connector.acquire(ctx)
+			if errors.Is(err, ErrNoReplica) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			result, err := conn.ExecContext(ctx, query, args)
+			r.release(conn)
+			if retryOnReplica(ctx, conn, err) {
+				continue
+			}
+			return result, err
+		}
+	}
+
+	return c.conn().ExecContext(ctx, query, args)
+}
+
+// QueryContext implements the driver.QueryerContext interface.
+func (c *replicaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !c.inTx && usesReplica(ctx) {
+		for {
+			r, conn, err := c.connector.acquire(ctx)
+			if errors.Is(err, ErrNoReplica) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			rows, err := conn.QueryContext(ctx, query, args)
+			if err != nil {
+				r.release(conn)
+				if retryOnReplica(ctx, conn, err) {
+					continue
+				}
+				return nil, err
+			}
+
+			aseRows, ok := rows.(*Rows)
+			if !ok {
+				rows.Close()
+				r.release(conn)
+				return nil, fmt.Errorf("go-ase: unexpected rows type %T", rows)
+			}
+
+			return &replicaRows{Rows: aseRows, release: func() { r.release(conn) }}, nil
+		}
+	}
+
+	return c.conn().QueryContext(ctx, query, args)
+}
+
+// retryOnReplica reports whether a query that failed on a replica
+// should be retried.
+//
+// Queries routed to replicas are read-only, hence they are retried on
+// the next replica or the primary if the connection to the replica was
+// lost.
+func retryOnReplica(ctx context.Context, conn *Conn, err error) bool {
+	return err != nil && !conn.IsValid() && ctx.Err() == nil
+}
+
+// CheckNamedValue implements the driver.NamedValueChecker interface.
+func (c *replicaConn) CheckNamedValue(named *driver.NamedValue) error {
+	return c.primary.CheckNamedValue(named)
+}
+
+// Ping implements the driver.Pinger interface.
+func (c *replicaConn) Ping(ctx context.Context) error {
+	return c.primary.Ping(ctx)
+}
+
+// IsValid implements the driver.Validator interface.
+func (c *replicaConn) IsValid() bool {
+	return c.primary.IsValid()
+}
+
+// ResetSession implements the driver.SessionResetter interface.
+func (c *replicaConn) ResetSession(ctx context.Context) error {
+	return c.primary.ResetSession(ctx)
+}
+
+// replicaTx is a transaction on the primary or a read-only
+// transaction on a replica.
+type replicaTx struct {
+	conn *replicaConn
+	tx   driver.Tx
+}
+
+// Commit implements the driver.Tx interface.
+func (tx *replicaTx) Commit() error {
+	defer tx.conn.endTx()
+	return tx.tx.Commit()
+}
+
+// Rollback implements the driver.Tx interface.
+func (tx *replicaTx) Rollback() error {
+	defer tx.conn.endTx()
+	return tx.tx.Rollback()
+}
+
+// replicaRows returns the replica connection after the rows have been
+// closed.
+type replicaRows struct {
+	*Rows
+	release   func()
+	closeOnce sync.Once
+}
+
+// Close implements the driver.Rows interface.
+func (rows *replicaRows) Close() error {
+	err := rows.Rows.Close()
+	rows.closeOnce.Do(rows.release)
+	return err
+}
+
+// replicaStmt returns the replica connection after the statement has
+// been closed.
+type replicaStmt struct {
+	*Stmt
+	release   func()
+	closeOnce sync.Once
+}
+
+// Close implements the driver.Stmt interface.
+func (stmt *replicaStmt) Close() error {
+	err := stmt.Stmt.Close()
+	stmt.closeOnce.Do(stmt.release)
+	return err
+}
+
+// CurrentDatabase implements the Session interface.
+func (c *replicaConn) CurrentDatabase() string {
+	return c.conn().CurrentDatabase()
+}
+
+// Charset implements the Session interface.
+func (c *replicaConn) Charset() string {
+	return c.conn().Charset()
+}
+
+// Language implements the Session interface.
+func (c *replicaConn) Language() string {
+	return c.conn().Language()
+}
+
+// PacketSize implements the Session interface.
+func (c *replicaConn) PacketSize() int {
+	return c.conn().PacketSize()
+}
+
+// SPID implements the Session interface.
+func (c *replicaConn) SPID(ctx context.Context) (int, error) {
+	return c.conn().SPID(ctx)
+}
+
+// ServerInfo implements the Session interface.
+func (c *replicaConn) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	return c.conn().ServerInfo(ctx)
+}
@@ -0,0 +1,386 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SAP/go-dblib/dsn"
+)
+
+// Interface satisfaction checks
+var (
+	_ driver.Connector = (*ReplicaConnector)(nil)
+)
+
+// ReplicaSelection defines how a replica is chosen.
+type ReplicaSelection int
+
+const (
+	// RoundRobin chooses the replicas in turn.
+	RoundRobin ReplicaSelection = iota
+	// LeastLoaded chooses the replica with the fewest connections in
+	// use.
+	LeastLoaded
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultMaxIdleReplicaConns = 2
+
+	// minHealthCheckTimeout is the minimum time a health check may take
+	// to connect to and ping a replica.
+	minHealthCheckTimeout = 5 * time.Second
+)
+
+// ErrNoReplica is returned when no healthy replica is available.
+var ErrNoReplica = errors.New("go-ase: no healthy replica available")
+
+type replicaCtxKey struct{}
+
+// WithReplica returns a context tagging queries executed with it to be
+// routed to a replica by connections of a ReplicaConnector.
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaCtxKey{}, true)
+}
+
+func usesReplica(ctx context.Context) bool {
+	tagged, _ := ctx.Value(replicaCtxKey{}).(bool)
+	return tagged
+}
+
+// ReplicaConnector implements the driver.Connector interface for
+// a primary server with read-only replicas.
+//
+// Read-only transactions and queries tagged with WithReplica are
+// routed to a replica, everything else is sent to the primary. If no
+// replica is healthy the primary is used instead.
+//
+// Replicas that cannot be connected to or fail a health check are
+// ejected until a later health check succeeds.
+type ReplicaConnector struct {
+	Primary  *Connector
+	Replicas []*Connector
+
+	// Selection defines how replicas are chosen. Defaults to
+	// RoundRobin.
+	Selection ReplicaSelection
+
+	// HealthCheckInterval is the interval in which replicas are
+	// pinged. Ejected replicas are only used again after a health
+	// check succeeded, hence negative values are rejected by Connect.
+	// Defaults to 30 seconds.
+	HealthCheckInterval time.Duration
+
+	// MaxIdleReplicaConns is the number of idle connections kept per
+	// replica. Defaults to 2.
+	MaxIdleReplicaConns int
+
+	initOnce sync.Once
+	initErr  error
+	mu       sync.Mutex
+	replicas []*replica
+	next     int
+	closed   bool
+	stop     chan struct{}
+}
+
+// NewReplicaConnector returns a new connector routing read-only
+// transactions and tagged queries to replicas.
+//
+// Only a test connection to the primary is opened, replicas which
+// cannot be reached are ejected when they are first used.
+func NewReplicaConnector(primary *dsn.Info, replicas ...*dsn.Info) (*ReplicaConnector, error) {
+	connector := &ReplicaConnector{
+		Primary: &Connector{DSN: primary},
+	}
+
+	for _, info := range replicas {
+		connector.Replicas = append(connector.Replicas, &Connector{DSN: info})
+	}
+
+	conn, err := connector.Primary.Connect(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error opening test connection: %w", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		return nil, fmt.Errorf("error closing test connection: %w", err)
+	}
+
+	return connector, nil
+}
+
+// Driver implements the driver.Connector interface.
+func (c *ReplicaConnector) Driver() driver.Driver {
+	return drv
+}
+
+// Connect implements the driver.Connector interface.
+func (c *ReplicaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.initOnce.Do(c.init)
+	if c.initErr != nil {
+		return nil, c.initErr
+	}
+
+	primary, err := newConn(ctx, c.Primary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replicaConn{connector: c, primary: primary}, nil
+}
+
+// Close stops the health checks and closes idle replica connections.
+func (c *ReplicaConnector) Close() error {
+	c.initOnce.Do(c.init)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.stop)
+	c.mu.Unlock()
+
+	for _, r := range c.replicas {
+		r.closeIdle()
+	}
+
+	return nil
+}
+
+func (c *ReplicaConnector) init() {
+	c.stop = make(chan struct{})
+
+	maxIdle := c.MaxIdleReplicaConns
+	if maxIdle == 0 {
+		maxIdle = defaultMaxIdleReplicaConns
+	}
+
+	for _, connector := range c.Replicas {
+		c.replicas = append(c.replicas, &replica{
+			connector: connector,
+			healthy:   true,
+			maxIdle:   maxIdle,
+		})
+	}
+
+	interval := c.HealthCheckInterval
+	if interval < 0 {
+		c.initErr = fmt.Errorf("go-ase: HealthCheckInterval must not be negative, received %s", interval)
+		return
+	}
+	if interval == 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	if len(c.replicas) > 0 {
+		go c.healthCheck(interval)
+	}
+}
+
+// acquire returns a connection to a healthy replica.
+func (c *ReplicaConnector) acquire(ctx context.Context) (*replica, *Conn, error) {
+	for _, r := range c.candidates() {
+		conn, err := r.get(ctx)
+		if err == nil {
+			return r, conn, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+
+		r.eject()
+	}
+
+	return nil, nil, ErrNoReplica
+}
+
+// candidates returns the healthy replicas in the order they should be
+// tried.
+func (c *ReplicaConnector) candidates() []*replica {
+	c.mu.Lock()
+	start := c.next
+	c.next++
+	c.mu.Unlock()
+
+	candidates := []*replica{}
+	for i := range c.replicas {
+		r := c.replicas[(start+i)%len(c.replicas)]
+		if r.isHealthy() {
+			candidates = append(candidates, r)
+		}
+	}
+
+	if c.Selection == LeastLoaded {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].load() < candidates[j].load()
+		})
+	}
+
+	return candidates
+}
+
+// healthCheck pings all replicas in the passed interval until the
+// connector is closed.
+//
+// Each check may take as long as the interval but at least
+// minHealthCheckTimeout, otherwise short intervals would eject healthy
+// replicas which take longer to log in.
+func (c *ReplicaConnector) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	timeout := interval
+	if timeout < minHealthCheckTimeout {
+		timeout = minHealthCheckTimeout
+	}
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range c.replicas {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			r.check(ctx)
+			cancel()
+		}
+	}
+}
+
+// replica manages the connections to a replica.
+type replica struct {
+	connector *Connector
+	maxIdle   int
+
+	mu      sync.Mutex
+	healthy bool
+	inUse   int
+	idle    []*Conn
+}
+
+func (r *replica) isHealthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.healthy
+}
+
+func (r *replica) load() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.inUse
+}
+
+// get returns an idle connection or opens a new connection.
+func (r *replica) get(ctx context.Context) (*Conn, error) {
+	r.mu.Lock()
+	r.inUse++
+	for len(r.idle) > 0 {
+		conn := r.idle[len(r.idle)-1]
+		r.idle = r.idle[:len(r.idle)-1]
+
+		if conn.IsValid() {
+			r.mu.Unlock()
+			return conn, nil
+		}
+
+		go conn.Close()
+	}
+	r.mu.Unlock()
+
+	conn, err := newConn(ctx, r.connector)
+	if err != nil {
+		r.mu.Lock()
+		r.inUse--
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// release returns a connection acquired with get.
+//
+// The replica is ejected if the connection was lost.
+func (r *replica) release(conn *Conn) {
+	if !conn.IsValid() {
+		r.eject()
+	}
+
+	r.mu.Lock()
+	r.inUse--
+	if conn.IsValid() && r.healthy && len(r.idle) < r.maxIdle {
+		r.idle = append(r.idle, conn)
+		conn = nil
+	}
+	r.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// discard closes a connection acquired with get.
+func (r *replica) discard(conn *Conn) {
+	r.mu.Lock()
+	r.inUse--
+	r.mu.Unlock()
+
+	conn.Close()
+}
+
+// eject marks the replica as unhealthy and closes all idle
+// connections.
+func (r *replica) eject() {
+	r.mu.Lock()
+	r.healthy = false
+	r.mu.Unlock()
+
+	r.closeIdle()
+}
+
+func (r *replica) closeIdle() {
+	r.mu.Lock()
+	idle := r.idle
+	r.idle = nil
+	r.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
+
+// check pings the replica and updates its health.
+func (r *replica) check(ctx context.Context) {
+	conn, err := r.get(ctx)
+	if err != nil {
+		r.eject()
+		return
+	}
+
+	if err := conn.Ping(ctx); err != nil {
+		conn.health.markBad(err)
+		r.release(conn)
+		return
+	}
+
+	r.mu.Lock()
+	r.healthy = true
+	r.mu.Unlock()
+
+	r.release(conn)
+}
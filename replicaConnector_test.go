@@ -0,0 +1,379 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+)
+
+// replicaServer responds to selects with its id and counts the
+// received statements. While it is down dialing it fails.
+type replicaServer struct {
+	sync.Mutex
+	id         int32
+	statements int
+
+	down int32
+	l    *pipeListener
+	srv  *aseserver.Server
+}
+
+func newReplicaServer(t *testing.T, id int32) *replicaServer {
+	rs := &replicaServer{id: id, l: newPipeListener()}
+	rs.srv = &aseserver.Server{Handler: rs, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go rs.srv.Serve(rs.l)
+	t.Cleanup(func() { rs.srv.Close() })
+	return rs
+}
+
+func (rs *replicaServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	if !strings.HasPrefix(req.Query, "select") {
+		rs.Lock()
+		rs.statements++
+		rs.Unlock()
+		return nil
+	}
+	return rs.respond(w)
+}
+
+func (rs *replicaServer) PrepareDynamic(ctx context.Context, session *aseserver.Session, query string) ([]aseserver.Column, error) {
+	return nil, nil
+}
+
+func (rs *replicaServer) HandleDynamic(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.DynamicRequest) error {
+	return rs.respond(w)
+}
+
+func (rs *replicaServer) respond(w *aseserver.ResponseWriter) error {
+	rs.Lock()
+	rs.statements++
+	rs.Unlock()
+
+	if err := w.WriteRowFmt(aseserver.Column{Name: "id", DataType: asetypes.INT4}); err != nil {
+		return err
+	}
+	return w.WriteRow(rs.id)
+}
+
+func (rs *replicaServer) count() int {
+	rs.Lock()
+	defer rs.Unlock()
+	return rs.statements
+}
+
+func (rs *replicaServer) setDown(down bool) {
+	var value int32
+	if down {
+		value = 1
+	}
+	atomic.StoreInt32(&rs.down, value)
+}
+
+func (rs *replicaServer) connector(t *testing.T) *ase.Connector {
+	return &ase.Connector{
+		DSN: fakeInfo(t, "db.invalid:4901"),
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if atomic.LoadInt32(&rs.down) == 1 {
+				return nil, errors.New("server down")
+			}
+			return rs.l.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// replicaDB returns a database connected to the primary and the
+// replicas through a ReplicaConnector.
+func replicaDB(t *testing.T, connector *ase.ReplicaConnector, primary *replicaServer, replicas ...*replicaServer) *sql.DB {
+	connector.Primary = primary.connector(t)
+	for _, rs := range replicas {
+		connector.Replicas = append(connector.Replicas, rs.connector(t))
+	}
+
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() {
+		db.Close()
+		connector.Close()
+	})
+	return db
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryID returns the id of the server the query was executed on.
+func queryID(t *testing.T, ctx context.Context, q queryer) int32 {
+	var id int32
+	if err := q.QueryRowContext(ctx, "select id").Scan(&id); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	return id
+}
+
+func TestReplicaConnector_Selection(t *testing.T) {
+	cases := map[string]struct {
+		selection ase.ReplicaSelection
+		// hold keeps the rows of a first query open, occupying
+		// a connection to the first replica.
+		hold   bool
+		expect []int32
+	}{
+		"round robin": {
+			selection: ase.RoundRobin,
+			expect:    []int32{1, 2, 1, 2},
+		},
+		"round robin ignores load": {
+			selection: ase.RoundRobin,
+			hold:      true,
+			expect:    []int32{2, 1, 2},
+		},
+		"least loaded": {
+			selection: ase.LeastLoaded,
+			hold:      true,
+			expect:    []int32{2, 2, 2},
+		},
+		"least loaded without load": {
+			selection: ase.LeastLoaded,
+			expect:    []int32{1, 2, 1, 2},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				connector := &ase.ReplicaConnector{Selection: cas.selection}
+				db := replicaDB(t, connector, newReplicaServer(t, 0),
+					newReplicaServer(t, 1), newReplicaServer(t, 2))
+				ctx := ase.WithReplica(context.Background())
+
+				if cas.hold {
+					rows, err := db.QueryContext(ctx, "select id")
+					if err != nil {
+						t.Fatalf("Query failed: %v", err)
+					}
+					defer rows.Close()
+				}
+
+				ids := []int32{}
+				for range cas.expect {
+					ids = append(ids, queryID(t, ctx, db))
+				}
+
+				if !equalIDs(ids, cas.expect) {
+					t.Errorf("Expected queries on %v, received %v", cas.expect, ids)
+				}
+			},
+		)
+	}
+}
+
+func equalIDs(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplicaConnector_Routing(t *testing.T) {
+	cases := map[string]struct {
+		run           func(ctx context.Context, db *sql.DB) error
+		expectReplica bool
+	}{
+		"query": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				_, err := db.QueryContext(ctx, "select id")
+				return err
+			},
+		},
+		"tagged query": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				rows, err := db.QueryContext(ase.WithReplica(ctx), "select id")
+				if err != nil {
+					return err
+				}
+				return rows.Close()
+			},
+			expectReplica: true,
+		},
+		"tagged exec": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				_, err := db.ExecContext(ase.WithReplica(ctx), "select id")
+				return err
+			},
+			expectReplica: true,
+		},
+		"tagged prepared statement": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				stmt, err := db.PrepareContext(ase.WithReplica(ctx), "select id")
+				if err != nil {
+					return err
+				}
+				defer stmt.Close()
+
+				var id int32
+				return stmt.QueryRowContext(ctx).Scan(&id)
+			},
+			expectReplica: true,
+		},
+		"prepared statement": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				stmt, err := db.PrepareContext(ctx, "select id")
+				if err != nil {
+					return err
+				}
+				defer stmt.Close()
+
+				var id int32
+				return stmt.QueryRowContext(ctx).Scan(&id)
+			},
+		},
+		"read-only transaction": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				var id int32
+				if err := tx.QueryRowContext(ctx, "select id").Scan(&id); err != nil {
+					return err
+				}
+				return tx.Commit()
+			},
+			expectReplica: true,
+		},
+		"transaction": {
+			run: func(ctx context.Context, db *sql.DB) error {
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				// Tagged queries within a transaction on the primary
+				// stay on the primary.
+				var id int32
+				if err := tx.QueryRowContext(ase.WithReplica(ctx), "select id").Scan(&id); err != nil {
+					return err
+				}
+				return tx.Commit()
+			},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				primary, replica := newReplicaServer(t, 0), newReplicaServer(t, 1)
+				db := replicaDB(t, &ase.ReplicaConnector{}, primary, replica)
+				ctx := context.Background()
+
+				// Open the connection to the primary beforehand.
+				if err := db.PingContext(ctx); err != nil {
+					t.Fatalf("Ping failed: %v", err)
+				}
+
+				pinged := primary.count()
+
+				if err := cas.run(ctx, db); err != nil {
+					t.Fatalf("Statement failed: %v", err)
+				}
+
+				onPrimary, onReplica := primary.count()-pinged, replica.count()
+				if cas.expectReplica && (onReplica == 0 || onPrimary != 0) {
+					t.Errorf("Expected statements on the replica, received %d on the primary and %d on the replica",
+						onPrimary, onReplica)
+				}
+				if !cas.expectReplica && (onPrimary == 0 || onReplica != 0) {
+					t.Errorf("Expected statements on the primary, received %d on the primary and %d on the replica",
+						onPrimary, onReplica)
+				}
+			},
+		)
+	}
+}
+
+func TestReplicaConnector_Eject(t *testing.T) {
+	primary, first, second := newReplicaServer(t, 0), newReplicaServer(t, 1), newReplicaServer(t, 2)
+	db := replicaDB(t, &ase.ReplicaConnector{HealthCheckInterval: 20 * time.Millisecond}, primary, first, second)
+	ctx := ase.WithReplica(context.Background())
+
+	// A replica that cannot be connected to is ejected.
+	first.setDown(true)
+	for i := 0; i < 4; i++ {
+		if id := queryID(t, ctx, db); id != 2 {
+			t.Fatalf("Query %d: expected query on replica 2, received %d", i, id)
+		}
+	}
+
+	// Connections lost during a query eject the replica and the query
+	// is retried on the primary.
+	second.setDown(true)
+	second.srv.Close()
+	for i := 0; i < 2; i++ {
+		if id := queryID(t, ctx, db); id != 0 {
+			t.Fatalf("Query %d: expected query on the primary, received %d", i, id)
+		}
+	}
+
+	// The health check returns replicas once they can be connected to.
+	first.setDown(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for queryID(t, ctx, db) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Replica was not returned by the health check")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicaConnector_HealthCheckInterval(t *testing.T) {
+	cases := map[string]struct {
+		interval  time.Duration
+		expectErr bool
+	}{
+		"default": {},
+		"interval": {
+			interval: time.Second,
+		},
+		"negative": {
+			interval:  -time.Second,
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				connector := &ase.ReplicaConnector{HealthCheckInterval: cas.interval}
+				db := replicaDB(t, connector, newReplicaServer(t, 0), newReplicaServer(t, 1))
+
+				if err := db.Ping(); cas.expectErr != (err != nil) {
+					t.Errorf("Expected error %t, received %v", cas.expectErr, err)
+				}
+			},
+		)
+	}
+}
@@ -15,11 +15,29 @@ var _ driver.Result = (*Result)(nil)
 // Result implements the driver.Result interface.
 type Result struct {
 	rowsAffected int64
+	status       *procStatus
+
+	lastInsertID    int64
+	hasLastInsertID bool
+	lastInsertIDErr error
 }
 
+// errNoIdentityColumn is returned by LastInsertId after an insert into a
+// table without IDENTITY column.
+var errNoIdentityColumn = errors.New("go-ase: no identity inserted, the table has no IDENTITY column")
+
 // LastInsertId implements the driver.Result interface.
+//
+// The identity of inserted rows is only received for insert statements
+// if the last-insert-id property is set.
 func (result Result) LastInsertId() (int64, error) {
-	return -1, errors.New("not supported")
+	if !result.hasLastInsertID {
+		return -1, errors.New("go-ase: no identity received, LastInsertId requires an insert statement and the last-insert-id property")
+	}
+	if result.lastInsertIDErr != nil {
+		return -1, result.lastInsertIDErr
+	}
+	return result.lastInsertID, nil
 }
 
 // RowsAffected implements the driver.Result interface.
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type returnStatusCtxKey struct{}
+
+// WithReturnStatus returns a context tagging statements executed with
+// it to store the return status of stored procedures in status.
+//
+// status is reset when the statement is executed. If the statement
+// returns rows the status is stored once the rows are consumed.
+//
+// This allows reading return statuses through database/sql, which
+// does not expose the results of the driver:
+//
+//	var status sql.NullInt32
+//	_, err := db.ExecContext(ase.WithReturnStatus(ctx, &status), "exec my_proc")
+func WithReturnStatus(ctx context.Context, status *sql.NullInt32) context.Context {
+	return context.WithValue(ctx, returnStatusCtxKey{}, status)
+}
+
+// ReturnStatus returns the return status of the stored procedure
+// executed by the statement v is the result or rows of. The boolean is
+// false if no return status was received.
+//
+// v must be a Result or Rows of go-ase, e.g. as returned by
+// GenericExec. The rows must be consumed before their status is
+// available.
+func ReturnStatus(v interface{}) (int32, bool) {
+	var status *procStatus
+	switch typed := v.(type) {
+	case Result:
+		status = typed.status
+	case *Result:
+		status = typed.status
+	case interface{ procStatus() *procStatus }:
+		status = typed.procStatus()
+	}
+
+	if status == nil {
+		return 0, false
+	}
+	return status.value, status.valid
+}
+
+// procStatus records the return status of a stored procedure.
+type procStatus struct {
+	value int32
+	valid bool
+	// dst receives the status if the statement was executed with
+	// a context returned by WithReturnStatus.
+	dst *sql.NullInt32
+}
+
+// newProcStatus returns a procStatus storing the status in the
+// destination passed to WithReturnStatus if ctx is tagged with it.
+func newProcStatus(ctx context.Context) *procStatus {
+	dst, _ := ctx.Value(returnStatusCtxKey{}).(*sql.NullInt32)
+	if dst != nil {
+		*dst = sql.NullInt32{}
+	}
+	return &procStatus{dst: dst}
+}
+
+// set records a received return status.
+func (status *procStatus) set(value int32) {
+	if status == nil {
+		return
+	}
+
+	status.value, status.valid = value, true
+	if status.dst != nil {
+		*status.dst = sql.NullInt32{Int32: value, Valid: true}
+	}
+}
+
+// checkReturnStatus returns an error for a non-zero return status if
+// the strict-return-status property is set.
+func (c Conn) checkReturnStatus(value int32) error {
+	if c.strictReturnStatus && value != 0 {
+		return fmt.Errorf("go-ase: query failed with return status %d", value)
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// writeProc writes the result sets of a stored procedure followed by
+// its return status.
+func writeProc(w *aseserver.ResponseWriter, status int32, sets ...[]int32) error {
+	for _, set := range sets {
+		if err := writeSelect(w, tds.TDS_DONE_PROC, set...); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteReturnStatus(status); err != nil {
+		return err
+	}
+	return w.WriteDone(tds.TDS_DONE_PROC, 0)
+}
+
+// statusServer executes stored procedures returning statuses with and
+// without result sets.
+var statusServer = multiServer{
+	"exec failing": func(w *aseserver.ResponseWriter) error {
+		return writeProc(w, 5)
+	},
+	"exec succeeding": func(w *aseserver.ResponseWriter) error {
+		return writeProc(w, 0)
+	},
+	"exec no_status": func(w *aseserver.ResponseWriter) error {
+		return w.WriteDone(tds.TDS_DONE_COUNT, 1)
+	},
+	"exec failing_rows": func(w *aseserver.ResponseWriter) error {
+		return writeProc(w, 5, []int32{1, 2})
+	},
+	"exec succeeding_rows": func(w *aseserver.ResponseWriter) error {
+		return writeProc(w, 0, []int32{1, 2})
+	},
+	"exec failing_sets": func(w *aseserver.ResponseWriter) error {
+		return writeProc(w, 5, []int32{1}, []int32{2, 3})
+	},
+	"exec failing; select value": func(w *aseserver.ResponseWriter) error {
+		if err := writeProc(w, 5, []int32{1}); err != nil {
+			return err
+		}
+		return writeSelect(w, 0, 2)
+	},
+}
+
+func TestReturnStatus_Exec(t *testing.T) {
+	cases := map[string]struct {
+		query        string
+		strict       bool
+		props        []string
+		expectStatus sql.NullInt32
+		expectErr    bool
+	}{
+		"non-zero status": {
+			query:        "exec failing",
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+		},
+		"non-zero status strict": {
+			query:        "exec failing",
+			strict:       true,
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+		"zero status": {
+			query:        "exec succeeding",
+			expectStatus: sql.NullInt32{Int32: 0, Valid: true},
+		},
+		"zero status strict": {
+			query:        "exec succeeding",
+			strict:       true,
+			expectStatus: sql.NullInt32{Int32: 0, Valid: true},
+		},
+		"without status": {
+			query: "exec no_status",
+		},
+		"without status strict": {
+			query:  "exec no_status",
+			strict: true,
+		},
+		"non-zero status with result set": {
+			query:        "exec failing_rows",
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+		},
+		"non-zero status with result set strict": {
+			query:        "exec failing_rows",
+			strict:       true,
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+		"non-zero status with result set and attention strict": {
+			query:        "exec failing_rows",
+			strict:       true,
+			props:        []string{"close-attention-rows", "10"},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				props := append([]string{"strict-return-status", strconv.FormatBool(cas.strict)}, cas.props...)
+				db := fakeDB(t, statusServer, props...)
+
+				// The status of a previous statement is reset.
+				status := sql.NullInt32{Int32: 9, Valid: true}
+				ctx := ase.WithReturnStatus(context.Background(), &status)
+
+				_, err := db.ExecContext(ctx, cas.query)
+				if cas.expectErr != (err != nil) {
+					t.Errorf("Expected error %t, received %v", cas.expectErr, err)
+				}
+
+				if status != cas.expectStatus {
+					t.Errorf("Expected status %v, received %v", cas.expectStatus, status)
+				}
+
+				if err := db.Ping(); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
+
+func TestReturnStatus_Rows(t *testing.T) {
+	cases := map[string]struct {
+		query        string
+		strict       bool
+		expectValues [][]int32
+		expectStatus sql.NullInt32
+		expectErr    bool
+	}{
+		"result set": {
+			query:        "exec failing_rows",
+			expectValues: [][]int32{{1, 2}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+		},
+		"result set strict": {
+			query:        "exec failing_rows",
+			strict:       true,
+			expectValues: [][]int32{{1, 2}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+		"zero status strict": {
+			query:        "exec succeeding_rows",
+			strict:       true,
+			expectValues: [][]int32{{1, 2}},
+			expectStatus: sql.NullInt32{Int32: 0, Valid: true},
+		},
+		"result sets": {
+			query:        "exec failing_sets",
+			expectValues: [][]int32{{1}, {2, 3}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+		},
+		"result sets strict": {
+			query:        "exec failing_sets",
+			strict:       true,
+			expectValues: [][]int32{{1}, {2, 3}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+		"result set after status": {
+			query:        "exec failing; select value",
+			expectValues: [][]int32{{1}, {2}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+		},
+		"result set after status strict": {
+			query:        "exec failing; select value",
+			strict:       true,
+			expectValues: [][]int32{{1}},
+			expectStatus: sql.NullInt32{Int32: 5, Valid: true},
+			expectErr:    true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, statusServer, "strict-return-status", strconv.FormatBool(cas.strict))
+
+				var status sql.NullInt32
+				ctx := ase.WithReturnStatus(context.Background(), &status)
+
+				rows, err := db.QueryContext(ctx, cas.query)
+				if err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+				defer rows.Close()
+
+				values := [][]int32{}
+				for {
+					set := []int32{}
+					for rows.Next() {
+						var value int32
+						if err := rows.Scan(&value); err != nil {
+							t.Fatalf("Scan failed: %v", err)
+						}
+						set = append(set, value)
+					}
+					values = append(values, set)
+
+					if !rows.NextResultSet() {
+						break
+					}
+				}
+
+				if err := rows.Err(); cas.expectErr != (err != nil) {
+					t.Errorf("Expected error %t, received %v", cas.expectErr, err)
+				}
+
+				if !equalSets(values, cas.expectValues) {
+					t.Errorf("Expected values %v, received %v", cas.expectValues, values)
+				}
+
+				if status != cas.expectStatus {
+					t.Errorf("Expected status %v, received %v", cas.expectStatus, status)
+				}
+
+				if err := rows.Close(); err != nil {
+					t.Errorf("Closing rows failed: %v", err)
+				}
+
+				if err := db.Ping(); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
+
+func equalSets(a, b [][]int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestReturnStatus_GenericExec(t *testing.T) {
+	cases := map[string]struct {
+		query  string
+		rows   bool
+		expect int32
+		ok     bool
+	}{
+		"result": {
+			query:  "exec failing",
+			expect: 5,
+			ok:     true,
+		},
+		"result without status": {
+			query: "exec no_status",
+		},
+		"rows": {
+			query:  "exec failing_rows",
+			rows:   true,
+			expect: 5,
+			ok:     true,
+		},
+		"rows of multiple result sets": {
+			query:  "exec failing_sets",
+			rows:   true,
+			expect: 5,
+			ok:     true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, statusServer)
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				err = conn.Raw(func(driverConn interface{}) error {
+					rows, result, err := driverConn.(*ase.Conn).GenericExec(ctx, cas.query, nil)
+					if err != nil {
+						return err
+					}
+					defer rows.Close()
+
+					if !cas.rows {
+						status, ok := ase.ReturnStatus(result)
+						if status != cas.expect || ok != cas.ok {
+							t.Errorf("Expected status %d (%t) of the result, received %d (%t)", cas.expect, cas.ok, status, ok)
+						}
+						return nil
+					}
+
+					// The status is received after the rows.
+					if status, ok := ase.ReturnStatus(rows); ok {
+						t.Errorf("Expected no status before the rows are consumed, received %d", status)
+					}
+
+					aseRows := rows.(*ase.Rows)
+					values := make([]driver.Value, 1)
+					for {
+						for {
+							if err := rows.Next(values); err == io.EOF {
+								break
+							} else if err != nil {
+								return err
+							}
+						}
+
+						if !aseRows.HasNextResultSet() {
+							break
+						}
+						if err := aseRows.NextResultSet(); err != nil {
+							return err
+						}
+					}
+
+					status, ok := ase.ReturnStatus(rows)
+					if status != cas.expect || ok != cas.ok {
+						t.Errorf("Expected status %d (%t) of the rows, received %d (%t)", cas.expect, cas.ok, status, ok)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("GenericExec failed: %v", err)
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
+
+func TestReturnStatus_Values(t *testing.T) {
+	cases := map[string]struct {
+		value interface{}
+	}{
+		"nil":                 {value: nil},
+		"integer":             {value: 1},
+		"string":              {value: "5"},
+		"zero result":         {value: ase.Result{}},
+		"zero result pointer": {value: &ase.Result{}},
+		"zero rows":           {value: &ase.Rows{}},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if status, ok := ase.ReturnStatus(cas.value); ok {
+					t.Errorf("Expected no status, received %d", status)
+				}
+			},
+		)
+	}
+}
+
+func TestReturnStatus_ExecMulti(t *testing.T) {
+	cases := map[string]struct {
+		strict    bool
+		expectErr bool
+	}{
+		"default":              {},
+		"strict-return-status": {strict: true, expectErr: true},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				db := fakeDB(t, statusServer, "strict-return-status", strconv.FormatBool(cas.strict))
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				var results []ase.StatementResult
+				err = conn.Raw(func(driverConn interface{}) error {
+					results, err = driverConn.(*ase.Conn).ExecMulti(ctx, "exec failing; select value")
+					return err
+				})
+				if cas.expectErr != (err != nil) {
+					t.Errorf("Expected error %t, received %v", cas.expectErr, err)
+				}
+
+				if len(results) != 2 {
+					t.Fatalf("Expected 2 results, received %d: %v", len(results), results)
+				}
+
+				if !results[0].HasReturnStatus || results[0].ReturnStatus != 5 {
+					t.Errorf("Expected return status 5 of the procedure, received %d (%t)",
+						results[0].ReturnStatus, results[0].HasReturnStatus)
+				}
+				if cas.strict != (results[0].Err != nil) {
+					t.Errorf("Expected error %t of the procedure, received %v", cas.strict, results[0].Err)
+				}
+
+				if results[1].HasReturnStatus || results[1].Err != nil {
+					t.Errorf("Expected no status and error of the select, received %d (%t): %v",
+						results[1].ReturnStatus, results[1].HasReturnStatus, results[1].Err)
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
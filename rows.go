@@ -10,7 +10,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/SAP/go-dblib/asetypes"
 	"github.com/SAP/go-dblib/tds"
 )
 
@@ -28,6 +30,29 @@ type Rows struct {
 	RowFmt *tds.RowFmtPackage
 
 	hasNextResultSet bool
+	// complete is true once the response was read completely.
+	complete bool
+
+	// orderBy are the indices of the columns the current result set
+	// is ordered by.
+	orderBy []int
+
+	// status records the return status of a stored procedure.
+	status *procStatus
+
+	// decodersFmt is the row format the result codecs in
+	// decodersCache were looked up for.
+	decodersFmt   *tds.RowFmtPackage
+	decodersCache []func(interface{}) (interface{}, error)
+
+	// stmt is deallocated once the response was read completely.
+	stmt *Stmt
+
+	// computeFn receives the compute rows if the query was executed
+	// with a context returned by WithComputeRows. computeFmts are the
+	// formats of the compute clauses of the query by their ID.
+	computeFn   func(ComputeRow)
+	computeFmts map[uint16]*computeFmt
 }
 
 // Columns implements the driver.Rows interface.
@@ -43,13 +68,55 @@ func (rows Rows) Columns() []string {
 		// TODO check if RowFmt is wide and contains column label,
 		// catalogue, schema, table
 		response[i] = fieldFmt.Name()
+		if name, err := rows.Conn.decodeString(response[i]); err == nil {
+			response[i] = name
+		}
 	}
 
 	return response
 }
 
 // Close implements the driver.Rows interface.
+//
+// The remainder of the response is read and discarded. If the
+// close-attention-rows property is set and more rows remain the
+// response is cancelled with an attention instead.
 func (rows *Rows) Close() error {
+	// Errors of the response, e.g. a non-zero return status with the
+	// strict-return-status property set, do not prevent deallocating
+	// the statement.
+	err := rows.consume()
+
+	if rows.stmt == nil {
+		return err
+	}
+
+	stmt := rows.stmt
+	rows.stmt = nil
+	if !rows.Conn.IsValid() {
+		return err
+	}
+
+	if closeErr := stmt.close(context.Background()); closeErr != nil {
+		rows.Conn.checkConnErr(closeErr)
+		if err == nil {
+			err = fmt.Errorf("go-ase: error deallocating dynamic SQL: %w", closeErr)
+		}
+	}
+
+	return err
+}
+
+// consume reads the remainder of the response.
+func (rows *Rows) consume() error {
+	if rows.complete {
+		return nil
+	}
+
+	if rows.Conn.closeAttentionRows >= 0 {
+		return rows.closeWithAttention(rows.Conn.closeAttentionRows)
+	}
+
 	for {
 		if err := rows.NextResultSet(); err != nil {
 			if errors.Is(err, io.EOF) {
@@ -62,94 +129,420 @@ func (rows *Rows) Close() error {
 	return nil
 }
 
+// closeWithAttention discards up to limit rows of the remainder of the
+// response. If the response has more rows it is cancelled with an
+// attention.
+func (rows *Rows) closeWithAttention(limit int) error {
+	ctx := context.Background()
+	discarded := 0
+	var statusErr error
+
+	for {
+		pkg, err := rows.Conn.Channel.NextPackage(ctx, true)
+		if err != nil {
+			rows.complete = true
+			rows.Conn.checkConnErr(err)
+			return fmt.Errorf("go-ase: error consuming result sets: %w", err)
+		}
+
+		switch typed := pkg.(type) {
+		case *tds.RowPackage:
+			discarded++
+			if discarded <= limit {
+				continue
+			}
+
+			return rows.cancel(ctx)
+		case *tds.ReturnStatusPackage:
+			rows.status.set(typed.ReturnValue)
+			if err := rows.Conn.checkReturnStatus(typed.ReturnValue); err != nil && statusErr == nil {
+				statusErr = err
+			}
+		case *tds.MsgPackage:
+			rows.Conn.handleMsgPackage(typed)
+		case *tds.DonePackage:
+			rows.Conn.trackTransaction(typed)
+			// The channel terminates each response with a
+			// TDS_DONE_FINAL, even if the server does not send one.
+			if typed.Status == tds.TDS_DONE_FINAL {
+				rows.complete = true
+				return statusErr
+			}
+		}
+	}
+}
+
+// cancel cancels the remainder of the response with an attention.
+func (rows *Rows) cancel(ctx context.Context) error {
+	rows.complete = true
+
+	err := rows.Conn.sendAttention(ctx)
+	if err == nil {
+		err = rows.Conn.discardUntilAttentionAck(ctx)
+	}
+
+	if err != nil {
+		rows.Conn.checkConnErr(err)
+		// The state of the response is unknown.
+		if rows.Conn.health != nil {
+			rows.Conn.health.markBad(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
 // Next implements the driver.Rows interface.
 func (rows *Rows) Next(dst []driver.Value) error {
 	if rows.RowFmt == nil && len(dst) == 0 {
 		return io.EOF
 	}
 
-	_, err := rows.Conn.Channel.NextPackageUntil(context.Background(), true,
-		func(pkg tds.Package) (bool, error) {
-			switch typed := pkg.(type) {
-			case *tds.RowPackage:
-				if len(dst) != len(typed.DataFields) {
-					return true, fmt.Errorf("go-ase: received invalid number of destinations, expecting %d destinations, got %d", len(typed.DataFields), len(dst))
-				}
-				for i := range typed.DataFields {
-					dst[i] = typed.DataFields[i].Value()
-				}
-				return true, nil
-			case *tds.RowFmtPackage:
-				rows.RowFmt = typed
-				rows.hasNextResultSet = true
-				return false, io.EOF
-			case *tds.OrderByPackage:
-				return false, nil
-			case *tds.DonePackage:
-				ok, err := handleDonePackage(typed)
-				if err != nil {
-					return true, fmt.Errorf("go-ase: %w", err)
-				}
+	cs := rows.Conn.charset()
 
-				return ok, nil
-			case *tds.ReturnStatusPackage:
-				if typed.ReturnValue != 0 {
-					return true, fmt.Errorf("go-ase: query failed with return status %d", typed.ReturnValue)
-				}
-				return false, nil
-			default:
-				return true, fmt.Errorf("unhandled package type %T: %v", pkg, pkg)
+	return rows.nextRow(func(row *tds.RowPackage) error {
+		if len(dst) != len(row.DataFields) {
+			return fmt.Errorf("go-ase: received invalid number of destinations, expecting %d destinations, got %d", len(row.DataFields), len(dst))
+		}
+		return rows.rowValues(row, dst, cs)
+	})
+}
+
+// nextRow reads the next row of the current result set and passes it
+// to fn. io.EOF is returned if the result set is exhausted.
+//
+// Packages are read the same as with NextPackageUntil, which allocates
+// an EEDError on each call. Rows are read in a loop instead, which
+// saves that allocation per row.
+func (rows *Rows) nextRow(fn func(*tds.RowPackage) error) error {
+	if rows.complete {
+		return io.EOF
+	}
+
+	// Reading rows after the end of a result set continues with the
+	// next result set.
+	rows.hasNextResultSet = false
+
+	ctx := context.Background()
+	var eedError *tds.EEDError
+
+	// TODO reuse the row package and its fields across rows once
+	// go-dblib allows passing buffers to the goroutine parsing the
+	// packages.
+	for {
+		pkg, err := rows.Conn.Channel.NextPackage(ctx, true)
+		if err != nil {
+			rows.complete = true
+			rows.Conn.checkConnErr(err)
+			return fmt.Errorf("go-ase: error reading next row package: %w", err)
+		}
+
+		if eed, ok := pkg.(*tds.EEDPackage); ok {
+			if eedError == nil {
+				eedError = &tds.EEDError{}
 			}
-		},
-	)
+			eedError.Add(eed)
+			continue
+		}
+
+		ok, err := rows.handlePackage(pkg, fn)
+		if err == nil {
+			if ok {
+				return nil
+			}
+			continue
+		}
 
-	if err != nil {
 		// database/sql expects only an io.EOF - it doesn't check with
 		// errors.Is.
+		if err == io.EOF {
+			return io.EOF
+		}
+
+		// Consume the remainder of the response so that it does not
+		// affect the next command.
+		rows.complete = true
+		if done, ok := pkg.(*tds.DonePackage); !ok || done.Status != tds.TDS_DONE_FINAL {
+			_, drainErr := rows.Conn.Channel.NextPackageUntil(ctx, true, rows.Conn.drainPackage)
+			var drainEEDError *tds.EEDError
+			if errors.As(drainErr, &drainEEDError) {
+				if eedError == nil {
+					eedError = &tds.EEDError{}
+				}
+				eedError.EEDPackages = append(eedError.EEDPackages, drainEEDError.EEDPackages...)
+			}
+		}
+
 		if errors.Is(err, io.EOF) {
 			return io.EOF
 		}
+
+		if eedError != nil {
+			eedError.WrappedError = err
+			err = eedError
+		}
 		return fmt.Errorf("go-ase: error reading next row package: %w", err)
 	}
+}
+
+// handlePackage processes a package received while reading rows. The
+// boolean is true if no further packages are read for the row.
+func (rows *Rows) handlePackage(pkg tds.Package, fn func(*tds.RowPackage) error) (bool, error) {
+	switch typed := pkg.(type) {
+	case *tds.RowPackage:
+		return true, fn(typed)
+	case *tds.RowFmtPackage:
+		rows.RowFmt = typed
+		rows.orderBy = nil
+		rows.hasNextResultSet = true
+		return false, io.EOF
+	case *tds.OrderByPackage, *tds.OrderBy2Package:
+		rows.orderBy = orderByColumns(typed)
+		return false, nil
+	case *tds.DonePackage:
+		rows.Conn.trackTransaction(typed)
+		ok, err := handleDonePackage(typed)
+		if err != nil {
+			return true, fmt.Errorf("go-ase: %w", err)
+		}
+
+		return ok, nil
+	case *tds.ReturnStatusPackage:
+		rows.status.set(typed.ReturnValue)
+		if err := rows.Conn.checkReturnStatus(typed.ReturnValue); err != nil {
+			return true, err
+		}
+		return false, nil
+	case *tds.MsgPackage:
+		rows.Conn.handleMsgPackage(typed)
+		return false, nil
+	}
+
+	if compute, ok := isComputePackage(pkg); ok {
+		return false, rows.handleCompute(compute)
+	}
+	return true, fmt.Errorf("unhandled package type %T: %v", pkg, pkg)
+}
+
+// rowValues stores the converted and decoded values of row in dst.
+func (rows *Rows) rowValues(row *tds.RowPackage, dst []driver.Value, cs charset) error {
+	decoders := rows.decoders()
+	for i := range row.DataFields {
+		value := row.DataFields[i].Value()
+		if isNullData(row.DataFields[i].Format(), value) {
+			dst[i] = nil
+			continue
+		}
+
+		hasDecoder := i < len(decoders) && decoders[i] != nil
+
+		// Values of common types need no conversion, they are stored
+		// as is unless a result codec applies.
+		if !hasDecoder {
+			switch value.(type) {
+			case nil, int, int64, int32, int16, uint8, float64, float32, bool:
+				dst[i] = value
+				continue
+			}
+		}
+
+		value, err := rows.convertValue(i, row.DataFields[i], cs)
+		if err != nil {
+			return err
+		}
+
+		if value != nil && hasDecoder {
+			value, err = decoders[i](value)
+			if err != nil {
+				return fmt.Errorf("go-ase: error decoding column %d: %w", i, err)
+			}
+		}
+
+		dst[i] = value
+	}
 
 	return nil
 }
 
+// isNullData reports whether value as decoded by go-dblib is NULL.
+//
+// go-dblib decodes the zero-length data ASE sends for NULL values to
+// the zero value of the data type, e.g. 0 for INTN or "" for VARCHAR.
+// ASE sends empty strings as a single space, hence zero-length data of
+// nullable columns is NULL.
+func isNullData(fieldFmt tds.FieldFmt, value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case int:
+		// Values of other integer types are decoded to sized integers.
+		switch fieldFmt.DataType() {
+		case asetypes.INTN, asetypes.UINTN, asetypes.FLTN:
+			return true
+		}
+	case string:
+		return typed == "" && nullAllowed(fieldFmt)
+	case []byte:
+		return len(typed) == 0 && nullAllowed(fieldFmt)
+	}
+	return false
+}
+
+func nullAllowed(fieldFmt tds.FieldFmt) bool {
+	return tds.RowFmtStatus(fieldFmt.Status())&tds.TDS_ROW_NULLALLOWED == tds.TDS_ROW_NULLALLOWED
+}
+
+// convertValue returns the value of the field converted by the
+// settings of the connection.
+func (rows *Rows) convertValue(i int, field tds.FieldData, cs charset) (interface{}, error) {
+	value := field.Value()
+	fieldFmt := field.Format()
+
+	switch typed := value.(type) {
+	case time.Time:
+		if rows.Conn.location != nil {
+			return inLocation(typed, rows.Conn.location), nil
+		}
+	case []byte:
+		if isUnicodeFmt(fieldFmt) {
+			decoded, err := decodeUTF16(typed)
+			if err != nil {
+				return nil, fmt.Errorf("go-ase: error converting column %d from UTF-16: %w", i, err)
+			}
+			return decoded, nil
+		}
+	case string:
+		if cs != nil && isCharType(fieldFmt.DataType()) {
+			decoded, err := cs.decode([]byte(typed))
+			if err != nil {
+				return nil, fmt.Errorf("go-ase: error converting column %d from charset %s: %w",
+					i, rows.Conn.Charset(), err)
+			}
+			return decoded, nil
+		}
+	}
+
+	return value, nil
+}
+
+// decoders returns the decode functions of the result codecs for the
+// columns of the current result set.
+func (rows *Rows) decoders() []func(interface{}) (interface{}, error) {
+	if rows.RowFmt == nil {
+		return nil
+	}
+
+	if rows.decodersFmt != rows.RowFmt {
+		names := rows.Columns()
+		rows.decodersCache = make([]func(interface{}) (interface{}, error), len(rows.RowFmt.Fmts))
+		for i, fieldFmt := range rows.RowFmt.Fmts {
+			rows.decodersCache[i] = rows.Conn.codecs.result(names[i], fieldFmt)
+		}
+		rows.decodersFmt = rows.RowFmt
+	}
+
+	return rows.decodersCache
+}
+
+// OrderBy returns the indices of the columns the current result set
+// is ordered by, in the order of the ORDER BY clause. nil is returned
+// if the server did not report an order.
+//
+// The server sends the order after the columns of a result set, it is
+// available once Next was called for the result set.
+func (rows Rows) OrderBy() []int {
+	return rows.orderBy
+}
+
+// orderByColumns returns the zero-based column indices of an ORDER BY
+// package, the server sends one-based column numbers.
+func orderByColumns(pkg tds.Package) []int {
+	var columns []int
+	switch typed := pkg.(type) {
+	case *tds.OrderByPackage:
+		columns = typed.ColumnOrder
+	case *tds.OrderBy2Package:
+		columns = typed.ColumnOrder
+	}
+
+	indices := make([]int, len(columns))
+	for i, column := range columns {
+		indices[i] = column - 1
+	}
+	return indices
+}
+
+// procStatus returns the return status of the rows for ReturnStatus.
+func (rows *Rows) procStatus() *procStatus {
+	return rows.status
+}
+
 // HasNextResultSet implements the driver.RowsNextResultSet interface.
 func (rows *Rows) HasNextResultSet() bool {
-	if !rows.hasNextResultSet {
-		return false
-	}
-	rows.hasNextResultSet = false
-	return true
+	return rows.hasNextResultSet
 }
 
 // NextResultSet implements the driver.RowsNextResultSet interface.
+//
+// If the format of the next result set was already read by Next the
+// result set is used as is. Otherwise the rows of the current result
+// set are discarded up to the next result set.
 func (rows *Rows) NextResultSet() error {
-	// discard all RowPackage until either end of communication or next
-	// RowFmtPackage
-	_, err := rows.Conn.Channel.NextPackageUntil(context.Background(), false,
+	if rows.complete {
+		return io.EOF
+	}
+
+	if rows.hasNextResultSet {
+		rows.hasNextResultSet = false
+		return nil
+	}
+
+	_, err := rows.Conn.Channel.NextPackageUntil(context.Background(), true,
 		func(pkg tds.Package) (bool, error) {
 			switch typed := pkg.(type) {
 			case *tds.RowFmtPackage:
 				rows.RowFmt = typed
-				rows.hasNextResultSet = true
-				return false, nil
-			case *tds.RowPackage, *tds.OrderByPackage:
+				rows.orderBy = nil
 				return true, nil
+			case *tds.OrderByPackage, *tds.OrderBy2Package:
+				rows.orderBy = orderByColumns(typed)
+				return false, nil
+			case *tds.RowPackage:
+				return false, nil
+			case *tds.ReturnStatusPackage:
+				rows.status.set(typed.ReturnValue)
+				if err := rows.Conn.checkReturnStatus(typed.ReturnValue); err != nil {
+					return true, err
+				}
+				return false, nil
+			case *tds.MsgPackage:
+				rows.Conn.handleMsgPackage(typed)
+				return false, nil
 			case *tds.DonePackage:
-				if typed.Status&tds.TDS_DONE_MORE == tds.TDS_DONE_MORE {
+				rows.Conn.trackTransaction(typed)
+				// The channel terminates each response with a
+				// TDS_DONE_FINAL, even if the server does not send one.
+				if typed.Status != tds.TDS_DONE_FINAL {
 					return false, nil
 				}
 				return true, fmt.Errorf("go-ase: no next result set: %w", io.EOF)
-			default:
-				return false, fmt.Errorf("unhandled package type %T: %v", pkg, pkg)
 			}
+
+			if compute, ok := isComputePackage(pkg); ok {
+				if err := rows.handleCompute(compute); err != nil {
+					return true, err
+				}
+				return false, nil
+			}
+			return false, fmt.Errorf("unhandled package type %T: %v", pkg, pkg)
 		},
 	)
 
 	if err != nil {
-		if errors.Is(err, tds.ErrNoPackageReady) || errors.Is(err, io.EOF) {
+		// The remainder of the response is consumed on errors.
+		rows.complete = true
+		if errors.Is(err, io.EOF) {
 			return io.EOF
 		}
 		return fmt.Errorf("go-ase: error reading next package: %w", err)
@@ -163,7 +556,13 @@ func (rows Rows) ColumnTypeLength(index int) (int64, bool) {
 	if index >= len(rows.RowFmt.Fmts) {
 		return 0, false
 	}
-	return rows.RowFmt.Fmts[index].MaxLength(), true
+
+	fieldFmt := rows.RowFmt.Fmts[index]
+	if isUnicodeFmt(fieldFmt) {
+		// The length of unicode columns is reported in characters.
+		return fieldFmt.MaxLength() / 2, true
+	}
+	return fieldFmt.MaxLength(), true
 }
 
 // ColumnTypeDatabaseTypeName implements the
@@ -172,5 +571,9 @@ func (rows Rows) ColumnTypeDatabaseTypeName(index int) string {
 	if index >= len(rows.RowFmt.Fmts) {
 		return ""
 	}
+
+	if name := unicodeTypeName(rows.RowFmt.Fmts[index]); name != "" {
+		return name
+	}
 	return string(rows.RowFmt.Fmts[index].DataType())
 }
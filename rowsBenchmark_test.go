@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/dsn"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// benchColumns are the columns of the rows sent by benchHandler.
+var benchColumns = []aseserver.Column{
+	{Name: "id", DataType: asetypes.INT4},
+	{Name: "price", DataType: asetypes.FLT8},
+	{Name: "name", DataType: asetypes.VARCHAR, Length: 32},
+	{Name: "amount", DataType: asetypes.INTN, Length: 8},
+}
+
+// benchChunk is the number of rows benchHandler sends at once.
+const benchChunk = 256
+
+// benchRows are benchChunk encoded rows of benchColumns.
+var benchRows = encodeBenchRows(benchChunk)
+
+// encodeBenchRows encodes n rows of benchColumns.
+//
+// The server runs in the process of the benchmarks, the rows are
+// encoded once so that the server adds few allocations to the
+// allocations reported by the benchmarks.
+func encodeBenchRows(n int) rawPackage {
+	var bs []byte
+	name := "benchmark row"
+	for i := 0; i < n; i++ {
+		bs = append(bs, byte(tds.TDS_ROW))
+		bs = appendUint32(bs, uint32(i))
+		bs = appendUint64(bs, math.Float64bits(float64(i)/4))
+		bs = append(bs, byte(len(name)))
+		bs = append(bs, name...)
+		bs = append(bs, 8)
+		bs = appendUint64(bs, uint64(i)*1000)
+	}
+	return bs
+}
+
+func appendUint32(bs []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(bs, buf[:]...)
+}
+
+func appendUint64(bs []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(bs, buf[:]...)
+}
+
+// rawPackage writes pre-encoded tokens.
+type rawPackage []byte
+
+func (pkg rawPackage) ReadFrom(ch tds.BytesChannel) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (pkg rawPackage) WriteTo(ch tds.BytesChannel) error {
+	return ch.WriteBytes(pkg)
+}
+
+func (pkg rawPackage) String() string {
+	return fmt.Sprintf("%T(%d)", pkg, len(pkg))
+}
+
+// benchHandler responds to "select <n>" with n rows of benchColumns.
+type benchHandler struct{}
+
+func (benchHandler) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	n, err := strconv.Atoi(strings.TrimPrefix(req.Query, "select "))
+	if err != nil {
+		return err
+	}
+
+	if err := w.WriteRowFmt(benchColumns...); err != nil {
+		return err
+	}
+
+	rowLen := len(benchRows) / benchChunk
+	for sent := 0; sent < n; sent += benchChunk {
+		chunk := n - sent
+		if chunk > benchChunk {
+			chunk = benchChunk
+		}
+		if err := w.WritePackage(benchRows[:chunk*rowLen]); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteDone(tds.TDS_DONE_COUNT, int32(n))
+}
+
+// benchDB returns a database connected to a server running
+// benchHandler.
+func benchDB(b *testing.B) *sql.DB {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	srv := &aseserver.Server{Handler: benchHandler{}}
+	go srv.Serve(l)
+	b.Cleanup(func() { srv.Close() })
+
+	info, err := dsn.ParseDSN("ase://user:pass@" + l.Addr().String() + "/")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	connector, err := ase.NewConnector(info)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	db := sql.OpenDB(connector)
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// benchRawRows calls fn with the rows of "select <b.N>" read through
+// the driver.
+func benchRawRows(b *testing.B, fn func(*ase.Rows) error) {
+	conn, err := benchDB(b).Conn(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		rows, _, err := driverConn.(*ase.Conn).GenericExec(context.Background(), "select "+strconv.Itoa(b.N), nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		return fn(rows.(*ase.Rows))
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkRowsNext(b *testing.B) {
+	benchRawRows(b, func(rows *ase.Rows) error {
+		dst := make([]driver.Value, len(benchColumns))
+		for i := 0; i < b.N; i++ {
+			if err := rows.Next(dst); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func BenchmarkRowsNextColumnBatch(b *testing.B) {
+	benchRawRows(b, func(rows *ase.Rows) error {
+		batch := ase.NewColumnBatch(1024)
+		for read := 0; read < b.N; read += batch.Len {
+			if err := rows.NextColumnBatch(batch); err != nil {
+				if err == io.EOF {
+					return fmt.Errorf("received %d of %d rows", read, b.N)
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func BenchmarkSQLRowsScan(b *testing.B) {
+	db := benchDB(b)
+
+	rows, err := db.Query("select " + strconv.Itoa(b.N))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rows.Close()
+
+	var (
+		id     int64
+		price  float64
+		name   string
+		amount int64
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !rows.Next() {
+			b.Fatalf("received %d of %d rows: %v", i, b.N, rows.Err())
+		}
+		if err := rows.Scan(&id, &price, &name, &amount); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+)
+
+// closeServer responds to "select <n>" with n rows and to "endless"
+// with rows until the request is cancelled. "delayed <n>" sends n rows,
+// waits and sends another n rows. Any other query returns a single row
+// with the value 42.
+type closeServer struct {
+	sync.Mutex
+	written   int
+	cancelled bool
+}
+
+func (srv *closeServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	if err := w.WriteRowFmt(aseserver.Column{Name: "value", DataType: asetypes.INT4}); err != nil {
+		return err
+	}
+
+	fields := strings.Fields(req.Query)
+	if len(fields) != 2 && req.Query != "endless" {
+		return w.WriteRow(int32(42))
+	}
+
+	n := 1 << 30
+	if len(fields) == 2 {
+		var err error
+		if n, err = strconv.Atoi(fields[1]); err != nil {
+			return err
+		}
+	}
+
+	srv.Lock()
+	srv.written, srv.cancelled = 0, false
+	srv.Unlock()
+
+	err := srv.writeRows(ctx, w, n)
+	if err == nil && fields[0] == "delayed" {
+		select {
+		case <-ctx.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		err = srv.writeRows(ctx, w, n)
+	}
+
+	srv.Lock()
+	srv.cancelled = ctx.Err() != nil
+	srv.Unlock()
+
+	return err
+}
+
+func (srv *closeServer) writeRows(ctx context.Context, w *aseserver.ResponseWriter, n int) error {
+	for i := 0; i < n; i++ {
+		if err := w.WriteRow(int32(i)); err != nil {
+			return err
+		}
+
+		srv.Lock()
+		srv.written++
+		srv.Unlock()
+	}
+	return nil
+}
+
+func TestRows_Close(t *testing.T) {
+	cases := map[string]struct {
+		props           []string
+		query           string
+		expectCancelled bool
+		expectWritten   int
+	}{
+		"discard remaining rows": {
+			query:         "select 10000",
+			expectWritten: 10000,
+		},
+		"remaining rows below limit": {
+			props:         []string{"close-attention-rows", "1000"},
+			query:         "select 500",
+			expectWritten: 500,
+		},
+		"attention": {
+			props:           []string{"close-attention-rows", "10"},
+			query:           "endless",
+			expectCancelled: true,
+		},
+		"response completed later": {
+			query:         "delayed 2000",
+			expectWritten: 4000,
+		},
+		"attention while response is delayed": {
+			props:           []string{"close-attention-rows", "10"},
+			query:           "delayed 2000",
+			expectCancelled: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &closeServer{}
+				db := fakeDB(t, srv, cas.props...)
+
+				rows, err := db.Query(cas.query)
+				if err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+
+				if !rows.Next() {
+					t.Fatalf("No row received: %v", rows.Err())
+				}
+
+				if err := rows.Close(); err != nil {
+					t.Fatalf("Closing rows failed: %v", err)
+				}
+
+				// The response was read completely or cancelled, the
+				// next statement receives its own response.
+				var value int
+				if err := db.QueryRow("value").Scan(&value); err != nil {
+					t.Fatalf("Statement after closing rows failed: %v", err)
+				}
+				if value != 42 {
+					t.Errorf("Expected 42 from the next statement, received %d", value)
+				}
+
+				srv.Lock()
+				defer srv.Unlock()
+
+				if srv.cancelled != cas.expectCancelled {
+					t.Errorf("Expected cancelled %t, received %t", cas.expectCancelled, srv.cancelled)
+				}
+				if !cas.expectCancelled && srv.written != cas.expectWritten {
+					t.Errorf("Expected %d rows written, received %d", cas.expectWritten, srv.written)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,371 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Interface satisfaction checks.
+var (
+	_ Session = (*Conn)(nil)
+	_ Session = (*replicaConn)(nil)
+)
+
+// Session exposes the state of the session of a connection.
+//
+// The connections of go-ase implement Session, the state of a session
+// can be retrieved through sql.Conn.Raw:
+//
+//	err := conn.Raw(func(driverConn interface{}) error {
+//		session := driverConn.(ase.Session)
+//		log.Printf("using database %s", session.CurrentDatabase())
+//		return nil
+//	})
+type Session interface {
+	// CurrentDatabase returns the current database.
+	CurrentDatabase() string
+	// Charset returns the character set of the session.
+	Charset() string
+	// Language returns the language of the session.
+	Language() string
+	// PacketSize returns the negotiated packet size.
+	PacketSize() int
+	// SPID returns the server process ID of the session.
+	SPID(ctx context.Context) (int, error)
+	// ServerInfo returns information about the server.
+	ServerInfo(ctx context.Context) (ServerInfo, error)
+}
+
+// ServerInfo contains information about a server.
+type ServerInfo struct {
+	// Version is the version string of the server as returned by
+	// @@version.
+	Version string
+	// Capabilities are the capabilities the server acknowledged during
+	// login.
+	Capabilities *tds.CapabilityPackage
+}
+
+// roleRegexp matches a language command enabling or disabling a role,
+// e.g. `set role sa_role on` or `set role r with passwd "pw" on`.
+var roleRegexp = regexp.MustCompile(`(?is)^\s*set\s+role\s+("[^"]+"|\S+)(\s+with\s+passwd\s+.+?)?\s+(on|off)\s*;?\s*$`)
+
+// sessionState records the state of a session.
+//
+// The state is updated from the goroutine of go-dblib calling hooks,
+// hence it is guarded by a mutex.
+type sessionState struct {
+	sync.Mutex
+
+	database   string
+	charset    string
+	language   string
+	packetSize int
+
+	// spid and version are queried on first use.
+	spid    int
+	version string
+
+	// options are the options set through OptionCmdPackages.
+	options     map[tds.OptionCmdOption]*tds.OptionCmdPackage
+	optionOrder []tds.OptionCmdOption
+
+	// roles are the statements enabling the active roles.
+	roles     map[string]string
+	roleOrder []string
+}
+
+func newSessionState() *sessionState {
+	return &sessionState{
+		options: map[tds.OptionCmdOption]*tds.OptionCmdPackage{},
+		roles:   map[string]string{},
+	}
+}
+
+// envChangeHook returns an EnvChangeHook recording the environment
+// changes.
+func (session *sessionState) envChangeHook() tds.EnvChangeHook {
+	return func(typ tds.EnvChangeType, oldValue, newValue string) {
+		session.Lock()
+		defer session.Unlock()
+
+		switch typ {
+		case tds.TDS_ENV_DB:
+			session.database = newValue
+		case tds.TDS_ENV_LANG:
+			session.language = newValue
+		case tds.TDS_ENV_CHARSET:
+			session.charset = newValue
+		case tds.TDS_ENV_PACKSIZE:
+			// go-dblib fails the connection if the packet size cannot
+			// be parsed.
+			session.packetSize, _ = strconv.Atoi(newValue)
+		}
+	}
+}
+
+func (session *sessionState) recordOption(pkg *tds.OptionCmdPackage) {
+	session.Lock()
+	defer session.Unlock()
+
+	if pkg.Cmd == tds.TDS_OPT_DEFAULT {
+		// The option is reset to the default of a new session.
+		if _, ok := session.options[pkg.Option]; ok {
+			delete(session.options, pkg.Option)
+			for i, option := range session.optionOrder {
+				if option == pkg.Option {
+					session.optionOrder = append(session.optionOrder[:i], session.optionOrder[i+1:]...)
+					break
+				}
+			}
+		}
+		return
+	}
+
+	if _, ok := session.options[pkg.Option]; !ok {
+		session.optionOrder = append(session.optionOrder, pkg.Option)
+	}
+
+	session.options[pkg.Option] = &tds.OptionCmdPackage{
+		Cmd:       pkg.Cmd,
+		Option:    pkg.Option,
+		OptionArg: append([]byte(nil), pkg.OptionArg...),
+	}
+}
+
+// recordRole records the role enabled or disabled by query if query is
+// a `set role` command.
+func (session *sessionState) recordRole(query string) {
+	match := roleRegexp.FindStringSubmatch(query)
+	if match == nil {
+		return
+	}
+
+	role := strings.Trim(match[1], `"`)
+
+	session.Lock()
+	defer session.Unlock()
+
+	_, active := session.roles[role]
+
+	if strings.EqualFold(match[3], "off") {
+		if !active {
+			return
+		}
+
+		delete(session.roles, role)
+		for i, name := range session.roleOrder {
+			if name == role {
+				session.roleOrder = append(session.roleOrder[:i], session.roleOrder[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+
+	if !active {
+		session.roleOrder = append(session.roleOrder, role)
+	}
+	session.roles[role] = strings.TrimSpace(query)
+}
+
+// snapshot returns a copy of the session state to be restored after
+// reconnecting.
+func (session *sessionState) snapshot() *sessionState {
+	session.Lock()
+	defer session.Unlock()
+
+	snapshot := newSessionState()
+	snapshot.database = session.database
+
+	for _, option := range session.optionOrder {
+		snapshot.options[option] = session.options[option]
+		snapshot.optionOrder = append(snapshot.optionOrder, option)
+	}
+
+	for _, role := range session.roleOrder {
+		snapshot.roles[role] = session.roles[role]
+		snapshot.roleOrder = append(snapshot.roleOrder, role)
+	}
+
+	return snapshot
+}
+
+// queueOption queues an OptionCmdPackage and records the option to be
+// restored after reconnecting.
+func (c *Conn) queueOption(ctx context.Context, pkg *tds.OptionCmdPackage) error {
+	if err := c.Channel.QueuePackage(ctx, pkg); err != nil {
+		return fmt.Errorf("go-ase: error queueing package: %w", err)
+	}
+
+	c.session.recordOption(pkg)
+	return nil
+}
+
+// CurrentDatabase returns the current database.
+func (c *Conn) CurrentDatabase() string {
+	c.session.Lock()
+	defer c.session.Unlock()
+	return c.session.database
+}
+
+// Charset returns the character set of the session.
+func (c *Conn) Charset() string {
+	c.session.Lock()
+	defer c.session.Unlock()
+	return c.session.charset
+}
+
+// Language returns the language of the session.
+func (c *Conn) Language() string {
+	c.session.Lock()
+	defer c.session.Unlock()
+	return c.session.language
+}
+
+// PacketSize returns the negotiated packet size.
+func (c *Conn) PacketSize() int {
+	c.session.Lock()
+	defer c.session.Unlock()
+
+	if c.session.packetSize == 0 {
+		return c.Conn.PacketSize()
+	}
+	return c.session.packetSize
+}
+
+// SPID returns the server process ID of the session.
+//
+// The server process ID is queried on first use and must not be
+// requested while the results of a statement are read.
+func (c *Conn) SPID(ctx context.Context) (int, error) {
+	if err := c.queryServerInfo(ctx); err != nil {
+		return 0, err
+	}
+
+	c.session.Lock()
+	defer c.session.Unlock()
+	return c.session.spid, nil
+}
+
+// ServerInfo returns information about the server.
+//
+// The version is queried on first use and must not be requested while
+// the results of a statement are read.
+func (c *Conn) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	if err := c.queryServerInfo(ctx); err != nil {
+		return ServerInfo{}, err
+	}
+
+	c.session.Lock()
+	defer c.session.Unlock()
+	return ServerInfo{
+		Version:      c.session.version,
+		Capabilities: c.Conn.Caps,
+	}, nil
+}
+
+// queryServerInfo queries the server process ID and version if they
+// have not been queried yet.
+//
+// The login acknowledgement of TDS 5.0 contains neither, hence they are
+// queried from the server. The query is sent on the channel directly,
+// bypassing the reconnect, codecs and identity handling of GenericExec.
+func (c *Conn) queryServerInfo(ctx context.Context) error {
+	c.session.Lock()
+	queried := c.session.version != ""
+	c.session.Unlock()
+
+	if queried {
+		return nil
+	}
+
+	langPkg := &tds.LanguagePackage{
+		Status: tds.TDS_LANGUAGE_NOARGS,
+		Cmd:    "select @@spid, @@version",
+	}
+
+	if err := c.Channel.SendPackage(ctx, langPkg); err != nil {
+		c.checkConnErr(err)
+		return fmt.Errorf("go-ase: error querying server information: %w", err)
+	}
+
+	var values []interface{}
+	_, err := c.Channel.NextPackageUntil(ctx, true,
+		func(pkg tds.Package) (bool, error) {
+			switch typed := pkg.(type) {
+			case *tds.RowPackage:
+				values = make([]interface{}, len(typed.DataFields))
+				for i, field := range typed.DataFields {
+					values[i] = field.Value()
+				}
+			case *tds.MsgPackage:
+				c.handleMsgPackage(typed)
+			case *tds.DonePackage:
+				c.trackTransaction(typed)
+				if typed.Status&tds.TDS_DONE_ERROR == tds.TDS_DONE_ERROR {
+					return true, errors.New("query failed with errors")
+				}
+				return typed.Status&tds.TDS_DONE_MORE != tds.TDS_DONE_MORE, nil
+			}
+			return false, nil
+		},
+	)
+	if err != nil {
+		c.checkConnErr(err)
+		return fmt.Errorf("go-ase: error querying server information: %w", err)
+	}
+
+	if len(values) != 2 {
+		return fmt.Errorf("go-ase: expected @@spid and @@version, received %d values", len(values))
+	}
+
+	spid, ok := asInt(values[0])
+	if !ok {
+		return fmt.Errorf("go-ase: unexpected type %T of @@spid", values[0])
+	}
+
+	version, ok := values[1].(string)
+	if !ok {
+		return fmt.Errorf("go-ase: unexpected type %T of @@version", values[1])
+	}
+
+	if version, err = c.decodeString(version); err != nil {
+		return err
+	}
+
+	c.session.Lock()
+	defer c.session.Unlock()
+	c.session.spid = spid
+	c.session.version = version
+
+	return nil
+}
+
+// asInt converts integer values returned by go-dblib to int.
+func asInt(value driver.Value) (int, bool) {
+	switch typed := value.(type) {
+	case int64:
+		return int(typed), true
+	case int32:
+		return int(typed), true
+	case int16:
+		return int(typed), true
+	case uint8:
+		return int(typed), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// sessionServer changes the environment on `use`, `set language` and
+// `set char_convert` and responds to the query of the server
+// information. It records the session and the number of server
+// information queries.
+type sessionServer struct {
+	sync.Mutex
+	session     aseserver.Session
+	infoQueries int
+	failInfo    bool
+}
+
+func (srv *sessionServer) HandleLanguage(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	srv.Lock()
+	defer srv.Unlock()
+
+	fields := strings.Fields(req.Query)
+	switch {
+	case req.Query == "select @@spid, @@version":
+		srv.infoQueries++
+		if srv.failInfo {
+			return errors.New("permission denied")
+		}
+		if err := w.WriteRowFmt(
+			aseserver.Column{DataType: asetypes.INT2},
+			aseserver.Column{DataType: asetypes.VARCHAR, Length: 255},
+		); err != nil {
+			return err
+		}
+		return w.WriteRow(int16(17), "Adaptive Server Enterprise/16.0")
+	case len(fields) == 2 && fields[0] == "use":
+		return w.WriteEnvChange(tds.TDS_ENV_DB, fields[1], w.Session().Database)
+	case len(fields) == 3 && fields[1] == "language":
+		return w.WriteEnvChange(tds.TDS_ENV_LANG, fields[2], w.Session().Language)
+	case len(fields) == 3 && fields[1] == "char_convert":
+		return w.WriteEnvChange(tds.TDS_ENV_CHARSET, fields[2], w.Session().Charset)
+	}
+
+	srv.session = *w.Session()
+	return nil
+}
+
+// withSession passes the Session of the driver connection of conn to
+// fn.
+func withSession(t *testing.T, conn interface {
+	Raw(func(interface{}) error) error
+}, fn func(session ase.Session)) {
+	if err := conn.Raw(func(driverConn interface{}) error {
+		fn(driverConn.(ase.Session))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSession_EnvChange(t *testing.T) {
+	cases := map[string]struct {
+		query  string
+		get    func(session ase.Session) string
+		expect string
+	}{
+		"database": {
+			query:  "use db1",
+			get:    ase.Session.CurrentDatabase,
+			expect: "db1",
+		},
+		"language": {
+			query:  "set language deutsch",
+			get:    ase.Session.Language,
+			expect: "deutsch",
+		},
+		"charset": {
+			query:  "set char_convert iso_1",
+			get:    ase.Session.Charset,
+			expect: "iso_1",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &sessionServer{}
+				db := fakeDB(t, srv)
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				// The server records its view of the session.
+				if _, err := conn.ExecContext(ctx, "select 1"); err != nil {
+					t.Fatalf("Exec failed: %v", err)
+				}
+
+				srv.Lock()
+				session := srv.session
+				srv.Unlock()
+
+				withSession(t, conn, func(s ase.Session) {
+					if s.CurrentDatabase() != session.Database {
+						t.Errorf("Expected database %q after login, received %q", session.Database, s.CurrentDatabase())
+					}
+					if s.Language() != session.Language {
+						t.Errorf("Expected language %q after login, received %q", session.Language, s.Language())
+					}
+					if s.Charset() != session.Charset {
+						t.Errorf("Expected charset %q after login, received %q", session.Charset, s.Charset())
+					}
+					if s.PacketSize() != session.PacketSize {
+						t.Errorf("Expected packet size %d after login, received %d", session.PacketSize, s.PacketSize())
+					}
+				})
+
+				if _, err := conn.ExecContext(ctx, cas.query); err != nil {
+					t.Fatalf("Exec failed: %v", err)
+				}
+
+				withSession(t, conn, func(s ase.Session) {
+					if value := cas.get(s); value != cas.expect {
+						t.Errorf("Expected %q, received %q", cas.expect, value)
+					}
+				})
+			},
+		)
+	}
+}
+
+func TestSession_ServerInfo(t *testing.T) {
+	cases := map[string]struct {
+		failInfo bool
+	}{
+		"server information": {},
+		"query failing": {
+			failInfo: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				srv := &sessionServer{failInfo: cas.failInfo}
+				db := fakeDB(t, srv, "reconnect", "true")
+				ctx := context.Background()
+
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+
+				withSession(t, conn, func(s ase.Session) {
+					for i := 0; i < 2; i++ {
+						spid, err := s.SPID(ctx)
+						if cas.failInfo {
+							if err == nil {
+								t.Errorf("Expected SPID to fail, received %d", spid)
+							}
+							continue
+						}
+						if err != nil || spid != 17 {
+							t.Errorf("Expected SPID 17, received %d: %v", spid, err)
+						}
+
+						info, err := s.ServerInfo(ctx)
+						if err != nil {
+							t.Fatalf("ServerInfo failed: %v", err)
+						}
+						if info.Version != "Adaptive Server Enterprise/16.0" {
+							t.Errorf("Unexpected version %q", info.Version)
+						}
+						if info.Capabilities == nil {
+							t.Errorf("Expected capabilities of the login")
+						}
+					}
+				})
+
+				// The information is queried once and cached, failed
+				// queries are neither retried nor cached.
+				srv.Lock()
+				queries := srv.infoQueries
+				srv.Unlock()
+
+				expect := 1
+				if cas.failInfo {
+					expect = 2
+				}
+				if queries != expect {
+					t.Errorf("Expected %d queries of the server information, received %d", expect, queries)
+				}
+
+				if err := conn.PingContext(ctx); err != nil {
+					t.Errorf("Connection unusable: %v", err)
+				}
+			},
+		)
+	}
+}
@@ -74,7 +74,9 @@ func (tx Transaction) begin(ctx context.Context, opts driver.TxOptions) error {
 		return fmt.Errorf("go-ase: sql.IsolationLevel %s has no equivalent ASE isolation level", sql.IsolationLevel(opts.Isolation))
 	}
 
-	if _, _, err := tx.conn.GenericExec(ctx, "begin transaction "+tx.name, nil); err != nil {
+	// No transaction is open yet, beginning the transaction can be
+	// retried after reconnecting.
+	if _, _, err := tx.conn.GenericExec(WithIdempotent(ctx), "begin transaction "+tx.name, nil); err != nil {
 		return fmt.Errorf("go-ase: error initializing transaction: %w", err)
 	}
 
@@ -83,10 +85,11 @@ func (tx Transaction) begin(ctx context.Context, opts driver.TxOptions) error {
 		Option:    tds.TDS_OPT_ISOLATION,
 		OptionArg: []byte{byte(isolationLvl)},
 	}
-	if err := tx.conn.Channel.QueuePackage(ctx, optIsolationPkg); err != nil {
-		return fmt.Errorf("go-ase: error queueing package: %w", err)
+	if err := tx.conn.queueOption(ctx, optIsolationPkg); err != nil {
+		return err
 	}
 
+	tx.conn.txDepth++
 	return nil
 }
 
@@ -101,6 +104,7 @@ func (tx Transaction) NewTransaction(ctx context.Context, opts driver.TxOptions)
 
 // Commit implements the driver.Tx interface.
 func (tx Transaction) Commit() error {
+	defer tx.end()
 	if _, _, err := tx.conn.GenericExec(context.Background(), "commit "+tx.name, nil); err != nil {
 		return fmt.Errorf("go-ase: error committing transaction: %w", err)
 	}
@@ -109,8 +113,16 @@ func (tx Transaction) Commit() error {
 
 // Rollback implements the driver.Tx interface.
 func (tx Transaction) Rollback() error {
+	defer tx.end()
 	if _, _, err := tx.conn.GenericExec(context.Background(), "rollback "+tx.name, nil); err != nil {
 		return fmt.Errorf("go-ase: error rolling back transaction: %w", err)
 	}
 	return nil
 }
+
+// end records that the transaction was committed or rolled back.
+func (tx Transaction) end() {
+	if tx.conn.txDepth > 0 {
+		tx.conn.txDepth--
+	}
+}
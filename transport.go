@@ -0,0 +1,341 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAP/go-dblib/dsn"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// Dialer establishes the connection to a TDS server.
+//
+// The signature matches (*net.Dialer).DialContext, hence net.Dialer
+// and most proxy implementations can be used directly.
+type Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// openTDSConn returns a tds.Conn to the server configured in the
+// connector.
+//
+// go-dblib always dials the server itself and only supports the TLS
+// options of the DSN. If a custom dialer, a TLS configuration or a
+// client certificate is configured the connection is established by
+// go-ase and then bridged to go-dblib. The same applies to IPv6
+// addresses as go-dblib does not enclose them in brackets. In that
+// case the connection to the server is returned as well.
+func openTDSConn(ctx context.Context, connector *Connector) (*tds.Conn, net.Conn, error) {
+	network := connector.DSN.PropDefault("network", "tcp")
+	addr := net.JoinHostPort(connector.DSN.Host, connector.DSN.Port)
+
+	ipv6 := strings.Contains(connector.DSN.Host, ":")
+	if connector.Dialer == nil && connector.TLSConfig == nil && !hasClientCert(connector.DSN) && !ipv6 {
+		conn, err := dialTDSConn(ctx, connector.DSN, addr)
+		return conn, nil, err
+	}
+
+	tlsConfig, err := connector.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer := connector.Dialer
+	if dialer == nil {
+		dialer = (&net.Dialer{}).DialContext
+	}
+
+	nc, err := dialer(ctx, network, addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("error dialing %s: %w", addr, err)
+	}
+
+	if tlsConfig != nil {
+		nc, err = tlsHandshake(ctx, nc, tlsConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, err := bridgeTDSConn(nc, connector.DSN)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	return conn, nc, nil
+}
+
+// dialTDSConn lets go-dblib dial the server and aborts waiting for the
+// connection when ctx is done.
+func dialTDSConn(ctx context.Context, info *dsn.Info, addr string) (*tds.Conn, error) {
+	type dialResult struct {
+		conn *tds.Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+
+	go func() {
+		// Cannot pass the passed context along here as tds.NewConn
+		// creates a child context from the passed context, which is
+		// used for the lifetime of the connection.
+		conn, err := tds.NewConn(context.Background(), info)
+		dialed <- dialResult{conn, err}
+	}()
+
+	select {
+	case res := <-dialed:
+		if res.err != nil {
+			return nil, fmt.Errorf("error connecting to %s: %w", addr, res.err)
+		}
+		return res.conn, nil
+	case <-ctx.Done():
+		// tds.NewConn cannot be interrupted. The goroutine ends once
+		// go-dblib's dial returns, which is bounded by the connect
+		// timeout of the operating system. An established connection
+		// is closed.
+		go func() {
+			if res := <-dialed; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("error connecting to %s: %w", addr, ctx.Err())
+	}
+}
+
+// tlsConfig returns the TLS configuration for connections of the
+// connector or nil if TLS is disabled.
+//
+// Connector.TLSConfig takes precedence over the TLS options of the
+// DSN. If no server name is set in Connector.TLSConfig the server name
+// is taken from the DSN.
+func (c *Connector) tlsConfig() (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	switch {
+	case c.TLSConfig != nil:
+		tlsConfig = c.TLSConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = tlsServerName(c.DSN)
+		}
+	case tlsEnabled(c.DSN):
+		var err error
+		tlsConfig, err = tlsConfigFromDSN(c.DSN)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if hasClientCert(c.DSN) && len(tlsConfig.Certificates) == 0 && tlsConfig.GetClientCertificate == nil {
+		certFile := c.DSN.PropDefault("tls-cert", "")
+		keyFile := c.DSN.PropDefault("tls-key", certFile)
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate from tls-cert path '%s' and tls-key path '%s': %w",
+				certFile, keyFile, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsEnabled mirrors the check of go-dblib whether TLS is used.
+func tlsEnabled(info *dsn.Info) bool {
+	return info.TLSEnable || strings.TrimSpace(strings.Replace(info.Port, "0", "", -1)) == "443"
+}
+
+// hasClientCert reports whether a client certificate is configured
+// in the DSN.
+func hasClientCert(info *dsn.Info) bool {
+	return info.PropDefault("tls-cert", "") != ""
+}
+
+// tlsServerName returns the server name used to validate the
+// certificate of the server.
+func tlsServerName(info *dsn.Info) string {
+	if info.TLSHostname != "" {
+		return strings.TrimPrefix(info.TLSHostname, "CN=")
+	}
+	return info.Host
+}
+
+// tlsConfigFromDSN creates a TLS configuration from the TLS options of
+// the DSN, equivalent to the configuration used by go-dblib.
+func tlsConfigFromDSN(info *dsn.Info) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         tlsServerName(info),
+		InsecureSkipVerify: info.TLSSkipValidation,
+	}
+
+	if info.TLSCAFile != "" {
+		bs, err := ioutil.ReadFile(info.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file at ssl-ca path '%s': %w", info.TLSCAFile, err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for {
+			var block *pem.Block
+			block, bs = pem.Decode(bs)
+			if block == nil {
+				break
+			}
+
+			caCert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing CA PEM at ssl-ca path '%s': %w", info.TLSCAFile, err)
+			}
+
+			tlsConfig.RootCAs.AddCert(caCert)
+		}
+
+		if len(tlsConfig.RootCAs.Subjects()) == 0 {
+			return nil, fmt.Errorf("could not parse any valid CA certificate from file '%s'", info.TLSCAFile)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// tlsHandshake performs a TLS handshake on nc. The handshake is
+// aborted when ctx is done.
+func tlsHandshake(ctx context.Context, nc net.Conn, tlsConfig *tls.Config) (net.Conn, error) {
+	tlsConn := tls.Client(nc, tlsConfig)
+
+	// The deadline of ctx is not set on the connection, otherwise the
+	// handshake could fail before ctx reports the exceeded deadline.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock the handshake.
+			tlsConn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("error during TLS handshake with server: %w", err)
+	}
+
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// maxSocketPath is the maximum length of the path of a unix socket
+// supported on all platforms.
+const maxSocketPath = 103
+
+// bridgeTDSConn creates a tds.Conn communicating over nc.
+//
+// tds.NewConn can only dial the server itself and go-dblib offers no
+// constructor accepting a net.Conn. Hence a unix socket is created in
+// a private directory, go-dblib dials the socket and the data is copied
+// between the accepted connection and nc. The socket is removed as soon
+// as go-dblib is connected.
+func bridgeTDSConn(nc net.Conn, info *dsn.Info) (*tds.Conn, error) {
+	dir, err := ioutil.TempDir("", "go-ase")
+	if err != nil {
+		return nil, fmt.Errorf("error creating directory for bridge socket in %q, set TMPDIR to a writable directory: %w",
+			os.TempDir(), err)
+	}
+	defer os.RemoveAll(dir)
+
+	if path := filepath.Join(dir, "tds") + ":0"; len(path) > maxSocketPath {
+		return nil, fmt.Errorf("path of bridge socket %q exceeds %d bytes, set TMPDIR to a shorter directory",
+			path, maxSocketPath)
+	}
+
+	// go-dblib dials "<host>:<port>", which is used as the path of the
+	// socket.
+	bridgeInfo := *info
+	bridgeInfo.Host = filepath.Join(dir, "tds")
+	bridgeInfo.Port = "0"
+	bridgeInfo.TLSEnable = false
+	bridgeInfo.ConnectProps = url.Values{}
+	for key, values := range info.ConnectProps {
+		bridgeInfo.ConnectProps[key] = append([]string(nil), values...)
+	}
+	bridgeInfo.ConnectProps.Set("network", "unix")
+
+	l, err := net.Listen("unix", bridgeInfo.Host+":"+bridgeInfo.Port)
+	if err != nil {
+		return nil, fmt.Errorf("error creating bridge socket %q, connections through a Dialer, TLSConfig, tls-cert or to IPv6 addresses require unix sockets: %w",
+			bridgeInfo.Host, err)
+	}
+	defer l.Close()
+
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+	accepted := make(chan acceptResult, 1)
+	go func() {
+		conn, err := l.Accept()
+		accepted <- acceptResult{conn, err}
+	}()
+
+	conn, err := tds.NewConn(context.Background(), &bridgeInfo)
+	if err != nil {
+		l.Close()
+		if res := <-accepted; res.conn != nil {
+			res.conn.Close()
+		}
+		return nil, fmt.Errorf("error opening bridged connection: %w", err)
+	}
+
+	res := <-accepted
+	if res.err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error accepting bridged connection: %w", res.err)
+	}
+
+	go pipe(res.conn, nc)
+
+	return conn, nil
+}
+
+// pipe copies data between a and b until either side is closed.
+func pipe(a, b net.Conn) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			a.Close()
+			b.Close()
+		})
+	}
+
+	go func() {
+		io.Copy(a, b)
+		closeBoth()
+	}()
+
+	io.Copy(b, a)
+	closeBoth()
+}
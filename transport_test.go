@@ -0,0 +1,395 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SAP/go-ase"
+	"github.com/SAP/go-ase/aseserver"
+	"github.com/SAP/go-dblib/asetypes"
+)
+
+// selectOne responds to all queries with a single row.
+var selectOne = aseserver.HandlerFunc(func(ctx context.Context, w *aseserver.ResponseWriter, req *aseserver.LanguageRequest) error {
+	if err := w.WriteRowFmt(aseserver.Column{DataType: asetypes.INT4}); err != nil {
+		return err
+	}
+	return w.WriteRow(int32(1))
+})
+
+// pipeListener is a net.Listener accepting connections created with
+// net.Pipe.
+type pipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "pipe", Net: "pipe"}
+}
+
+func (l *pipeListener) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func TestConnector_Dialer(t *testing.T) {
+	l := newPipeListener()
+	srv := &aseserver.Server{Handler: selectOne}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	var dialed []string
+	info := fakeInfo(t, "db.invalid:4901")
+	connector := &ase.Connector{
+		DSN: info,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, network+" "+addr)
+			return l.DialContext(ctx, network, addr)
+		},
+	}
+
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for i := 0; i < 3; i++ {
+		var n int
+		if err := db.QueryRow("select 1").Scan(&n); err != nil {
+			t.Fatalf("Query %d failed: %v", i, err)
+		}
+	}
+
+	if len(dialed) != 1 || dialed[0] != "tcp db.invalid:4901" {
+		t.Errorf("Expected one dial of tcp db.invalid:4901, received %v", dialed)
+	}
+
+	dialErr := errors.New("dial failed")
+	connector.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, dialErr
+	}
+	if _, err := connector.Connect(context.Background()); !errors.Is(err, dialErr) {
+		t.Errorf("Expected error of dialer, received: %v", err)
+	}
+}
+
+func TestConnector_ConnectCancel(t *testing.T) {
+	// The server accepts connections but never responds.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cases := map[string]*ase.Connector{
+		"go-dblib": {DSN: fakeInfo(t, l.Addr().String())},
+		"dialer":   {DSN: fakeInfo(t, l.Addr().String()), Dialer: (&net.Dialer{}).DialContext},
+	}
+
+	for title, connector := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				_, err := connector.Connect(ctx)
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Expected exceeded deadline, received: %v", err)
+				}
+
+				if elapsed := time.Since(start); elapsed > 5*time.Second {
+					t.Errorf("Connect returned after %s", elapsed)
+				}
+			},
+		)
+	}
+}
+
+// testCert returns a self-signed certificate for name.
+func testCert(t *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestConnector_TLSConfig(t *testing.T) {
+	serverCert, serverX509 := testCert(t, "db.example", x509.ExtKeyUsageServerAuth)
+	clientCert, clientX509 := testCert(t, "client", x509.ExtKeyUsageClientAuth)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(serverX509)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &aseserver.Server{
+		Handler:  selectOne,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		},
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	cases := map[string]struct {
+		tlsConfig *tls.Config
+		expectErr bool
+	}{
+		"client certificate": {
+			tlsConfig: &tls.Config{ServerName: "db.example", RootCAs: rootCAs, Certificates: []tls.Certificate{clientCert}},
+		},
+		"missing client certificate": {
+			tlsConfig: &tls.Config{ServerName: "db.example", RootCAs: rootCAs},
+			expectErr: true,
+		},
+		"unknown server certificate": {
+			tlsConfig: &tls.Config{ServerName: "db.example", Certificates: []tls.Certificate{clientCert}},
+			expectErr: true,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				connector := &ase.Connector{DSN: fakeInfo(t, l.Addr().String()), TLSConfig: cas.tlsConfig}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				conn, err := connector.Connect(ctx)
+				if cas.expectErr {
+					if err == nil {
+						conn.Close()
+						t.Errorf("Expected connection to fail")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Connect failed: %v", err)
+				}
+				defer conn.Close()
+
+				db := sql.OpenDB(connector)
+				defer db.Close()
+
+				var n int
+				if err := db.QueryRow("select 1").Scan(&n); err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+			},
+		)
+	}
+}
+
+// rejectLogin responds to queries like selectOne and rejects logins
+// of the user "rejected".
+type rejectLogin struct {
+	aseserver.HandlerFunc
+}
+
+func (rejectLogin) HandleLogin(ctx context.Context, req *aseserver.LoginRequest) error {
+	if req.Username == "rejected" {
+		return errors.New("login failed")
+	}
+	return nil
+}
+
+// closeRecorder is a net.Conn reporting when it is closed.
+type closeRecorder struct {
+	net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (conn *closeRecorder) Close() error {
+	conn.closeOnce.Do(func() { close(conn.closed) })
+	return conn.Conn.Close()
+}
+
+func TestConnector_BridgeCleanup(t *testing.T) {
+	l := newPipeListener()
+	srv := &aseserver.Server{Handler: rejectLogin{selectOne}, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	tmpDir, err := ioutil.TempDir("", "go-ase-bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The bridge socket is created in the directory of TMPDIR.
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+
+	cases := map[string]struct {
+		username  string
+		tmpDir    string
+		expectErr string
+	}{
+		"login succeeds": {
+			username: "user",
+			tmpDir:   tmpDir,
+		},
+		"login rejected": {
+			username:  "rejected",
+			tmpDir:    tmpDir,
+			expectErr: "error logging in",
+		},
+		"temporary directory missing": {
+			username:  "user",
+			tmpDir:    tmpDir + "/missing",
+			expectErr: "set TMPDIR to a writable directory",
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				os.Setenv("TMPDIR", cas.tmpDir)
+
+				info := fakeInfo(t, "db.invalid:4901")
+				info.Username = cas.username
+
+				dialed := make(chan *closeRecorder, 1)
+				connector := &ase.Connector{
+					DSN: info,
+					Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						conn, err := l.DialContext(ctx, network, addr)
+						if err != nil {
+							return nil, err
+						}
+						recorder := &closeRecorder{Conn: conn, closed: make(chan struct{})}
+						dialed <- recorder
+						return recorder, nil
+					},
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				conn, err := connector.Connect(ctx)
+				if cas.expectErr == "" {
+					if err != nil {
+						t.Fatalf("Connect failed: %v", err)
+					}
+					conn.Close()
+				} else if err == nil || !strings.Contains(err.Error(), cas.expectErr) {
+					if conn != nil {
+						conn.Close()
+					}
+					t.Fatalf("Expected error containing %q, received: %v", cas.expectErr, err)
+				}
+
+				// The connection to the server is closed with the
+				// bridged connection.
+				select {
+				case recorder := <-dialed:
+					select {
+					case <-recorder.closed:
+					case <-time.After(5 * time.Second):
+						t.Errorf("Connection to the server was not closed")
+					}
+				default:
+					t.Errorf("Dialer was not called")
+				}
+
+				files, err := ioutil.ReadDir(tmpDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(files) != 0 {
+					t.Errorf("Expected bridge directory to be removed, found %d files in %s", len(files), tmpDir)
+				}
+			},
+		)
+	}
+}
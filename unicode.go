@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+// User types of the unicode data types. The server sends unichar and
+// univarchar as binary data types and identifies them by the user
+// type.
+const (
+	userTypeUniChar    int32 = 34
+	userTypeUniVarChar int32 = 35
+	userTypeUniText    int32 = 36
+)
+
+// utf16Order is the byte order of UTF-16 data. go-dblib announces
+// little endian integers in the login record, the server sends and
+// expects UTF-16 data in the same byte order.
+var utf16Order = binary.LittleEndian
+
+// UniChar is a string that is sent to the server as univarchar,
+// regardless of the data type the server describes for the parameter.
+//
+// Strings are sent as the data type of the parameter, which usually is
+// varchar when the server cannot infer the data type from the
+// statement:
+//
+//	db.Exec("insert into t values (?)", ase.UniChar("unicode text"))
+type UniChar string
+
+// isUnicodeFmt reports whether values of the field format are UTF-16
+// encoded.
+func isUnicodeFmt(fieldFmt tds.FieldFmt) bool {
+	switch fieldFmt.DataType() {
+	case asetypes.UNITEXT:
+		return true
+	case asetypes.LONGBINARY, asetypes.BINARY, asetypes.VARBINARY, asetypes.IMAGE:
+		switch fieldFmt.UserType() {
+		case userTypeUniChar, userTypeUniVarChar, userTypeUniText:
+			return true
+		}
+	}
+	return false
+}
+
+// isUniCharFmt reports whether the field format is unichar or
+// univarchar.
+func isUniCharFmt(fieldFmt tds.FieldFmt) bool {
+	switch fieldFmt.DataType() {
+	case asetypes.LONGBINARY, asetypes.BINARY, asetypes.VARBINARY:
+		userType := fieldFmt.UserType()
+		return userType == userTypeUniChar || userType == userTypeUniVarChar
+	}
+	return false
+}
+
+// unicodeTypeName returns the name of the unicode data type of the
+// field format or an empty string if the field format is not unicode.
+func unicodeTypeName(fieldFmt tds.FieldFmt) string {
+	if fieldFmt.DataType() == asetypes.UNITEXT {
+		return "UNITEXT"
+	}
+
+	switch fieldFmt.UserType() {
+	case userTypeUniChar:
+		return "UNICHAR"
+	case userTypeUniVarChar:
+		return "UNIVARCHAR"
+	case userTypeUniText:
+		return "UNITEXT"
+	}
+	return ""
+}
+
+// uniVarCharFmt returns a field format sending a parameter as
+// univarchar in place of fieldFmt.
+//
+// Unicode parameters that are not unichar or univarchar are sent as
+// univarchar as go-dblib does not send text pointers for unitext
+// parameters.
+func uniVarCharFmt(fieldFmt tds.FieldFmt) (tds.FieldFmt, error) {
+	uniFmt, err := tds.LookupFieldFmt(asetypes.LONGBINARY)
+	if err != nil {
+		return nil, err
+	}
+
+	uniFmt.SetName(fieldFmt.Name())
+	uniFmt.SetStatus(fieldFmt.Status())
+	uniFmt.SetUserType(userTypeUniVarChar)
+
+	return uniFmt, nil
+}
+
+// encodeUTF16 converts s from UTF-8 to UTF-16.
+func encodeUTF16(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("invalid UTF-8 string")
+	}
+
+	// utf16.Encode encodes runes outside of the basic multilingual
+	// plane as surrogate pairs.
+	units := utf16.Encode([]rune(s))
+
+	bs := make([]byte, 2*len(units))
+	for i, unit := range units {
+		utf16Order.PutUint16(bs[2*i:], unit)
+	}
+
+	return bs, nil
+}
+
+// decodeUTF16 converts bs from UTF-16 to UTF-8.
+func decodeUTF16(bs []byte) (string, error) {
+	if len(bs)%2 != 0 {
+		return "", fmt.Errorf("odd number of bytes %d", len(bs))
+	}
+
+	units := make([]uint16, len(bs)/2)
+	for i := range units {
+		units[i] = utf16Order.Uint16(bs[2*i:])
+	}
+
+	// utf16.Decode replaces unpaired surrogates instead of failing.
+	for i := 0; i < len(units); i++ {
+		if !utf16.IsSurrogate(rune(units[i])) {
+			continue
+		}
+
+		if i+1 == len(units) || utf16.DecodeRune(rune(units[i]), rune(units[i+1])) == utf8.RuneError {
+			return "", fmt.Errorf("unpaired surrogate 0x%04x at position %d", units[i], 2*i)
+		}
+		i++
+	}
+
+	return string(utf16.Decode(units)), nil
+}
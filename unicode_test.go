@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2020 SAP SE
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ase
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SAP/go-dblib/asetypes"
+	"github.com/SAP/go-dblib/tds"
+)
+
+func TestUTF16(t *testing.T) {
+	cases := map[string]struct {
+		decoded string
+		encoded []byte
+	}{
+		"empty": {
+			decoded: "",
+			encoded: []byte{},
+		},
+		"ascii": {
+			decoded: "ab",
+			encoded: []byte{'a', 0, 'b', 0},
+		},
+		"latin": {
+			decoded: "ü",
+			encoded: []byte{0xfc, 0x00},
+		},
+		"basic multilingual plane": {
+			decoded: "日本",
+			encoded: []byte{0xe5, 0x65, 0x2c, 0x67},
+		},
+		"surrogate pair": {
+			decoded: "😀",
+			encoded: []byte{0x3d, 0xd8, 0x00, 0xde},
+		},
+		"surrogate pairs between characters": {
+			decoded: "a😀𝄞b",
+			encoded: []byte{'a', 0, 0x3d, 0xd8, 0x00, 0xde, 0x34, 0xd8, 0x1e, 0xdd, 'b', 0},
+		},
+		"replacement character": {
+			decoded: "�",
+			encoded: []byte{0xfd, 0xff},
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				encoded, err := encodeUTF16(cas.decoded)
+				if err != nil {
+					t.Fatalf("Encoding failed: %v", err)
+				}
+
+				if !bytes.Equal(encoded, cas.encoded) {
+					t.Errorf("Expected %q to be encoded as % x, received % x", cas.decoded, cas.encoded, encoded)
+				}
+
+				decoded, err := decodeUTF16(cas.encoded)
+				if err != nil {
+					t.Fatalf("Decoding failed: %v", err)
+				}
+
+				if decoded != cas.decoded {
+					t.Errorf("Expected % x to be decoded as %q, received %q", cas.encoded, cas.decoded, decoded)
+				}
+			},
+		)
+	}
+}
+
+func TestUTF16_Errors(t *testing.T) {
+	cases := map[string][]byte{
+		"odd number of bytes":           {'a', 0, 'b'},
+		"high surrogate at end":         {'a', 0, 0x3d, 0xd8},
+		"high surrogate before char":    {0x3d, 0xd8, 'a', 0},
+		"two high surrogates":           {0x3d, 0xd8, 0x3d, 0xd8, 0x00, 0xde},
+		"low surrogate without high":    {0x00, 0xde, 'a', 0},
+		"low surrogate after surrogate": {0x3d, 0xd8, 0x00, 0xde, 0x00, 0xde},
+	}
+
+	for title, encoded := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				if decoded, err := decodeUTF16(encoded); err == nil {
+					t.Errorf("Expected decoding % x to fail, received %q", encoded, decoded)
+				}
+			},
+		)
+	}
+
+	if encoded, err := encodeUTF16("a\xffb"); err == nil {
+		t.Errorf("Expected encoding invalid UTF-8 to fail, received % x", encoded)
+	}
+}
+
+func TestIsUnicodeFmt(t *testing.T) {
+	cases := map[string]struct {
+		dataType   asetypes.DataType
+		userType   int32
+		expect     bool
+		expectName string
+	}{
+		"unichar": {
+			dataType:   asetypes.BINARY,
+			userType:   userTypeUniChar,
+			expect:     true,
+			expectName: "UNICHAR",
+		},
+		"univarchar": {
+			dataType:   asetypes.LONGBINARY,
+			userType:   userTypeUniVarChar,
+			expect:     true,
+			expectName: "UNIVARCHAR",
+		},
+		"unitext": {
+			dataType:   asetypes.UNITEXT,
+			expect:     true,
+			expectName: "UNITEXT",
+		},
+		"binary": {
+			dataType: asetypes.BINARY,
+			userType: 3,
+		},
+		"varchar": {
+			dataType: asetypes.VARCHAR,
+			userType: userTypeUniVarChar,
+		},
+	}
+
+	for title, cas := range cases {
+		t.Run(title,
+			func(t *testing.T) {
+				fieldFmt, err := tds.LookupFieldFmt(cas.dataType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fieldFmt.SetUserType(cas.userType)
+
+				if isUnicode := isUnicodeFmt(fieldFmt); isUnicode != cas.expect {
+					t.Errorf("Expected isUnicodeFmt to report %t, received %t", cas.expect, isUnicode)
+				}
+
+				if name := unicodeTypeName(fieldFmt); cas.expect && name != cas.expectName {
+					t.Errorf("Expected type name %q, received %q", cas.expectName, name)
+				}
+			},
+		)
+	}
+}